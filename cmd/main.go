@@ -7,25 +7,46 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"github.com/kranti/cashflow/config"
+	"github.com/kranti/cashflow/internal/financial"
 	"github.com/kranti/cashflow/internal/s3"
+	"github.com/kranti/cashflow/internal/upload"
+	"github.com/kranti/cashflow/internal/version"
+	"github.com/kranti/cashflow/internal/webhook"
 )
 
 func main() {
 	_ = godotenv.Load()
 
-	logLevel := slog.LevelInfo
-	if level := os.Getenv("LOG_LEVEL"); level == "debug" {
-		logLevel = slog.LevelDebug
+	logger, logOutput, err := config.NewLogger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to set up logging: %v\n", err)
+		os.Exit(1)
 	}
+	defer logOutput.Close()
+
+	info := version.Get()
+	logger.Info("starting cashflow",
+		slog.String("version", info.Version),
+		slog.String("commit", info.Commit),
+		slog.String("build_time", info.BuildTime))
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: logLevel,
-	}))
+	// SIGHUP reopens a log file after it has been rotated
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := logOutput.Reopen(); err != nil {
+				logger.Error("failed to reopen log output", slog.String("error", err.Error()))
+			}
+		}
+	}()
 
 	db, err := config.NewDatabase(logger)
 	if err != nil {
@@ -34,6 +55,26 @@ func main() {
 	}
 	defer db.Close()
 
+	if os.Getenv("RUN_MIGRATIONS") == "true" {
+		if err := config.RunMigrations(context.Background(), db, logger); err != nil {
+			logger.Error("failed to run migrations", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	// Rows from before user scoping stay hidden until they have an owner
+	if owner := os.Getenv("LEGACY_OWNER_ID"); owner != "" {
+		ownerID, err := uuid.Parse(owner)
+		if err != nil {
+			logger.Error("invalid LEGACY_OWNER_ID", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		if err := config.AssignLegacyOwner(context.Background(), db, ownerID, logger); err != nil {
+			logger.Error("failed to assign legacy rows", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+	}
+
 	s3Config, err := s3.NewConfig()
 	if err != nil {
 		logger.Error("failed to load S3 config", slog.String("error", err.Error()))
@@ -46,7 +87,43 @@ func main() {
 		os.Exit(1)
 	}
 
-	router := config.SetupRoutes(db, s3Service, logger)
+	serverConfig, err := config.NewServerConfig()
+	if err != nil {
+		logger.Error("failed to load server config", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	uploadConfig, err := upload.NewConfig()
+	if err != nil {
+		logger.Error("failed to load upload config", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	financialConfig, err := financial.NewConfig()
+	if err != nil {
+		logger.Error("failed to load financial config", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	webhookConfig, err := webhook.NewConfig()
+	if err != nil {
+		logger.Error("failed to load webhook config", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	if err := config.RegisterMetrics(db, logger); err != nil {
+		logger.Error("failed to register metrics", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	// ctx is cancelled on SIGINT/SIGTERM and stops every background worker
+	// and webhook delivery
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var workers sync.WaitGroup
+	router := config.SetupRoutes(ctx, &workers, db, s3Service, serverConfig, uploadConfig, financialConfig, webhookConfig, logger)
+	config.StartWorkers(ctx, &workers, db, s3Service, uploadConfig, logger)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -54,8 +131,12 @@ func main() {
 	}
 
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%s", port),
-		Handler: router,
+		Addr:              fmt.Sprintf(":%s", port),
+		Handler:           router,
+		ReadHeaderTimeout: serverConfig.ReadHeaderTimeout,
+		ReadTimeout:       serverConfig.ReadTimeout,
+		WriteTimeout:      serverConfig.WriteTimeout,
+		IdleTimeout:       serverConfig.IdleTimeout,
 	}
 
 	go func() {
@@ -66,18 +147,37 @@ func main() {
 		}
 	}()
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	<-ctx.Done()
+	stop()
 
 	logger.Info("shutting down server...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := srv.Shutdown(ctx); err != nil {
+	exitCode := 0
+	if err := srv.Shutdown(shutdownCtx); err != nil {
 		logger.Error("server forced to shutdown", slog.String("error", err.Error()))
-		os.Exit(1)
+		exitCode = 1
+	}
+
+	// Give workers the rest of the shutdown timeout to finish a run in progress
+	// and webhook deliveries to record what they could not send
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
+	}()
+
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		logger.Error("background work did not stop before the shutdown timeout")
+		exitCode = 1
+	}
+
+	if exitCode != 0 {
+		os.Exit(exitCode)
 	}
 
 	logger.Info("server shutdown complete")
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// apiKeyNamespace seeds the user IDs derived for API keys listed without one.
+var apiKeyNamespace = uuid.MustParse("6f1c1c2e-3d4b-4f5a-9e8d-7c6b5a4f3e2d")
+
+// loadAPIKeys reads the comma-separated API_KEYS environment variable and maps
+// each key to the user it authenticates. Entries are either "user-uuid:key",
+// so several keys can share a user, or a bare key, which gets a stable user ID
+// derived from the key itself. Rotating a bare key therefore changes its user.
+func loadAPIKeys() map[string]uuid.UUID {
+	keys := make(map[string]uuid.UUID)
+	for _, entry := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if user, key, found := strings.Cut(entry, ":"); found {
+			if userID, err := uuid.Parse(user); err == nil && key != "" {
+				keys[key] = userID
+				continue
+			}
+		}
+
+		keys[entry] = uuid.NewSHA1(apiKeyNamespace, []byte(entry))
+	}
+	return keys
+}
+
+// loadAdminUsers reads the comma-separated ADMIN_USER_IDS environment
+// variable. Invalid IDs are skipped. Admins are identified by user, so their
+// keys should be listed in API_KEYS as "user-uuid:key".
+func loadAdminUsers() map[uuid.UUID]bool {
+	admins := make(map[uuid.UUID]bool)
+	for _, entry := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if userID, err := uuid.Parse(strings.TrimSpace(entry)); err == nil {
+			admins[userID] = true
+		}
+	}
+	return admins
+}
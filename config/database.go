@@ -5,10 +5,20 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
+	"time"
 
 	_ "github.com/lib/pq"
 )
 
+// validSSLModes are the sslmode values supported by lib/pq.
+var validSSLModes = map[string]bool{
+	"disable":     true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
 func NewDatabase(logger *slog.Logger) (*sql.DB, error) {
 	host := os.Getenv("DB_HOST")
 	if host == "" {
@@ -35,14 +45,41 @@ func NewDatabase(logger *slog.Logger) (*sql.DB, error) {
 		return nil, fmt.Errorf("DB_NAME environment variable is required")
 	}
 
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		host, port, user, password, dbname)
+	sslMode := os.Getenv("DB_SSLMODE")
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	if !validSSLModes[sslMode] {
+		return nil, fmt.Errorf("invalid DB_SSLMODE %q, expected one of: disable, require, verify-ca, verify-full", sslMode)
+	}
+
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		host, port, user, password, dbname, sslMode)
+
+	// The root certificate is only consulted by the verify modes
+	if rootCert := os.Getenv("DB_SSLROOTCERT"); rootCert != "" {
+		dsn += fmt.Sprintf(" sslrootcert=%s", rootCert)
+	}
 
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("opening database: %w", err)
 	}
 
+	maxOpenConns := envInt("DB_MAX_OPEN_CONNS", 25)
+	maxIdleConns := envInt("DB_MAX_IDLE_CONNS", 5)
+	connMaxLifetime := 5 * time.Minute
+	if v := os.Getenv("DB_CONN_MAX_LIFETIME"); v != "" {
+		duration, err := time.ParseDuration(v)
+		if err == nil && duration > 0 {
+			connMaxLifetime = duration
+		}
+	}
+
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxIdleConns)
+	db.SetConnMaxLifetime(connMaxLifetime)
+
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("pinging database: %w", err)
 	}
@@ -50,7 +87,23 @@ func NewDatabase(logger *slog.Logger) (*sql.DB, error) {
 	logger.Info("connected to database",
 		slog.String("host", host),
 		slog.String("port", port),
-		slog.String("database", dbname))
+		slog.String("database", dbname),
+		slog.String("sslmode", sslMode),
+		slog.Int("max_open_conns", maxOpenConns),
+		slog.Int("max_idle_conns", maxIdleConns),
+		slog.Duration("conn_max_lifetime", connMaxLifetime))
 
 	return db, nil
-}
\ No newline at end of file
+}
+
+// envInt reads a positive integer from the environment, falling back to def
+// when the variable is unset or invalid.
+func envInt(name string, def int) int {
+	if v := os.Getenv(name); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			return n
+		}
+	}
+	return def
+}
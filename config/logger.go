@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// NewLogger builds the application logger from LOG_LEVEL, LOG_FORMAT (json or
+// text, default json) and LOG_OUTPUT (stdout, stderr or a file path, default
+// stdout). The returned LogOutput must be closed on exit.
+func NewLogger() (*slog.Logger, *LogOutput, error) {
+	logLevel := slog.LevelInfo
+	if level := os.Getenv("LOG_LEVEL"); level == "debug" {
+		logLevel = slog.LevelDebug
+	}
+
+	output, err := newLogOutput(os.Getenv("LOG_OUTPUT"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: logLevel}
+
+	var handler slog.Handler
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "text") {
+		handler = slog.NewTextHandler(output, opts)
+	} else {
+		handler = slog.NewJSONHandler(output, opts)
+	}
+
+	return slog.New(handler), output, nil
+}
+
+// LogOutput is the destination logs are written to. When it is a file it can
+// be reopened, so a log rotator can move the file aside and have the server
+// start a new one.
+type LogOutput struct {
+	mu   sync.Mutex
+	path string
+	w    io.Writer
+	file *os.File
+}
+
+func newLogOutput(dest string) (*LogOutput, error) {
+	switch strings.ToLower(dest) {
+	case "", "stdout":
+		return &LogOutput{w: os.Stdout}, nil
+	case "stderr":
+		return &LogOutput{w: os.Stderr}, nil
+	}
+
+	output := &LogOutput{path: dest}
+	if err := output.Reopen(); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func (o *LogOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.w.Write(p)
+}
+
+// Reopen closes and reopens a file output, appending to whatever file is now
+// at its path. It does nothing for stdout and stderr.
+func (o *LogOutput) Reopen() error {
+	if o.path == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(o.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening log file: %w", err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.file != nil {
+		_ = o.file.Close()
+	}
+	o.file = file
+	o.w = file
+	return nil
+}
+
+// Close closes a file output.
+func (o *LogOutput) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.file == nil {
+		return nil
+	}
+	return o.file.Close()
+}
@@ -0,0 +1,16 @@
+package config
+
+import (
+	"database/sql"
+	"log/slog"
+
+	"github.com/kranti/cashflow/internal/upload"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RegisterMetrics registers the collectors that read from the database with
+// the default Prometheus registry. Call it once at startup; registering twice
+// fails.
+func RegisterMetrics(db *sql.DB, logger *slog.Logger) error {
+	return prometheus.Register(upload.NewPendingUploadsGauge(upload.NewRepository(db), logger))
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/migrations"
+)
+
+// RunMigrations applies any pending embedded migrations. It shares the
+// schema_migrations table with the migrate CLI used by the Makefile, so it is
+// a no-op when the schema is already current.
+func RunMigrations(ctx context.Context, db *sql.DB, logger *slog.Logger) error {
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return fmt.Errorf("loading embedded migrations: %w", err)
+	}
+
+	// Use a dedicated connection so closing the migrator leaves db open
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("acquiring migration connection: %w", err)
+	}
+
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("creating migration driver: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		driver.Close()
+		return fmt.Errorf("creating migrator: %w", err)
+	}
+	defer m.Close()
+
+	from, _, err := m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+
+	if err := m.Up(); err != nil {
+		if errors.Is(err, migrate.ErrNoChange) {
+			logger.Info("database schema is up to date", slog.Uint64("version", uint64(from)))
+			return nil
+		}
+		return fmt.Errorf("applying migrations: %w", err)
+	}
+
+	to, dirty, err := m.Version()
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+
+	logger.Info("applied database migrations",
+		slog.Uint64("from_version", uint64(from)),
+		slog.Uint64("to_version", uint64(to)),
+		slog.Bool("dirty", dirty))
+
+	return nil
+}
+
+// AssignLegacyOwner gives ownerID the transactions and upload requests
+// created before migration 000009 scoped rows to users. Until then those rows
+// have no user_id and no API key can see them. Only ownerless rows are
+// touched, so it is safe to run on every start.
+func AssignLegacyOwner(ctx context.Context, db *sql.DB, ownerID uuid.UUID, logger *slog.Logger) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	counts := make(map[string]int64, 2)
+	for _, table := range []string{"transactions", "upload_requests"} {
+		result, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET user_id = $1 WHERE user_id IS NULL`, table), ownerID)
+		if err != nil {
+			return fmt.Errorf("assigning %s: %w", table, err)
+		}
+		if counts[table], err = result.RowsAffected(); err != nil {
+			return fmt.Errorf("getting rows affected: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	if counts["transactions"] > 0 || counts["upload_requests"] > 0 {
+		logger.Info("assigned legacy rows to owner",
+			slog.String("owner_id", ownerID.String()),
+			slog.Int64("transactions", counts["transactions"]),
+			slog.Int64("upload_requests", counts["upload_requests"]))
+	}
+
+	return nil
+}
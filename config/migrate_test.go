@@ -0,0 +1,54 @@
+package config
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/testutil"
+)
+
+// TestAssignLegacyOwner checks that rows from before user scoping are given
+// to the owner and rows that already have one are left alone. Needs
+// TEST_DATABASE_URL.
+func TestAssignLegacyOwner(t *testing.T) {
+	db := testutil.DB(t)
+	ctx := context.Background()
+	ownerID, otherID := uuid.New(), uuid.New()
+
+	legacyID, ownedID := uuid.New(), uuid.New()
+	query := `INSERT INTO transactions (id, user_id, date, amount_cents, type) VALUES ($1, $2, '2024-01-15', 500, 'spending')`
+	if _, err := db.ExecContext(ctx, query, legacyID, nil); err != nil {
+		t.Fatalf("inserting legacy transaction: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, query, ownedID, otherID); err != nil {
+		t.Fatalf("inserting owned transaction: %v", err)
+	}
+
+	if err := AssignLegacyOwner(ctx, db, ownerID, slog.New(slog.NewTextHandler(io.Discard, nil))); err != nil {
+		t.Fatalf("AssignLegacyOwner: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		id        uuid.UUID
+		wantOwner uuid.UUID
+	}{
+		{name: "legacy row", id: legacyID, wantOwner: ownerID},
+		{name: "owned row", id: ownedID, wantOwner: otherID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var owner uuid.UUID
+			if err := db.QueryRowContext(ctx, `SELECT user_id FROM transactions WHERE id = $1`, tt.id).Scan(&owner); err != nil {
+				t.Fatalf("reading owner: %v", err)
+			}
+			if owner != tt.wantOwner {
+				t.Errorf("user_id = %s, want %s", owner, tt.wantOwner)
+			}
+		})
+	}
+}
@@ -1,18 +1,39 @@
 package config
 
 import (
+	"compress/gzip"
+	"context"
 	"database/sql"
 	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/kranti/cashflow/internal/budget"
 	"github.com/kranti/cashflow/internal/financial"
+	"github.com/kranti/cashflow/internal/health"
 	"github.com/kranti/cashflow/internal/middleware"
 	"github.com/kranti/cashflow/internal/s3"
 	"github.com/kranti/cashflow/internal/upload"
+	"github.com/kranti/cashflow/internal/version"
+	"github.com/kranti/cashflow/internal/webhook"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func SetupRoutes(db *sql.DB, s3Service s3.Service, logger *slog.Logger) *gin.Engine {
+// streamingRoutes send their body for as long as the client takes to read it,
+// so they are exempt from the request timeout and get the longer stream write
+// timeout. A shorter deadline would cut a large export or image off after its
+// 200 status was already sent.
+var streamingRoutes = []string{
+	"/api/transactions/export",
+	"/api/transactions/:id/image",
+}
+
+// SetupRoutes wires the handlers and their services. Background work started
+// by requests, such as webhook deliveries, is registered with wg and stops
+// when ctx is cancelled.
+func SetupRoutes(ctx context.Context, wg *sync.WaitGroup, db *sql.DB, s3Service s3.Service, serverConfig *ServerConfig, uploadConfig *upload.Config, financialConfig *financial.Config, webhookConfig *webhook.Config, logger *slog.Logger) *gin.Engine {
 	// Set Gin to release mode in production
 	gin.SetMode(gin.ReleaseMode)
 
@@ -20,52 +41,158 @@ func SetupRoutes(db *sql.DB, s3Service s3.Service, logger *slog.Logger) *gin.Eng
 
 	// Add middleware
 	router.Use(middleware.RequestID())
+	router.Use(middleware.Metrics())
 	router.Use(middleware.RequestLogger(logger))
 	router.Use(middleware.StructuredLogger(logger))
-	router.Use(corsMiddleware())
+	// Set before compression wraps the writer, which hides the connection
+	router.Use(middleware.StreamDeadline(serverConfig.StreamWriteTimeout, streamingRoutes...))
+	router.Use(corsMiddleware(serverConfig, logger))
+	// Compression wraps the body logger and timeout so they see and write
+	// uncompressed bodies
+	if serverConfig.CompressionLevel != gzip.NoCompression {
+		router.Use(middleware.Compression(serverConfig.CompressionMinSize, serverConfig.CompressionLevel))
+	}
+	router.Use(middleware.BodyLogger(logger))
+	router.Use(middleware.Timeout(serverConfig.RequestTimeout, streamingRoutes...))
 
 	// Initialize upload services
 	uploadRepo := upload.NewRepository(db)
-	uploadService := upload.NewService(uploadRepo, s3Service, logger)
+	uploadService := upload.NewService(uploadRepo, s3Service, uploadConfig, logger)
 	uploadHandler := upload.NewHandler(uploadService, logger)
 
-	// Initialize financial services with upload service dependency
+	// Initialize budget services, which pace budgets against the spending
+	// in the financial repository
 	financialRepo := financial.NewRepository(db)
-	financialService := financial.NewService(financialRepo, s3Service, uploadService, logger)
-	financialHandler := financial.NewHandler(financialService, logger)
+	budgetRepo := budget.NewRepository(db)
+	budgetService := budget.NewService(budgetRepo, financialRepo, logger)
+	budgetHandler := budget.NewHandler(budgetService, financialConfig.Location, logger)
+
+	notifier := webhook.NewNotifier(ctx, wg, webhookConfig, webhook.NewRepository(db), logger)
+	webhookHandler := webhook.NewHandler(notifier, logger)
+
+	// Initialize financial services with upload and budget service dependencies
+	financialService := financial.NewService(financialRepo, s3Service, uploadService, budgetService, notifier, financialConfig, logger)
+	financialHandler := financial.NewHandler(financialService, financialConfig.MaxBulkItems, logger)
+
+	healthHandler := health.NewHandler(db, s3Service, 2*time.Second, logger)
 
 	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
+	router.GET("/health", healthHandler.Check)
+
+	// Build information
+	router.GET("/version", version.Handler)
+
+	// Prometheus metrics expose upload and error counts, so they need a token
+	if serverConfig.MetricsToken != "" {
+		router.GET("/metrics", middleware.BearerSecret(serverConfig.MetricsToken), gin.WrapH(promhttp.Handler()))
+	} else {
+		logger.Info("METRICS_TOKEN is not set, /metrics is disabled")
+	}
+
+	apiKeys := loadAPIKeys()
+	if len(apiKeys) == 0 {
+		logger.Warn("API_KEYS is not set, all /api requests will be rejected")
+	}
+	adminIDs := loadAdminUsers()
+
+	// S3 event notifications come from AWS rather than a user, so they are
+	// authenticated by a shared secret instead of an API key
+	if uploadConfig.EventSecret != "" {
+		router.POST("/api/uploads/s3-event",
+			middleware.SharedSecret(upload.EventSecretHeader, uploadConfig.EventSecret),
+			middleware.BodyLimit(serverConfig.MaxBodySize),
+			uploadHandler.HandleS3Event)
+	} else {
+		logger.Info("UPLOAD_EVENT_SECRET is not set, uploads are completed by polling S3")
+	}
 
 	// API routes
-	api := router.Group("/api")
+	api := router.Group("/api", middleware.APIKeyAuth(apiKeys), middleware.IdentifyAdmin(adminIDs), middleware.BodyLimit(serverConfig.MaxBodySize))
 	{
 		// Upload endpoints
 		uploads := api.Group("/uploads")
 		{
 			uploads.POST("/request", uploadHandler.RequestUpload)
+			uploads.GET("/by-key", uploadHandler.GetUploadStatusByKey)
 			uploads.GET("/:id/status", uploadHandler.GetUploadStatus)
+			uploads.POST("/:id/fail", uploadHandler.MarkFailed)
+			uploads.DELETE("/:id", uploadHandler.CancelUpload)
 		}
 
 		// Transaction endpoints
 		transactions := api.Group("/transactions")
 		{
 			transactions.POST("", financialHandler.CreateTransaction)
+			transactions.POST("/import", financialHandler.ImportOFX)
+			transactions.POST("/import/json", financialHandler.ImportJSON)
 			transactions.GET("", financialHandler.ListTransactions)
 			transactions.GET("/aggregate", financialHandler.GetMonthlyAggregate)
+			transactions.GET("/aggregate/yearly", financialHandler.GetYearlyAggregate)
+			transactions.GET("/aggregate/weekly", financialHandler.GetWeeklyAggregate)
+			transactions.GET("/aggregate/daily", financialHandler.GetDailyAggregate)
+			transactions.GET("/aggregate/range", financialHandler.GetRangeAggregate)
+			transactions.GET("/aggregate/total", financialHandler.GetLifetimeAggregate)
+			transactions.GET("/aggregate/compare", financialHandler.CompareMonths)
+			transactions.GET("/rolling", financialHandler.GetRollingSpending)
+			transactions.GET("/cadence", financialHandler.GetCadence)
+			transactions.GET("/category-cost-rate", financialHandler.GetCategoryCostRate)
+			transactions.GET("/merchants", financialHandler.ListMerchants)
+			transactions.GET("/export", financialHandler.ExportTransactions)
+			transactions.GET("/:id", financialHandler.GetTransaction)
+			transactions.PATCH("/:id", financialHandler.PatchTransaction)
+			transactions.GET("/:id/image-url", financialHandler.GetImageURL)
+			transactions.GET("/:id/image", financialHandler.GetImage)
+			transactions.POST("/:id/attachments", financialHandler.AddAttachment)
+			transactions.DELETE("/:id/attachments/:attachment_id", financialHandler.RemoveAttachment)
 			transactions.DELETE("/:id", financialHandler.DeleteTransaction)
+			transactions.POST("/:id/restore", financialHandler.RestoreTransaction)
+			transactions.POST("/:id/reverse", financialHandler.ReverseTransaction)
+		}
+
+		// Admin endpoints
+		admin := api.Group("/admin", middleware.RequireAdmin(adminIDs))
+		{
+			admin.POST("/uploads/cleanup", uploadHandler.CleanupOrphanedUploads)
+			admin.POST("/uploads/:id/reconcile", uploadHandler.ReconcileUpload)
+			admin.GET("/webhook-failures", webhookHandler.ListFailures)
+			admin.POST("/webhook-failures/:id/retry", webhookHandler.RetryFailure)
+		}
+
+		// Category endpoints
+		api.GET("/categories", financialHandler.ListCategories)
+
+		// Net worth endpoints
+		api.GET("/networth/forecast", financialHandler.GetNetWorthForecast)
+
+		// Budget endpoints
+		budgets := api.Group("/budgets")
+		{
+			budgets.POST("", budgetHandler.CreateBudget)
+			budgets.GET("", budgetHandler.ListBudgets)
+			budgets.GET("/pacing", budgetHandler.GetPacing)
+			budgets.GET("/:id", budgetHandler.GetBudget)
+			budgets.PUT("/:id", budgetHandler.UpdateBudget)
+			budgets.DELETE("/:id", budgetHandler.DeleteBudget)
 		}
 	}
 
 	return router
 }
 
-func corsMiddleware() gin.HandlerFunc {
+// corsMiddleware allows the configured origins. Credentials are only allowed
+// for an explicit origin list, since browsers reject them with "*".
+func corsMiddleware(serverConfig *ServerConfig, logger *slog.Logger) gin.HandlerFunc {
 	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{"*"}
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Content-Type", "Authorization"}
+	config.AllowOrigins = serverConfig.AllowedOrigins
+	config.AllowCredentials = !serverConfig.AllowsAnyOrigin()
+
+	logger.Info("CORS configured",
+		slog.Any("allowed_origins", config.AllowOrigins),
+		slog.Bool("allow_credentials", config.AllowCredentials))
+
+	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	config.AllowHeaders = []string{"Content-Type", "Authorization", "Idempotency-Key", "If-None-Match"}
+	// Browsers hide response headers from scripts unless they are exposed
+	config.ExposeHeaders = []string{"ETag", "X-Request-ID"}
 	return cors.New(config)
 }
\ No newline at end of file
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/financial"
+	"github.com/kranti/cashflow/internal/middleware"
+	"github.com/kranti/cashflow/internal/upload"
+	"github.com/kranti/cashflow/internal/webhook"
+)
+
+// newTestRouter builds the routes with default config and a database handle
+// that is never connected, which is enough to reach the metrics endpoint.
+func newTestRouter(t *testing.T, metricsToken string) *gin.Engine {
+	t.Helper()
+
+	db, err := sql.Open("postgres", "")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	serverConfig, err := NewServerConfig()
+	if err != nil {
+		t.Fatalf("NewServerConfig: %v", err)
+	}
+	serverConfig.MetricsToken = metricsToken
+	uploadConfig, err := upload.NewConfig()
+	if err != nil {
+		t.Fatalf("upload.NewConfig: %v", err)
+	}
+	financialConfig, err := financial.NewConfig()
+	if err != nil {
+		t.Fatalf("financial.NewConfig: %v", err)
+	}
+	webhookConfig, err := webhook.NewConfig()
+	if err != nil {
+		t.Fatalf("webhook.NewConfig: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return SetupRoutes(context.Background(), &sync.WaitGroup{}, db, nil, serverConfig, uploadConfig, financialConfig, webhookConfig, logger)
+}
+
+func TestMetricsRoute(t *testing.T) {
+	tests := []struct {
+		name          string
+		metricsToken  string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "scrape with token", metricsToken: "scrape-token", authorization: "Bearer scrape-token", wantStatus: http.StatusOK},
+		{name: "scrape without token", metricsToken: "scrape-token", wantStatus: http.StatusUnauthorized},
+		{name: "API key is not enough", metricsToken: "scrape-token", authorization: "Bearer some-api-key", wantStatus: http.StatusUnauthorized},
+		{name: "disabled without a token", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		// Each case builds the routes again, which must not re-register
+		// collectors
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, tt.metricsToken)
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCORSHeaders(t *testing.T) {
+	router := newTestRouter(t, "")
+
+	// Conditional GETs send If-None-Match, which needs a preflight
+	preflight := httptest.NewRequest(http.MethodOptions, "/api/transactions/42", nil)
+	preflight.Header.Set("Origin", "https://app.example.com")
+	preflight.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	preflight.Header.Set("Access-Control-Request-Headers", "If-None-Match")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, preflight)
+
+	if allowed := strings.ToLower(w.Header().Get("Access-Control-Allow-Headers")); !strings.Contains(allowed, "if-none-match") {
+		t.Errorf("preflight allows headers %q, want If-None-Match", allowed)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/version", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	exposed := strings.ToLower(w.Header().Get("Access-Control-Expose-Headers"))
+	for _, header := range []string{"etag", "x-request-id"} {
+		if !strings.Contains(exposed, header) {
+			t.Errorf("exposed headers %q, want %s", exposed, header)
+		}
+	}
+}
+
+// slowExport streams rows with a pause before each, so the whole export takes
+// longer than the request timeout. Like the database, it stops early once the
+// request context is done.
+type slowExport struct {
+	financial.Service
+	rows  int
+	pause time.Duration
+}
+
+func (s slowExport) StreamTransactions(ctx context.Context, filter financial.ListFilter, fn func(*financial.Transaction) error) error {
+	for i := 0; i < s.rows; i++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.pause):
+		}
+
+		t := &financial.Transaction{ID: uuid.New(), Date: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), Amount: 1250, Currency: "USD", Type: financial.TransactionTypeSpending}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestExportOutlivesRequestTimeout(t *testing.T) {
+	const (
+		timeout = 20 * time.Millisecond
+		rows    = 5
+	)
+
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := financial.NewHandler(slowExport{rows: rows, pause: timeout / 2}, 100, logger)
+
+	router := gin.New()
+	router.Use(middleware.Timeout(timeout, streamingRoutes...))
+	router.GET("/api/transactions/export", handler.ExportTransactions)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/transactions/export", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	// One line per row after the CSV header
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if got := len(lines) - 1; got != rows {
+		t.Errorf("exported %d rows, want all %d", got, rows)
+	}
+}
+
+func TestExportOutlivesWriteTimeout(t *testing.T) {
+	const (
+		writeTimeout = 30 * time.Millisecond
+		rows         = 5
+	)
+
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	// The export takes longer than the server's write timeout
+	handler := financial.NewHandler(slowExport{rows: rows, pause: writeTimeout / 2}, 100, logger)
+
+	router := gin.New()
+	router.Use(middleware.StreamDeadline(time.Minute, streamingRoutes...))
+	router.GET("/api/transactions/export", handler.ExportTransactions)
+
+	server := httptest.NewUnstartedServer(router)
+	server.Config.WriteTimeout = writeTimeout
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/transactions/export")
+	if err != nil {
+		t.Fatalf("GET export: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading export: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if got := len(lines) - 1; got != rows {
+		t.Errorf("exported %d rows, want all %d", got, rows)
+	}
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"compress/gzip"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerConfig holds HTTP-level settings shared by all routes.
+type ServerConfig struct {
+	// AllowedOrigins lists the CORS origins allowed to call the API. A lone
+	// "*" allows any origin but disables credentialed requests.
+	AllowedOrigins []string
+	// RequestTimeout is the deadline applied to each request's context.
+	RequestTimeout time.Duration
+	// MaxBodySize caps API request bodies, in bytes. The default leaves room
+	// for a base64-encoded 10MB image.
+	MaxBodySize int64
+	// CompressionMinSize is the smallest response body, in bytes, that is
+	// gzipped. CompressionLevel is the gzip level; 0 turns compression off.
+	CompressionMinSize int
+	CompressionLevel   int
+	// MetricsToken is the bearer token Prometheus must send to scrape
+	// /metrics. Without it the endpoint is not served.
+	MetricsToken string
+	// ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout are the
+	// http.Server timeouts. WriteTimeout is longer than RequestTimeout, so a
+	// handler's 504 still reaches the client.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// StreamWriteTimeout replaces WriteTimeout for streamed routes, which
+	// have no request deadline, so large exports and images can finish.
+	StreamWriteTimeout time.Duration
+}
+
+func NewServerConfig() (*ServerConfig, error) {
+	origins := []string{"*"}
+	if v := os.Getenv("CORS_ALLOWED_ORIGINS"); v != "" {
+		origins = nil
+		for _, origin := range strings.Split(v, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				origins = append(origins, strings.TrimSuffix(origin, "/"))
+			}
+		}
+	}
+
+	if err := validateOrigins(origins); err != nil {
+		return nil, fmt.Errorf("invalid CORS_ALLOWED_ORIGINS: %w", err)
+	}
+
+	requestTimeout, err := durationEnv("REQUEST_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	maxBodySize := int64(12 * 1024 * 1024)
+	if v := os.Getenv("MAX_BODY_SIZE"); v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err == nil && size > 0 {
+			maxBodySize = size
+		}
+	}
+
+	compressionMinSize := 1024
+	if v := os.Getenv("COMPRESSION_MIN_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err == nil && size >= 0 {
+			compressionMinSize = size
+		}
+	}
+
+	compressionLevel := gzip.DefaultCompression
+	if v := os.Getenv("COMPRESSION_LEVEL"); v != "" {
+		level, err := strconv.Atoi(v)
+		if err == nil && level >= gzip.HuffmanOnly && level <= gzip.BestCompression {
+			compressionLevel = level
+		}
+	}
+
+	readHeaderTimeout, err := durationEnv("HTTP_READ_HEADER_TIMEOUT", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	readTimeout, err := durationEnv("HTTP_READ_TIMEOUT", 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	writeTimeout, err := durationEnv("HTTP_WRITE_TIMEOUT", requestTimeout+30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	idleTimeout, err := durationEnv("HTTP_IDLE_TIMEOUT", 120*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	streamWriteTimeout, err := durationEnv("HTTP_STREAM_WRITE_TIMEOUT", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	if writeTimeout <= requestTimeout {
+		return nil, fmt.Errorf("HTTP_WRITE_TIMEOUT (%s) must be longer than REQUEST_TIMEOUT (%s)", writeTimeout, requestTimeout)
+	}
+
+	return &ServerConfig{
+		AllowedOrigins: origins,
+		RequestTimeout: requestTimeout,
+		MaxBodySize:    maxBodySize,
+
+		CompressionMinSize: compressionMinSize,
+		CompressionLevel:   compressionLevel,
+
+		MetricsToken: os.Getenv("METRICS_TOKEN"),
+
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+
+		StreamWriteTimeout: streamWriteTimeout,
+	}, nil
+}
+
+// AllowsAnyOrigin reports whether CORS is configured with the "*" wildcard.
+func (c *ServerConfig) AllowsAnyOrigin() bool {
+	return len(c.AllowedOrigins) == 1 && c.AllowedOrigins[0] == "*"
+}
+
+func validateOrigins(origins []string) error {
+	if len(origins) == 0 {
+		return fmt.Errorf("no origins listed")
+	}
+
+	for _, origin := range origins {
+		if origin == "*" {
+			if len(origins) > 1 {
+				return fmt.Errorf("\"*\" cannot be combined with other origins")
+			}
+			continue
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			return fmt.Errorf("%q is not an http(s) origin such as https://app.example.com", origin)
+		}
+	}
+
+	return nil
+}
+
+// durationEnv reads a positive duration such as "30s" from the named
+// variable, or returns def when it is unset.
+func durationEnv(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	duration, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("invalid %s: %s is not a positive duration", name, v)
+	}
+	return duration, nil
+}
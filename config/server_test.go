@@ -0,0 +1,46 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewServerConfigTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "default", want: 30 * time.Second},
+		{name: "valid", env: map[string]string{"REQUEST_TIMEOUT": "45s"}, want: 45 * time.Second},
+		{name: "missing unit", env: map[string]string{"REQUEST_TIMEOUT": "45"}, wantErr: true},
+		{name: "zero", env: map[string]string{"REQUEST_TIMEOUT": "0s"}, wantErr: true},
+		{name: "negative", env: map[string]string{"HTTP_READ_TIMEOUT": "-1m"}, wantErr: true},
+		{name: "unparsable write timeout", env: map[string]string{"HTTP_WRITE_TIMEOUT": "soon"}, wantErr: true},
+		{name: "unparsable idle timeout", env: map[string]string{"HTTP_IDLE_TIMEOUT": "2 minutes"}, wantErr: true},
+		{name: "unparsable header timeout", env: map[string]string{"HTTP_READ_HEADER_TIMEOUT": "5"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			config, err := NewServerConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewServerConfig succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewServerConfig: %v", err)
+			}
+			if config.RequestTimeout != tt.want {
+				t.Errorf("RequestTimeout = %s, want %s", config.RequestTimeout, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+
+	"github.com/kranti/cashflow/internal/s3"
+	"github.com/kranti/cashflow/internal/upload"
+)
+
+// StartWorkers launches the background jobs. They run until ctx is cancelled
+// and each is registered with wg, so callers can wait for a run in progress to
+// finish before exiting.
+func StartWorkers(ctx context.Context, wg *sync.WaitGroup, db *sql.DB, s3Service s3.Service, uploadConfig *upload.Config, logger *slog.Logger) {
+	uploadRepo := upload.NewRepository(db)
+	uploadService := upload.NewService(uploadRepo, s3Service, uploadConfig, logger)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		upload.RunCleanupWorker(ctx, uploadService, uploadConfig.CleanupInterval, logger)
+	}()
+}
@@ -0,0 +1,147 @@
+// Package apperror defines errors that carry a stable, machine-readable code
+// and HTTP status, and the helper handlers use to write them as
+// {"error":{"code":...,"message":...}}.
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes are part of the API contract; clients match on them, so
+// existing codes must not be renamed.
+const (
+	CodeInvalidRequest         = "INVALID_REQUEST"
+	CodeValidationFailed       = "VALIDATION_FAILED"
+	CodeInvalidParameter       = "INVALID_PARAMETER"
+	CodeInvalidAmount          = "INVALID_AMOUNT"
+	CodeInvalidType            = "INVALID_TYPE"
+	CodeInvalidDate            = "INVALID_DATE"
+	CodeInvalidCurrency        = "INVALID_CURRENCY"
+	CodeInvalidTags            = "INVALID_TAGS"
+	CodeInvalidNotes           = "INVALID_NOTES"
+	CodeInvalidDescription     = "INVALID_DESCRIPTION"
+	CodeCurrencyRequired       = "CURRENCY_REQUIRED"
+	CodeInvalidImage           = "INVALID_IMAGE"
+	CodeInvalidContentType     = "INVALID_CONTENT_TYPE"
+	CodeFileTooLarge           = "FILE_TOO_LARGE"
+	CodeBodyTooLarge           = "BODY_TOO_LARGE"
+	CodeTooManyItems           = "TOO_MANY_ITEMS"
+	CodeUnauthorized           = "UNAUTHORIZED"
+	CodeForbidden              = "FORBIDDEN"
+	CodeTransactionNotFound    = "TRANSACTION_NOT_FOUND"
+	CodeImageNotFound          = "IMAGE_NOT_FOUND"
+	CodeAttachmentNotFound     = "ATTACHMENT_NOT_FOUND"
+	CodeBudgetNotFound         = "BUDGET_NOT_FOUND"
+	CodeBudgetExists           = "BUDGET_EXISTS"
+	CodeDuplicateTransaction   = "DUPLICATE_TRANSACTION"
+	CodeAlreadyReversed        = "ALREADY_REVERSED"
+	CodeUploadNotFound         = "UPLOAD_NOT_FOUND"
+	CodeUploadNotReceived      = "UPLOAD_NOT_RECEIVED"
+	CodeUploadAlreadyLinked    = "UPLOAD_ALREADY_LINKED"
+	CodeUploadNotPending       = "UPLOAD_NOT_PENDING"
+	CodeUploadContentMismatch  = "UPLOAD_CONTENT_MISMATCH"
+	CodeWebhookFailureNotFound = "WEBHOOK_FAILURE_NOT_FOUND"
+	CodeWebhookDeliveryFailed  = "WEBHOOK_DELIVERY_FAILED"
+	CodeWebhooksDisabled       = "WEBHOOKS_DISABLED"
+	CodeAggregateTimeout       = "AGGREGATE_TIMEOUT"
+	CodeRequestTimeout         = "REQUEST_TIMEOUT"
+	CodeInternal               = "INTERNAL_ERROR"
+)
+
+// Error is an error safe to show to clients. Message is returned verbatim, so
+// it must not contain internal details.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	// Details is written as the "details" object of the error body, for
+	// anything a client needs to act on the error, such as a conflicting ID
+	Details map[string]any
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Invalid returns a 400 error with a formatted message.
+func Invalid(code, format string, args ...any) *Error {
+	return New(400, code, fmt.Sprintf(format, args...))
+}
+
+// FieldError describes why one request field failed validation. Rule names
+// the check that failed, such as "required" or "max", so clients can pick
+// their own message.
+type FieldError struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationFailed returns a 422 listing the fields that failed validation,
+// keyed by their JSON name, under the "fields" detail.
+func ValidationFailed(fields map[string]FieldError) *Error {
+	err := New(422, CodeValidationFailed, "request validation failed")
+	err.Details = map[string]any{"fields": fields}
+	return err
+}
+
+// InvalidBody maps a request binding error to a 413 when the body exceeded
+// its size limit, and to a 400 otherwise. An *Error raised while decoding,
+// such as an invalid amount, is returned as is.
+func InvalidBody(err error) *Error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return New(413, CodeBodyTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit))
+	}
+	// Fields that validate themselves while decoding keep their own code
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return Invalid(CodeInvalidRequest, "Invalid request body: %s", err)
+}
+
+// RequestIDKey is the gin context key holding the ID of the current request.
+const RequestIDKey = "request_id"
+
+// Body is the JSON body for an error response. It carries the request ID, when
+// there is one, so clients can quote it and it can be matched to log lines.
+func Body(c *gin.Context, code, message string) gin.H {
+	body := gin.H{"code": code, "message": message}
+	if requestID := c.GetString(RequestIDKey); requestID != "" {
+		body["request_id"] = requestID
+	}
+	return gin.H{"error": body}
+}
+
+// Respond writes err as a structured error response using the status and code
+// of the first *Error in its chain. Other errors are reported as a 500 with
+// fallback as the message, so internal details don't reach clients.
+func Respond(c *gin.Context, err error, fallback string) {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		body := Body(c, appErr.Code, appErr.Message)
+		if len(appErr.Details) > 0 {
+			body["error"].(gin.H)["details"] = appErr.Details
+		}
+		c.JSON(appErr.Status, body)
+		return
+	}
+	c.JSON(500, Body(c, CodeInternal, fallback))
+}
+
+// Status returns the HTTP status Respond would use for err.
+func Status(err error) int {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Status
+	}
+	return 500
+}
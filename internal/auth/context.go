@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrNoUser is returned when a request context carries no authenticated user.
+var ErrNoUser = errors.New("no authenticated user")
+
+type userIDKey struct{}
+
+// WithUserID returns a copy of ctx carrying the authenticated user's ID.
+func WithUserID(ctx context.Context, userID uuid.UUID) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// UserID returns the authenticated user's ID set by the auth middleware.
+func UserID(ctx context.Context) (uuid.UUID, error) {
+	userID, ok := ctx.Value(userIDKey{}).(uuid.UUID)
+	if !ok || userID == uuid.Nil {
+		return uuid.Nil, ErrNoUser
+	}
+	return userID, nil
+}
+
+type adminKey struct{}
+
+// WithAdmin returns a copy of ctx marking the authenticated user as an admin.
+func WithAdmin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, adminKey{}, true)
+}
+
+// IsAdmin reports whether the auth middleware marked the user as an admin.
+func IsAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(adminKey{}).(bool)
+	return admin
+}
@@ -0,0 +1,158 @@
+package budget
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
+)
+
+var errInvalidBudgetID = apperror.Invalid(apperror.CodeInvalidParameter, "invalid budget ID")
+
+type Handler struct {
+	service Service
+	// location decides the current month when a request omits one
+	location *time.Location
+	// now is the clock for the current month; tests replace it
+	now    func() time.Time
+	logger *slog.Logger
+}
+
+type Service interface {
+	CreateBudget(ctx context.Context, req CreateBudgetRequest) (*Budget, error)
+	GetBudget(ctx context.Context, id uuid.UUID) (*Budget, error)
+	ListBudgets(ctx context.Context, month string) ([]*Budget, error)
+	UpdateBudget(ctx context.Context, id uuid.UUID, req UpdateBudgetRequest) (*Budget, error)
+	DeleteBudget(ctx context.Context, id uuid.UUID) error
+	Pacing(ctx context.Context, month string, today time.Time) (*Pacing, error)
+}
+
+func NewHandler(service Service, location *time.Location, logger *slog.Logger) *Handler {
+	return &Handler{
+		service:  service,
+		location: location,
+		now:      time.Now,
+		logger:   logger,
+	}
+}
+
+func (h *Handler) CreateBudget(c *gin.Context) {
+	var req CreateBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.InvalidBody(err), "")
+		return
+	}
+
+	budget, err := h.service.CreateBudget(c.Request.Context(), req)
+	if err != nil {
+		h.respondWithError(c, err, "Failed to create budget")
+		return
+	}
+
+	c.JSON(201, budget)
+}
+
+func (h *Handler) ListBudgets(c *gin.Context) {
+	month := c.Query("month")
+	if month == "" {
+		month = h.now().In(h.location).Format(monthLayout)
+	}
+
+	budgets, err := h.service.ListBudgets(c.Request.Context(), month)
+	if err != nil {
+		h.respondWithError(c, err, "Failed to list budgets")
+		return
+	}
+
+	if budgets == nil {
+		budgets = []*Budget{}
+	}
+
+	c.JSON(200, gin.H{"month": month, "budgets": budgets})
+}
+
+// GetPacing reports how each budget of the month is pacing against today's
+// date in the application timezone. The month defaults to the current one.
+func (h *Handler) GetPacing(c *gin.Context) {
+	today := h.now().In(h.location)
+	month := c.Query("month")
+	if month == "" {
+		month = today.Format(monthLayout)
+	}
+
+	pacing, err := h.service.Pacing(c.Request.Context(), month, today)
+	if err != nil {
+		h.respondWithError(c, err, "Failed to compute budget pacing")
+		return
+	}
+
+	c.JSON(200, pacing)
+}
+
+func (h *Handler) GetBudget(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.Respond(c, errInvalidBudgetID, "")
+		return
+	}
+
+	budget, err := h.service.GetBudget(c.Request.Context(), id)
+	if err != nil {
+		h.respondWithError(c, err, "Failed to get budget")
+		return
+	}
+
+	c.JSON(200, budget)
+}
+
+func (h *Handler) UpdateBudget(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.Respond(c, errInvalidBudgetID, "")
+		return
+	}
+
+	var req UpdateBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.InvalidBody(err), "")
+		return
+	}
+
+	budget, err := h.service.UpdateBudget(c.Request.Context(), id, req)
+	if err != nil {
+		h.respondWithError(c, err, "Failed to update budget")
+		return
+	}
+
+	c.JSON(200, budget)
+}
+
+func (h *Handler) DeleteBudget(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.Respond(c, errInvalidBudgetID, "")
+		return
+	}
+
+	if err := h.service.DeleteBudget(c.Request.Context(), id); err != nil {
+		h.respondWithError(c, err, "Failed to delete budget")
+		return
+	}
+
+	c.Status(204)
+}
+
+// respondWithError writes err as a structured error body. Errors that carry no
+// code are logged and reported as a 500 with the fallback message.
+func (h *Handler) respondWithError(c *gin.Context, err error, fallback string) {
+	if apperror.Status(err) >= 500 {
+		h.logger.Error("request failed",
+			slog.String("error", err.Error()),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("request_id", c.GetString(apperror.RequestIDKey)))
+	}
+	apperror.Respond(c, err, fallback)
+}
@@ -0,0 +1,146 @@
+package budget
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/auth"
+	"github.com/kranti/cashflow/internal/financial"
+)
+
+// monthRecorder records the month ListBudgets is called with.
+type monthRecorder struct {
+	Service
+	month string
+}
+
+func (r *monthRecorder) ListBudgets(ctx context.Context, month string) ([]*Budget, error) {
+	r.month = month
+	return nil, nil
+}
+
+func TestListBudgetsDefaultMonth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// When it is 23:30 UTC on 31 January, Tokyo is already in February
+	now := time.Date(2024, 1, 31, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		location string
+		query    string
+		want     string
+	}{
+		{name: "UTC", location: "UTC", want: "2024-01"},
+		{name: "Tokyo", location: "Asia/Tokyo", want: "2024-02"},
+		{name: "Los Angeles", location: "America/Los_Angeles", want: "2024-01"},
+		{name: "explicit month", location: "Asia/Tokyo", query: "?month=2023-12", want: "2023-12"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.location)
+			if err != nil {
+				t.Fatalf("loading %s: %v", tt.location, err)
+			}
+
+			service := &monthRecorder{}
+			handler := NewHandler(service, loc, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			handler.now = func() time.Time { return now }
+
+			router := gin.New()
+			router.GET("/budgets", handler.ListBudgets)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/budgets"+tt.query, nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			if service.month != tt.want {
+				t.Errorf("month = %q, want %q", service.month, tt.want)
+			}
+		})
+	}
+}
+
+// createRepo keeps the budget the service creates.
+type createRepo struct {
+	Repository
+	created *Budget
+}
+
+func (r *createRepo) Create(ctx context.Context, budget *Budget) error {
+	r.created = budget
+	return nil
+}
+
+func TestCreateBudgetValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		body         string
+		wantStatus   int
+		wantCode     string
+		wantCurrency string
+		wantAmount   financial.Money
+	}{
+		{name: "cents are kept exactly", body: `{"category":"groceries","month":"2024-01","currency":"eur","amount":400.10}`, wantStatus: http.StatusCreated, wantCurrency: "EUR", wantAmount: 40010},
+		{name: "amount as a string", body: `{"category":"groceries","month":"2024-01","amount":"0.30"}`, wantStatus: http.StatusCreated, wantCurrency: "USD", wantAmount: 30},
+		{name: "more than two decimals", body: `{"category":"groceries","month":"2024-01","amount":12.345}`, wantStatus: http.StatusBadRequest, wantCode: "INVALID_AMOUNT"},
+		{name: "unsupported currency", body: `{"category":"groceries","month":"2024-01","currency":"XYZ","amount":100}`, wantStatus: http.StatusBadRequest, wantCode: "INVALID_CURRENCY"},
+		{name: "currency that is not a code", body: `{"category":"groceries","month":"2024-01","currency":"dollars","amount":100}`, wantStatus: http.StatusBadRequest, wantCode: "INVALID_CURRENCY"},
+		{name: "zero amount", body: `{"category":"groceries","month":"2024-01","amount":0}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &createRepo{}
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			handler := NewHandler(NewService(repo, nil, logger), time.UTC, logger)
+
+			router := gin.New()
+			router.POST("/budgets", func(c *gin.Context) {
+				c.Request = c.Request.WithContext(auth.WithUserID(c.Request.Context(), uuid.New()))
+				handler.CreateBudget(c)
+			})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/budgets", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantCode != "" {
+				var body struct {
+					Error struct {
+						Code string `json:"code"`
+					} `json:"error"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error.Code != tt.wantCode {
+					t.Errorf("error code = %q, want %q", body.Error.Code, tt.wantCode)
+				}
+			}
+			if tt.wantStatus != http.StatusCreated {
+				if repo.created != nil {
+					t.Errorf("budget created for an invalid request")
+				}
+				return
+			}
+
+			if repo.created == nil {
+				t.Fatal("no budget created")
+			}
+			if repo.created.Currency != tt.wantCurrency || repo.created.Amount != tt.wantAmount {
+				t.Errorf("created %s %s, want %s %s", repo.created.Amount, repo.created.Currency, tt.wantAmount, tt.wantCurrency)
+			}
+		})
+	}
+}
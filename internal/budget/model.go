@@ -0,0 +1,55 @@
+package budget
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/financial"
+)
+
+// monthLayout is the YYYY-MM format budgets are addressed by.
+const monthLayout = "2006-01"
+
+// Budget is a spending limit for one category in one month and currency.
+// Amount is in cents, like transaction amounts, so it compares exactly with
+// what was spent.
+type Budget struct {
+	ID        uuid.UUID       `json:"id"`
+	UserID    uuid.UUID       `json:"-"`
+	Category  string          `json:"category"`
+	Month     string          `json:"month"` // YYYY-MM
+	Currency  string          `json:"currency"`
+	Amount    financial.Money `json:"amount"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type CreateBudgetRequest struct {
+	Category string          `json:"category" binding:"required"`
+	Month    string          `json:"month" binding:"required"`
+	Currency string          `json:"currency"`
+	Amount   financial.Money `json:"amount" binding:"required,gt=0"`
+}
+
+type UpdateBudgetRequest struct {
+	Amount financial.Money `json:"amount" binding:"required,gt=0"`
+}
+
+// Pacing compares, for each budget of a month, the share of the budget spent
+// with the share of the month elapsed.
+type Pacing struct {
+	Month          string           `json:"month"`
+	ElapsedPercent float64          `json:"elapsed_percent"`
+	Categories     []CategoryPacing `json:"categories"`
+}
+
+// CategoryPacing is one budget's pace. AheadOfPace is set when more of the
+// budget than of the month is used up.
+type CategoryPacing struct {
+	Category     string          `json:"category"`
+	Currency     string          `json:"currency"`
+	Budget       financial.Money `json:"budget"`
+	Spent        financial.Money `json:"spent"`
+	SpentPercent float64         `json:"spent_percent"`
+	AheadOfPace  bool            `json:"ahead_of_pace"`
+}
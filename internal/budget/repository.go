@@ -0,0 +1,185 @@
+package budget
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
+	"github.com/kranti/cashflow/internal/financial"
+	"github.com/lib/pq"
+)
+
+type Repository interface {
+	Create(ctx context.Context, budget *Budget) error
+	GetByID(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*Budget, error)
+	ListByMonth(ctx context.Context, userID uuid.UUID, month time.Time) ([]*Budget, error)
+	UpdateAmount(ctx context.Context, userID uuid.UUID, id uuid.UUID, amount financial.Money) (*Budget, error)
+	Delete(ctx context.Context, userID uuid.UUID, id uuid.UUID) error
+}
+
+// ErrBudgetNotFound is returned when no budget matches the given ID.
+var ErrBudgetNotFound = apperror.New(404, apperror.CodeBudgetNotFound, "budget not found")
+
+// ErrBudgetExists is returned when the category already has a budget for the
+// month and currency.
+var ErrBudgetExists = apperror.New(409, apperror.CodeBudgetExists, "a budget already exists for this category, month and currency")
+
+// uniqueViolation is the Postgres error code for a unique constraint failure.
+const uniqueViolation = "23505"
+
+const budgetColumns = `id, user_id, category, month, currency, amount_cents, created_at, updated_at`
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) Create(ctx context.Context, budget *Budget) error {
+	month, err := time.Parse(monthLayout, budget.Month)
+	if err != nil {
+		return fmt.Errorf("parsing budget month: %w", err)
+	}
+
+	query := `
+		INSERT INTO budgets (id, user_id, category, month, currency, amount_cents, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err = r.db.ExecContext(ctx, query,
+		budget.ID,
+		budget.UserID,
+		budget.Category,
+		month,
+		budget.Currency,
+		budget.Amount,
+		budget.CreatedAt,
+		budget.UpdatedAt,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return ErrBudgetExists
+		}
+		return fmt.Errorf("creating budget: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetByID(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*Budget, error) {
+	query := fmt.Sprintf(`SELECT %s FROM budgets WHERE id = $1 AND user_id = $2`, budgetColumns)
+
+	budget, err := scanBudget(r.db.QueryRowContext(ctx, query, id, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBudgetNotFound
+		}
+		return nil, fmt.Errorf("getting budget: %w", err)
+	}
+
+	return budget, nil
+}
+
+// ListByMonth returns the budgets of the month starting at month, ordered by
+// currency and category.
+func (r *repository) ListByMonth(ctx context.Context, userID uuid.UUID, month time.Time) ([]*Budget, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM budgets
+		WHERE user_id = $1 AND month = $2
+		ORDER BY currency, category
+	`, budgetColumns)
+
+	rows, err := r.db.QueryContext(ctx, query, userID, month)
+	if err != nil {
+		return nil, fmt.Errorf("listing budgets: %w", err)
+	}
+	defer rows.Close()
+
+	var budgets []*Budget
+	for rows.Next() {
+		budget, err := scanBudget(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning budget: %w", err)
+		}
+		budgets = append(budgets, budget)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating budgets: %w", err)
+	}
+
+	return budgets, nil
+}
+
+func (r *repository) UpdateAmount(ctx context.Context, userID uuid.UUID, id uuid.UUID, amount financial.Money) (*Budget, error) {
+	query := fmt.Sprintf(`
+		UPDATE budgets
+		SET amount_cents = $1
+		WHERE id = $2 AND user_id = $3
+		RETURNING %s
+	`, budgetColumns)
+
+	budget, err := scanBudget(r.db.QueryRowContext(ctx, query, amount, id, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBudgetNotFound
+		}
+		return nil, fmt.Errorf("updating budget: %w", err)
+	}
+
+	return budget, nil
+}
+
+func (r *repository) Delete(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	query := `DELETE FROM budgets WHERE id = $1 AND user_id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("deleting budget: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrBudgetNotFound
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanBudget reads a row selected with budgetColumns.
+func scanBudget(row rowScanner) (*Budget, error) {
+	var b Budget
+	var month time.Time
+	err := row.Scan(
+		&b.ID,
+		&b.UserID,
+		&b.Category,
+		&month,
+		&b.Currency,
+		&b.Amount,
+		&b.CreatedAt,
+		&b.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	b.Month = month.Format(monthLayout)
+	return &b, nil
+}
@@ -0,0 +1,259 @@
+package budget
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
+	"github.com/kranti/cashflow/internal/auth"
+	"github.com/kranti/cashflow/internal/financial"
+)
+
+type service struct {
+	repo     Repository
+	spending Spending
+	logger   *slog.Logger
+}
+
+// Spending supplies the category spending budgets are paced against. The
+// financial repository implements it.
+type Spending interface {
+	SumByCategory(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]financial.CategorySummary, error)
+}
+
+func NewService(repo Repository, spending Spending, logger *slog.Logger) *service {
+	return &service{
+		repo:     repo,
+		spending: spending,
+		logger:   logger,
+	}
+}
+
+func (s *service) CreateBudget(ctx context.Context, req CreateBudgetRequest) (*Budget, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	month, err := parseMonth(req.Month)
+	if err != nil {
+		return nil, err
+	}
+
+	category := strings.TrimSpace(req.Category)
+	if category == "" {
+		return nil, apperror.Invalid(apperror.CodeInvalidParameter, "category is required")
+	}
+
+	currency, err := financial.NormalizeCurrency(req.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Amount <= 0 {
+		return nil, apperror.Invalid(apperror.CodeInvalidAmount, "amount must be greater than 0")
+	}
+
+	now := time.Now()
+	budget := &Budget{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Category:  category,
+		Month:     month.Format(monthLayout),
+		Currency:  currency,
+		Amount:    req.Amount,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := s.repo.Create(ctx, budget); err != nil {
+		return nil, fmt.Errorf("creating budget: %w", err)
+	}
+
+	s.logger.Info("budget created",
+		slog.String("id", budget.ID.String()),
+		slog.String("category", budget.Category),
+		slog.String("month", budget.Month))
+
+	return budget, nil
+}
+
+func (s *service) GetBudget(ctx context.Context, id uuid.UUID) (*Budget, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	budget, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting budget: %w", err)
+	}
+
+	return budget, nil
+}
+
+func (s *service) ListBudgets(ctx context.Context, month string) ([]*Budget, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := parseMonth(month)
+	if err != nil {
+		return nil, err
+	}
+
+	budgets, err := s.repo.ListByMonth(ctx, userID, start)
+	if err != nil {
+		return nil, fmt.Errorf("listing budgets: %w", err)
+	}
+
+	return budgets, nil
+}
+
+func (s *service) UpdateBudget(ctx context.Context, id uuid.UUID, req UpdateBudgetRequest) (*Budget, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Amount <= 0 {
+		return nil, apperror.Invalid(apperror.CodeInvalidAmount, "amount must be greater than 0")
+	}
+
+	budget, err := s.repo.UpdateAmount(ctx, userID, id, req.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("updating budget: %w", err)
+	}
+
+	return budget, nil
+}
+
+func (s *service) DeleteBudget(ctx context.Context, id uuid.UUID) error {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(ctx, userID, id); err != nil {
+		return fmt.Errorf("deleting budget: %w", err)
+	}
+
+	s.logger.Info("budget deleted",
+		slog.String("id", id.String()))
+
+	return nil
+}
+
+// MonthlyLimits returns the caller's budget amounts by category for the month
+// starting at month, in currency.
+func (s *service) MonthlyLimits(ctx context.Context, month time.Time, currency string) (map[string]financial.Money, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	budgets, err := s.repo.ListByMonth(ctx, userID, month)
+	if err != nil {
+		return nil, fmt.Errorf("listing budgets: %w", err)
+	}
+
+	limits := make(map[string]financial.Money)
+	for _, b := range budgets {
+		if b.Currency == currency {
+			limits[b.Category] = b.Amount
+		}
+	}
+
+	return limits, nil
+}
+
+// Pacing compares each of the month's budgets with what has been spent in its
+// category and currency, as of today. Months before today's are fully elapsed
+// and later months have not started.
+func (s *service) Pacing(ctx context.Context, month string, today time.Time) (*Pacing, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := parseMonth(month)
+	if err != nil {
+		return nil, err
+	}
+
+	pacing := &Pacing{
+		Month:          start.Format(monthLayout),
+		ElapsedPercent: elapsedPercent(start, today),
+		Categories:     []CategoryPacing{},
+	}
+
+	budgets, err := s.repo.ListByMonth(ctx, userID, start)
+	if err != nil {
+		return nil, fmt.Errorf("listing budgets: %w", err)
+	}
+	if len(budgets) == 0 {
+		return pacing, nil
+	}
+
+	summaries, err := s.spending.SumByCategory(ctx, userID, start, start.AddDate(0, 1, 0))
+	if err != nil {
+		return nil, fmt.Errorf("summing category spending: %w", err)
+	}
+
+	type categoryCurrency struct{ category, currency string }
+	spent := make(map[categoryCurrency]financial.Money, len(summaries))
+	for _, summary := range summaries {
+		spent[categoryCurrency{summary.Category, summary.Currency}] += summary.Spending
+	}
+
+	for _, b := range budgets {
+		category := CategoryPacing{
+			Category: b.Category,
+			Currency: b.Currency,
+			Budget:   b.Amount,
+			Spent:    spent[categoryCurrency{b.Category, b.Currency}],
+		}
+		category.SpentPercent = percent(float64(category.Spent), float64(category.Budget))
+		category.AheadOfPace = category.SpentPercent > pacing.ElapsedPercent
+		pacing.Categories = append(pacing.Categories, category)
+	}
+
+	return pacing, nil
+}
+
+// elapsedPercent is how much of the month starting at start has passed by the
+// end of today, counting today in full.
+func elapsedPercent(start, today time.Time) float64 {
+	day := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	switch {
+	case day.Before(start):
+		return 0
+	case !day.Before(end):
+		return 100
+	}
+
+	days := end.Sub(start).Hours() / 24
+	return percent(float64(day.Day()), days)
+}
+
+// percent is part as a percentage of whole, rounded to two decimals.
+func percent(part, whole float64) float64 {
+	return math.Round(part/whole*10000) / 100
+}
+
+// parseMonth parses a YYYY-MM month into its first day in UTC.
+func parseMonth(month string) (time.Time, error) {
+	start, err := time.Parse(monthLayout, month)
+	if err != nil {
+		return time.Time{}, apperror.Invalid(apperror.CodeInvalidParameter, "invalid month %q, expected YYYY-MM", month)
+	}
+	return start, nil
+}
@@ -0,0 +1,147 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
+	"github.com/kranti/cashflow/internal/auth"
+	"github.com/kranti/cashflow/internal/financial"
+)
+
+// pacingRepo serves the budgets of every month.
+type pacingRepo struct {
+	Repository
+	budgets []*Budget
+}
+
+func (r *pacingRepo) ListByMonth(ctx context.Context, userID uuid.UUID, month time.Time) ([]*Budget, error) {
+	return r.budgets, nil
+}
+
+// spendingTotals serves fixed category totals and records the range asked for.
+type spendingTotals struct {
+	summaries  []financial.CategorySummary
+	start, end time.Time
+	calls      int
+}
+
+func (s *spendingTotals) SumByCategory(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]financial.CategorySummary, error) {
+	s.start, s.end = start, end
+	s.calls++
+	return s.summaries, nil
+}
+
+func TestPacing(t *testing.T) {
+	budgets := []*Budget{
+		{Category: "groceries", Currency: "USD", Amount: 50000},
+		{Category: "rent", Currency: "USD", Amount: 100000},
+		{Category: "travel", Currency: "EUR", Amount: 10000},
+		{Category: "dining", Currency: "USD", Amount: 20000},
+	}
+	spending := []financial.CategorySummary{
+		{Category: "groceries", Currency: "USD", Spending: 30000},
+		{Category: "rent", Currency: "USD", Spending: 20000},
+		// Spending in another currency doesn't count against the EUR budget
+		{Category: "travel", Currency: "USD", Spending: 50000},
+		{Category: "dining", Currency: "USD", Spending: 25000},
+	}
+
+	tests := []struct {
+		name        string
+		month       string
+		today       time.Time
+		budgets     []*Budget
+		wantElapsed float64
+		// wantSpent and wantAhead are by category
+		wantSpent map[string]float64
+		wantAhead map[string]bool
+		wantCode  string
+	}{
+		{
+			name:  "mid-month",
+			month: "2024-01", today: time.Date(2024, 1, 12, 18, 0, 0, 0, time.UTC), budgets: budgets,
+			wantElapsed: 38.71,
+			wantSpent:   map[string]float64{"groceries": 60, "rent": 20, "travel": 0, "dining": 125},
+			wantAhead:   map[string]bool{"groceries": true, "dining": true},
+		},
+		{
+			name:  "last day of the month",
+			month: "2024-02", today: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), budgets: budgets,
+			wantElapsed: 100,
+			wantSpent:   map[string]float64{"groceries": 60, "rent": 20, "travel": 0, "dining": 125},
+			wantAhead:   map[string]bool{"dining": true},
+		},
+		{
+			name:  "past month is fully elapsed",
+			month: "2023-11", today: time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC), budgets: budgets,
+			wantElapsed: 100,
+			wantSpent:   map[string]float64{"groceries": 60, "rent": 20, "travel": 0, "dining": 125},
+			wantAhead:   map[string]bool{"dining": true},
+		},
+		{
+			name:  "future month has not started",
+			month: "2024-03", today: time.Date(2024, 2, 29, 23, 59, 0, 0, time.UTC), budgets: budgets,
+			wantElapsed: 0,
+			wantSpent:   map[string]float64{"groceries": 60, "rent": 20, "travel": 0, "dining": 125},
+			wantAhead:   map[string]bool{"groceries": true, "rent": true, "dining": true},
+		},
+		{
+			name:  "no budgets",
+			month: "2024-01", today: time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC),
+			wantElapsed: 38.71,
+		},
+		{name: "invalid month", month: "January", today: time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC), wantCode: apperror.CodeInvalidParameter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spent := &spendingTotals{summaries: spending}
+			s := NewService(&pacingRepo{budgets: tt.budgets}, spent, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			ctx := auth.WithUserID(context.Background(), uuid.New())
+
+			pacing, err := s.Pacing(ctx, tt.month, tt.today)
+			if tt.wantCode != "" {
+				var appErr *apperror.Error
+				if !errors.As(err, &appErr) || appErr.Code != tt.wantCode {
+					t.Fatalf("err = %v, want %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Pacing: %v", err)
+			}
+
+			if pacing.Month != tt.month || pacing.ElapsedPercent != tt.wantElapsed {
+				t.Errorf("month %s elapsed %v%%, want %s elapsed %v%%", pacing.Month, pacing.ElapsedPercent, tt.month, tt.wantElapsed)
+			}
+			if len(pacing.Categories) != len(tt.budgets) {
+				t.Fatalf("categories = %+v, want one per budget", pacing.Categories)
+			}
+			if len(tt.budgets) == 0 {
+				if spent.calls != 0 {
+					t.Errorf("spending queried without budgets")
+				}
+				return
+			}
+
+			start, _ := time.Parse(monthLayout, tt.month)
+			if !spent.start.Equal(start) || !spent.end.Equal(start.AddDate(0, 1, 0)) {
+				t.Errorf("spending summed from %s to %s, want the month %s", spent.start, spent.end, tt.month)
+			}
+			for _, category := range pacing.Categories {
+				if category.SpentPercent != tt.wantSpent[category.Category] {
+					t.Errorf("%s spent %v%%, want %v%%", category.Category, category.SpentPercent, tt.wantSpent[category.Category])
+				}
+				if category.AheadOfPace != tt.wantAhead[category.Category] {
+					t.Errorf("%s ahead of pace = %v, want %v", category.Category, category.AheadOfPace, tt.wantAhead[category.Category])
+				}
+			}
+		})
+	}
+}
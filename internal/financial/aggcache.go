@@ -0,0 +1,159 @@
+package financial
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// monthKey identifies one user's month in the aggregate cache.
+type monthKey struct {
+	userID uuid.UUID
+	year   int
+	month  int
+}
+
+type cacheEntry struct {
+	key    monthKey
+	totals []AggregateTotal
+	// expires is zero for closed months, which only change through writes
+	// that invalidate them
+	expires time.Time
+}
+
+// aggregateCache is a bounded LRU cache of monthly totals, per user. Entries
+// are shared between callers and must not be modified. A nil cache caches
+// nothing.
+type aggregateCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List // front is most recently used
+	entries  map[monthKey]*list.Element
+	// generation counts invalidations, so totals read before a write are not
+	// cached after it
+	generation uint64
+	// now is the clock for TTL expiry; tests replace it
+	now func() time.Time
+}
+
+func newAggregateCache(capacity int, ttl time.Duration) *aggregateCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &aggregateCache{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[monthKey]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// version returns the current generation, to be passed to put along with the
+// totals read after it.
+func (c *aggregateCache) version() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+func (c *aggregateCache) get(key monthKey) ([]AggregateTotal, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && c.now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.totals, true
+}
+
+// put caches totals for key unless the cache was invalidated since version.
+// Months that are still open, those from current on, expire after the TTL.
+func (c *aggregateCache) put(key monthKey, totals []AggregateTotal, version uint64, current time.Time) {
+	if c == nil {
+		return
+	}
+
+	entry := &cacheEntry{key: key, totals: totals}
+	if key.year > current.Year() || (key.year == current.Year() && key.month >= int(current.Month())) {
+		entry.expires = c.now().Add(c.ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generation != version {
+		return
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// invalidate drops the cached totals of the month containing date.
+func (c *aggregateCache) invalidate(userID uuid.UUID, date time.Time) {
+	if c == nil {
+		return
+	}
+
+	key := monthKey{userID: userID, year: date.Year(), month: int(date.Month())}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// invalidateUser drops every month cached for userID, for writes whose
+// previous date is unknown.
+func (c *aggregateCache) invalidateUser(userID uuid.UUID) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for key, elem := range c.entries {
+		if key.userID == userID {
+			c.order.Remove(elem)
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package financial
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// countingRepo serves AggregateByMonth from memory and counts the queries.
+type countingRepo struct {
+	Repository
+	queries int
+	totals  []AggregateTotal
+	// during runs inside each query, standing in for a write that lands
+	// while the totals are being read
+	during func()
+}
+
+func (r *countingRepo) AggregateByMonth(ctx context.Context, userID uuid.UUID, year int, month int) ([]AggregateTotal, error) {
+	r.queries++
+	if r.during != nil {
+		r.during()
+	}
+	return r.totals, nil
+}
+
+var cacheTestTotals = []AggregateTotal{
+	{Currency: "USD", Type: TransactionTypeSpending, Category: "groceries", Total: 4250, Count: 3},
+	{Currency: "USD", Type: TransactionTypeEarning, Total: 300000, Count: 1},
+}
+
+func newCachingService(repo Repository, capacity int) *service {
+	return &service{
+		repo:       repo,
+		config:     &Config{Location: time.UTC},
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		now:        func() time.Time { return time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC) },
+		aggregates: newAggregateCache(capacity, time.Minute),
+	}
+}
+
+func TestMonthTotalsCacheHit(t *testing.T) {
+	repo := &countingRepo{totals: cacheTestTotals}
+	s := newCachingService(repo, 10)
+	userID := uuid.New()
+
+	for i := 0; i < 3; i++ {
+		totals, err := s.monthTotals(context.Background(), userID, 2024, 1)
+		if err != nil {
+			t.Fatalf("monthTotals: %v", err)
+		}
+		if len(totals) != len(cacheTestTotals) {
+			t.Fatalf("totals = %v", totals)
+		}
+	}
+	if repo.queries != 1 {
+		t.Errorf("queries = %d, want 1", repo.queries)
+	}
+
+	// Another user's month is cached separately
+	if _, err := s.monthTotals(context.Background(), uuid.New(), 2024, 1); err != nil {
+		t.Fatalf("monthTotals: %v", err)
+	}
+	if repo.queries != 2 {
+		t.Errorf("queries = %d, want 2", repo.queries)
+	}
+}
+
+func TestMonthTotalsDropsResultOfRacingWrite(t *testing.T) {
+	userID := uuid.New()
+	repo := &countingRepo{totals: cacheTestTotals}
+	s := newCachingService(repo, 10)
+	// A write to the same month commits while the first query runs
+	repo.during = func() {
+		repo.during = nil
+		s.aggregates.invalidate(userID, time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC))
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.monthTotals(context.Background(), userID, 2024, 1); err != nil {
+			t.Fatalf("monthTotals: %v", err)
+		}
+	}
+	// The first result may predate the write, so it must not have been cached
+	if repo.queries != 2 {
+		t.Errorf("queries = %d, want 2", repo.queries)
+	}
+}
+
+func TestAggregateCache(t *testing.T) {
+	userID := uuid.New()
+	current := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	month := func(m int) monthKey { return monthKey{userID: userID, year: 2024, month: m} }
+
+	tests := []struct {
+		name string
+		run  func(c *aggregateCache, clock *time.Time)
+		// cached lists which months of 2024 must still be cached
+		cached    []int
+		notCached []int
+	}{
+		{
+			name: "evicts least recently used",
+			run: func(c *aggregateCache, clock *time.Time) {
+				c.put(month(1), cacheTestTotals, c.version(), current)
+				c.put(month(2), cacheTestTotals, c.version(), current)
+				c.get(month(1))
+				c.put(month(3), cacheTestTotals, c.version(), current)
+			},
+			cached:    []int{1, 3},
+			notCached: []int{2},
+		},
+		{
+			name: "current month expires after the TTL",
+			run: func(c *aggregateCache, clock *time.Time) {
+				c.put(month(3), cacheTestTotals, c.version(), current)
+				*clock = clock.Add(time.Minute + time.Second)
+			},
+			notCached: []int{3},
+		},
+		{
+			name: "current month is kept within the TTL",
+			run: func(c *aggregateCache, clock *time.Time) {
+				c.put(month(3), cacheTestTotals, c.version(), current)
+				*clock = clock.Add(30 * time.Second)
+			},
+			cached: []int{3},
+		},
+		{
+			name: "closed month does not expire",
+			run: func(c *aggregateCache, clock *time.Time) {
+				c.put(month(2), cacheTestTotals, c.version(), current)
+				*clock = clock.Add(24 * time.Hour)
+			},
+			cached: []int{2},
+		},
+		{
+			name: "put after a racing invalidate is dropped",
+			run: func(c *aggregateCache, clock *time.Time) {
+				version := c.version()
+				c.invalidate(userID, time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC))
+				c.put(month(1), cacheTestTotals, version, current)
+			},
+			notCached: []int{1},
+		},
+		{
+			name: "put after an invalidate of another month is dropped too",
+			run: func(c *aggregateCache, clock *time.Time) {
+				version := c.version()
+				c.invalidate(uuid.New(), time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC))
+				c.put(month(1), cacheTestTotals, version, current)
+			},
+			notCached: []int{1},
+		},
+		{
+			name: "invalidate drops only its month",
+			run: func(c *aggregateCache, clock *time.Time) {
+				c.put(month(1), cacheTestTotals, c.version(), current)
+				c.put(month(2), cacheTestTotals, c.version(), current)
+				c.invalidate(userID, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC))
+			},
+			cached:    []int{2},
+			notCached: []int{1},
+		},
+		{
+			name: "invalidateUser drops every month of the user",
+			run: func(c *aggregateCache, clock *time.Time) {
+				c.put(month(1), cacheTestTotals, c.version(), current)
+				c.put(month(2), cacheTestTotals, c.version(), current)
+				c.invalidateUser(userID)
+			},
+			notCached: []int{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+			c := newAggregateCache(2, time.Minute)
+			c.now = func() time.Time { return clock }
+
+			tt.run(c, &clock)
+
+			for _, m := range tt.cached {
+				if _, ok := c.get(month(m)); !ok {
+					t.Errorf("month %d not cached", m)
+				}
+			}
+			for _, m := range tt.notCached {
+				if _, ok := c.get(month(m)); ok {
+					t.Errorf("month %d still cached", m)
+				}
+			}
+		})
+	}
+}
+
+func TestAggregateCacheDisabled(t *testing.T) {
+	c := newAggregateCache(0, time.Minute)
+	if c != nil {
+		t.Fatalf("newAggregateCache(0) = %v, want nil", c)
+	}
+	// A nil cache is usable and caches nothing
+	key := monthKey{userID: uuid.New(), year: 2024, month: 1}
+	c.put(key, cacheTestTotals, c.version(), time.Now())
+	if _, ok := c.get(key); ok {
+		t.Error("nil cache returned an entry")
+	}
+	c.invalidate(key.userID, time.Now())
+	c.invalidateUser(key.userID)
+}
+
+// BenchmarkMonthTotals compares monthly totals with and without the cache.
+// queries/op shows that a cache hit doesn't reach the repository.
+func BenchmarkMonthTotals(b *testing.B) {
+	for _, bm := range []struct {
+		name     string
+		capacity int
+	}{
+		{name: "cached", capacity: 1000},
+		{name: "uncached", capacity: 0},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			repo := &countingRepo{totals: cacheTestTotals}
+			s := newCachingService(repo, bm.capacity)
+			userID := uuid.New()
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.monthTotals(ctx, userID, 2024, 1); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(repo.queries)/float64(b.N), "queries/op")
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package financial
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// What GetImage serves when a transaction's image is gone from storage.
+const (
+	// MissingImageNotFound responds 404
+	MissingImageNotFound = "404"
+	// MissingImageRedirect redirects to MissingImageURL
+	MissingImageRedirect = "redirect"
+	// MissingImagePlaceholder serves a bundled placeholder image
+	MissingImagePlaceholder = "placeholder"
+)
+
+type Config struct {
+	AggregateTimeout time.Duration
+	// AggregateCacheSize bounds how many user months of totals are cached for
+	// monthly aggregates; 0 disables the cache. The current month is cached for
+	// AggregateCacheTTL and past months until a write invalidates them.
+	AggregateCacheSize int
+	AggregateCacheTTL  time.Duration
+
+	AllowFutureDates bool
+	// DuplicateCheck, off by default, rejects a new transaction matching an
+	// existing one's amount, currency, type and description dated up to
+	// DuplicateWindowDays days either side of it, unless the client allows
+	// duplicates. Imports also reject entries repeating an earlier one.
+	DuplicateCheck      bool
+	DuplicateWindowDays int
+	// DefaultListLimit is the page size used when a list request omits limit;
+	// MaxListLimit caps any requested page size.
+	DefaultListLimit int
+	MaxListLimit     int
+	// MaxDescriptionLength caps transaction descriptions, in characters.
+	MaxDescriptionLength int
+	// MaxBulkItems caps how many transactions one import request may carry.
+	MaxBulkItems int
+	// MissingImage is one of the MissingImage modes. A placeholder keeps
+	// image grids rendering when a receipt is gone from storage;
+	// MissingImageURL is the placeholder redirected to.
+	MissingImage    string
+	MissingImageURL string
+	// Location is the application timezone. Transaction dates are calendar
+	// dates, so it only decides what "today" and the current month are.
+	Location *time.Location
+}
+
+func NewConfig() (*Config, error) {
+	aggregateTimeout, err := durationEnv("AGGREGATE_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregateCacheSize, err := intEnv("AGGREGATE_CACHE_SIZE", 1000, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregateCacheTTL, err := durationEnv("AGGREGATE_CACHE_TTL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	allowFutureDates, err := boolEnv("ALLOW_FUTURE_DATES", true)
+	if err != nil {
+		return nil, err
+	}
+
+	duplicateCheck, err := boolEnv("DUPLICATE_CHECK", false)
+	if err != nil {
+		return nil, err
+	}
+
+	duplicateWindowDays, err := intEnv("DUPLICATE_WINDOW_DAYS", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultListLimit, err := intEnv("LIST_DEFAULT_LIMIT", 20, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	maxListLimit, err := intEnv("LIST_MAX_LIMIT", 100, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	maxDescriptionLength, err := intEnv("DESCRIPTION_MAX_LENGTH", 500, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	maxBulkItems, err := intEnv("MAX_BULK_ITEMS", 1000, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	missingImage := MissingImageNotFound
+	if v := os.Getenv("MISSING_IMAGE_MODE"); v != "" {
+		missingImage = v
+	}
+	missingImageURL := os.Getenv("MISSING_IMAGE_URL")
+
+	switch missingImage {
+	case MissingImageNotFound, MissingImagePlaceholder:
+	case MissingImageRedirect:
+		u, err := url.Parse(missingImageURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("MISSING_IMAGE_URL %q must be an http(s) URL when MISSING_IMAGE_MODE is redirect", missingImageURL)
+		}
+	default:
+		return nil, fmt.Errorf("invalid MISSING_IMAGE_MODE %q, expected %s, %s or %s", missingImage, MissingImageNotFound, MissingImageRedirect, MissingImagePlaceholder)
+	}
+
+	location := time.UTC
+	if v := os.Getenv("APP_TIMEZONE"); v != "" {
+		loaded, err := time.LoadLocation(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid APP_TIMEZONE: %w", err)
+		}
+		location = loaded
+	}
+
+	if defaultListLimit > maxListLimit {
+		return nil, fmt.Errorf("LIST_DEFAULT_LIMIT (%d) must not exceed LIST_MAX_LIMIT (%d)", defaultListLimit, maxListLimit)
+	}
+
+	return &Config{
+		AggregateTimeout: aggregateTimeout,
+
+		AggregateCacheSize: aggregateCacheSize,
+		AggregateCacheTTL:  aggregateCacheTTL,
+
+		AllowFutureDates: allowFutureDates,
+
+		DuplicateCheck:      duplicateCheck,
+		DuplicateWindowDays: duplicateWindowDays,
+
+		DefaultListLimit: defaultListLimit,
+		MaxListLimit:     maxListLimit,
+
+		MaxDescriptionLength: maxDescriptionLength,
+		MaxBulkItems:         maxBulkItems,
+
+		MissingImage:    missingImage,
+		MissingImageURL: missingImageURL,
+
+		Location: location,
+	}, nil
+}
+
+// durationEnv reads a positive duration such as "30s" from the environment
+// variable name, or def when it is unset.
+func durationEnv(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	duration, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("invalid %s: %s is not a positive duration", name, v)
+	}
+	return duration, nil
+}
+
+// intEnv reads an integer of at least min from the environment variable name,
+// or def when it is unset.
+func intEnv(name string, def, min int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %q is not a whole number", name, v)
+	}
+	if n < min {
+		return 0, fmt.Errorf("invalid %s: %d is below the minimum of %d", name, n, min)
+	}
+	return n, nil
+}
+
+// boolEnv reads a boolean such as "true" or "0" from the environment variable
+// name, or def when it is unset.
+func boolEnv(name string, def bool) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+
+	enabled, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %q is not true or false", name, v)
+	}
+	return enabled, nil
+}
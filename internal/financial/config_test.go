@@ -0,0 +1,42 @@
+package financial
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewConfigInvalidValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "defaults"},
+		{name: "valid values", env: map[string]string{"DUPLICATE_CHECK": "true", "DUPLICATE_WINDOW_DAYS": "2", "AGGREGATE_TIMEOUT": "5s"}},
+		{name: "unparsable boolean", env: map[string]string{"DUPLICATE_CHECK": "yes"}, wantErr: "DUPLICATE_CHECK"},
+		{name: "unparsable number", env: map[string]string{"DUPLICATE_WINDOW_DAYS": "abc"}, wantErr: "DUPLICATE_WINDOW_DAYS"},
+		{name: "negative window", env: map[string]string{"DUPLICATE_WINDOW_DAYS": "-1"}, wantErr: "DUPLICATE_WINDOW_DAYS"},
+		{name: "zero page size", env: map[string]string{"LIST_DEFAULT_LIMIT": "0"}, wantErr: "LIST_DEFAULT_LIMIT"},
+		{name: "duration without a unit", env: map[string]string{"AGGREGATE_TIMEOUT": "10"}, wantErr: "AGGREGATE_TIMEOUT"},
+		{name: "unparsable future dates", env: map[string]string{"ALLOW_FUTURE_DATES": "sometimes"}, wantErr: "ALLOW_FUTURE_DATES"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			_, err := NewConfig()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("NewConfig: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want one naming %s", err, tt.wantErr)
+			}
+		})
+	}
+}
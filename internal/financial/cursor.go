@@ -0,0 +1,48 @@
+package financial
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
+)
+
+// Cursor is the position after the last transaction of a page in cursor
+// mode, which orders by date and then ID, both descending.
+type Cursor struct {
+	Date time.Time
+	ID   uuid.UUID
+}
+
+var errInvalidCursor = apperror.Invalid(apperror.CodeInvalidParameter, "invalid cursor")
+
+// encodeCursor returns the opaque cursor for the page after t.
+func encodeCursor(t *Transaction) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(t.Date.Format(dateLayout) + "|" + t.ID.String()))
+}
+
+func decodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	dateStr, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, errInvalidCursor
+	}
+
+	date, err := time.Parse(dateLayout, dateStr)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	return &Cursor{Date: date, ID: id}, nil
+}
@@ -0,0 +1,17 @@
+package financial
+
+import "time"
+
+// today returns the current date in the application timezone, read from the
+// service's clock. Like every transaction date it is midnight UTC, so it
+// compares and formats as a plain calendar date whatever the timezone: at
+// 23:30 UTC it is already tomorrow in Asia/Tokyo.
+func (s *service) today() time.Time {
+	return dateIn(s.now(), s.config.Location)
+}
+
+// dateIn returns the calendar date of t in loc, as midnight UTC.
+func dateIn(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
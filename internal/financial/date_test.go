@@ -0,0 +1,94 @@
+package financial
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kranti/cashflow/internal/apperror"
+)
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("loading %s: %v", name, err)
+	}
+	return loc
+}
+
+// lastEveningOfJanuary is 2024-01-31T23:30Z, when Tokyo (UTC+9) is already
+// in February and Los Angeles (UTC-8) is still on the 31st.
+var lastEveningOfJanuary = time.Date(2024, 1, 31, 23, 30, 0, 0, time.UTC)
+
+func TestDateIn(t *testing.T) {
+	tests := []struct {
+		location string
+		want     string
+	}{
+		{location: "UTC", want: "2024-01-31"},
+		{location: "Asia/Tokyo", want: "2024-02-01"},
+		{location: "America/Los_Angeles", want: "2024-01-31"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.location, func(t *testing.T) {
+			got := dateIn(lastEveningOfJanuary, loadLocation(t, tt.location))
+			if got.Format(dateLayout) != tt.want {
+				t.Errorf("dateIn = %s, want %s", got.Format(dateLayout), tt.want)
+			}
+			if got.Location() != time.UTC || got.Hour() != 0 {
+				t.Errorf("dateIn = %v, want midnight UTC", got)
+			}
+		})
+	}
+}
+
+func TestParseDateRejectsFutureDates(t *testing.T) {
+	tests := []struct {
+		name     string
+		location string
+		date     string
+		wantErr  bool
+	}{
+		{name: "today in UTC", location: "UTC", date: "2024-01-31"},
+		{name: "tomorrow in UTC", location: "UTC", date: "2024-02-01", wantErr: true},
+		{name: "already today in Tokyo", location: "Asia/Tokyo", date: "2024-02-01"},
+		{name: "tomorrow in Tokyo", location: "Asia/Tokyo", date: "2024-02-02", wantErr: true},
+		{name: "yesterday", location: "Asia/Tokyo", date: "2024-01-30"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{
+				config: &Config{Location: loadLocation(t, tt.location)},
+				now:    func() time.Time { return lastEveningOfJanuary },
+			}
+
+			date, err := s.parseDate(tt.date)
+			if tt.wantErr {
+				var appErr *apperror.Error
+				if !errors.As(err, &appErr) || appErr.Code != apperror.CodeInvalidDate {
+					t.Fatalf("err = %v, want %s", err, apperror.CodeInvalidDate)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDate(%s): %v", tt.date, err)
+			}
+			if date.Format(dateLayout) != tt.date {
+				t.Errorf("parseDate(%s) = %s", tt.date, date.Format(dateLayout))
+			}
+		})
+	}
+}
+
+func TestParseDateAllowsFutureDates(t *testing.T) {
+	s := &service{
+		config: &Config{Location: time.UTC, AllowFutureDates: true},
+		now:    func() time.Time { return lastEveningOfJanuary },
+	}
+	if _, err := s.parseDate("2030-01-01"); err != nil {
+		t.Errorf("parseDate: %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+package financial
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kranti/cashflow/internal/apperror"
+)
+
+// normalizeDescription trims surrounding whitespace from a description and
+// rejects one longer than maxLength characters or containing control
+// characters, which break single-line displays.
+func normalizeDescription(description string, maxLength int) (string, error) {
+	description = strings.TrimSpace(description)
+
+	if length := utf8.RuneCountInString(description); length > maxLength {
+		return "", apperror.Invalid(apperror.CodeInvalidDescription, "description is %d characters, exceeding the maximum of %d", length, maxLength)
+	}
+
+	if strings.ContainsFunc(description, unicode.IsControl) {
+		return "", apperror.Invalid(apperror.CodeInvalidDescription, "description must not contain control characters")
+	}
+
+	return description, nil
+}
@@ -0,0 +1,30 @@
+package financial
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// transactionETag is the entity tag of a transaction's detail view. Every
+// write to the row, including attachment changes, moves updated_at, so the
+// tag changes whenever the response would.
+func transactionETag(id uuid.UUID, updatedAt time.Time) string {
+	sum := sha256.Sum256([]byte(id.String() + "/" + updatedAt.UTC().Format(time.RFC3339Nano)))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using the
+// weak comparison RFC 9110 specifies for it.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -2,29 +2,75 @@ package financial
 
 import (
 	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
+	"github.com/kranti/cashflow/internal/importer"
 )
 
+var (
+	errInvalidTransactionID       = apperror.Invalid(apperror.CodeInvalidParameter, "invalid transaction ID")
+	errDeletedTransactionNotFound = apperror.New(404, apperror.CodeTransactionNotFound, "deleted transaction not found")
+)
+
+// imageCacheControl is sent with images streamed by GetImage.
+const imageCacheControl = "private, max-age=300"
+
 type Handler struct {
 	service Service
-	logger  *slog.Logger
+	// maxBulkItems caps the transactions accepted by one import request
+	maxBulkItems int
+	logger       *slog.Logger
 }
 
 type Service interface {
 	CreateTransaction(ctx context.Context, req CreateTransactionRequest) (*Transaction, error)
-	ListTransactions(ctx context.Context, limit, offset int) ([]*Transaction, int64, error)
-	GetMonthlyAggregate(ctx context.Context, month string) (*AggregatedData, error)
+	ImportJSON(ctx context.Context, req ImportJSONRequest, opts ImportOptions) (*ImportSummary, error)
+	ImportOFX(ctx context.Context, statement *importer.Statement, opts ImportOptions) (*ImportSummary, error)
+	GetTransaction(ctx context.Context, id uuid.UUID) (*Transaction, error)
+	GetTransactionVersion(ctx context.Context, id uuid.UUID) (time.Time, error)
+	GetImageURL(ctx context.Context, id uuid.UUID) (*ImageURLResponse, error)
+	GetImage(ctx context.Context, id uuid.UUID) (*ImageContent, error)
+	AddAttachment(ctx context.Context, transactionID uuid.UUID, uploadID string) (*Attachment, error)
+	RemoveAttachment(ctx context.Context, transactionID uuid.UUID, attachmentID uuid.UUID) error
+	PageLimit(limit int) int
+	ListTransactions(ctx context.Context, filter ListFilter, sort ListSort, limit, offset int, withBalance bool) ([]*Transaction, int64, error)
+	ListTransactionsAfter(ctx context.Context, filter ListFilter, cursor *Cursor, limit int) ([]*Transaction, string, error)
+	ListTotals(ctx context.Context, filter ListFilter) ([]ListTotal, error)
+	StreamTransactions(ctx context.Context, filter ListFilter, fn func(*Transaction) error) error
+	ListMerchants(ctx context.Context) ([]MerchantCount, error)
+	ListCategories(ctx context.Context, month string) (*CategoryList, error)
+	GetMonthlyAggregate(ctx context.Context, month string, currency string) (*AggregatedData, error)
+	GetDailyAggregate(ctx context.Context, month string, currency string, fill bool) (*DailyAggregates, error)
+	CompareMonths(ctx context.Context, from, to string, currency string) (*MonthComparison, error)
+	GetWeeklyAggregate(ctx context.Context, year int, week int, currency string) (*AggregatedData, error)
+	GetRangeAggregate(ctx context.Context, start, end time.Time, currency string) (*AggregatedData, error)
+	GetYearlyAggregate(ctx context.Context, year int, currency string) (*YearlyAggregatedData, error)
+	GetLifetimeAggregate(ctx context.Context, currency string) (*LifetimeAggregate, error)
+	GetRollingSpending(ctx context.Context, window int, from, to time.Time, currency string) (*RollingSpending, error)
+	GetCadence(ctx context.Context, from, to time.Time) (*CadenceStats, error)
+	GetCategoryCostRate(ctx context.Context, category string, from, to time.Time, currency string) (*CategoryCostRate, error)
+	GetNetWorthForecast(ctx context.Context, horizonMonths int, currency string) (*NetWorthForecast, error)
 	DeleteTransaction(ctx context.Context, id uuid.UUID) error
+	RestoreTransaction(ctx context.Context, id uuid.UUID) (*Transaction, error)
+	ReverseTransaction(ctx context.Context, id uuid.UUID) (*Transaction, error)
+	PatchTransaction(ctx context.Context, id uuid.UUID, req PatchTransactionRequest) (*Transaction, error)
 }
 
-func NewHandler(service Service, logger *slog.Logger) *Handler {
+func NewHandler(service Service, maxBulkItems int, logger *slog.Logger) *Handler {
 	return &Handler{
-		service: service,
-		logger:  logger,
+		service:      service,
+		maxBulkItems: maxBulkItems,
+		logger:       logger,
 	}
 }
 
@@ -32,36 +78,272 @@ func (h *Handler) CreateTransaction(c *gin.Context) {
 	var req CreateTransactionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.logger.Error("failed to bind request", slog.String("error", err.Error()))
-		c.JSON(400, gin.H{"error": "Invalid request body", "details": err.Error()})
+		apperror.Respond(c, apperror.InvalidBody(err), "")
 		return
 	}
+	req.IdempotencyKey = c.GetHeader("Idempotency-Key")
+	req.AllowDuplicate = c.Query("allow_duplicate") == "true"
 
 	transaction, err := h.service.CreateTransaction(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		h.respondWithError(c, err, "Failed to create transaction")
 		return
 	}
 
 	c.JSON(201, transaction)
 }
 
+func (h *Handler) ImportJSON(c *gin.Context) {
+	req, err := decodeImportJSON(c.Request.Body, h.maxBulkItems)
+	if errors.Is(err, errTooManyItems) {
+		apperror.Respond(c, h.tooManyItems(), "")
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to bind import request", slog.String("error", err.Error()))
+		apperror.Respond(c, apperror.InvalidBody(err), "")
+		return
+	}
+
+	summary, err := h.service.ImportJSON(c.Request.Context(), req, importOptions(c))
+	if err != nil {
+		h.respondWithError(c, err, "Failed to import transactions")
+		return
+	}
+
+	c.JSON(200, summary)
+}
+
+// ImportOFX imports an OFX or QFX bank statement, sent either as the raw
+// request body or as the "file" field of a multipart form.
+func (h *Handler) ImportOFX(c *gin.Context) {
+	var file io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			apperror.Respond(c, apperror.InvalidBody(err), "")
+			return
+		}
+		f, err := header.Open()
+		if err != nil {
+			h.respondWithError(c, fmt.Errorf("opening uploaded file: %w", err), "Failed to import transactions")
+			return
+		}
+		defer f.Close()
+		file = f
+	}
+
+	statement, err := importer.ParseOFX(file, h.maxBulkItems)
+	if errors.Is(err, importer.ErrTooManyEntries) {
+		apperror.Respond(c, h.tooManyItems(), "")
+		return
+	}
+	if err != nil {
+		apperror.Respond(c, apperror.InvalidBody(err), "")
+		return
+	}
+
+	summary, err := h.service.ImportOFX(c.Request.Context(), statement, importOptions(c))
+	if err != nil {
+		h.respondWithError(c, err, "Failed to import transactions")
+		return
+	}
+
+	c.JSON(200, summary)
+}
+
+// tooManyItems is the 413 returned for an import over maxBulkItems.
+func (h *Handler) tooManyItems() *apperror.Error {
+	return apperror.New(413, apperror.CodeTooManyItems, fmt.Sprintf("import exceeds the maximum of %d transactions", h.maxBulkItems))
+}
+
+func importOptions(c *gin.Context) ImportOptions {
+	return ImportOptions{
+		DryRun:          c.Query("dry_run") == "true",
+		AllowDuplicates: c.Query("allow_duplicate") == "true",
+	}
+}
+
+func (h *Handler) GetTransaction(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.Respond(c, errInvalidTransactionID, "")
+		return
+	}
+
+	// Answer a revalidation before loading attachments and presigning URLs
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		updatedAt, err := h.service.GetTransactionVersion(c.Request.Context(), id)
+		if err != nil {
+			h.respondWithError(c, err, "Failed to get transaction")
+			return
+		}
+		if etag := transactionETag(id, updatedAt); etagMatches(ifNoneMatch, etag) {
+			c.Header("ETag", etag)
+			c.Status(304)
+			return
+		}
+	}
+
+	transaction, err := h.service.GetTransaction(c.Request.Context(), id)
+	if err != nil {
+		h.respondWithError(c, err, "Failed to get transaction")
+		return
+	}
+
+	c.Header("ETag", transactionETag(transaction.ID, transaction.UpdatedAt))
+	c.JSON(200, transaction)
+}
+
+func (h *Handler) GetImageURL(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.Respond(c, errInvalidTransactionID, "")
+		return
+	}
+
+	imageURL, err := h.service.GetImageURL(c.Request.Context(), id)
+	if err != nil {
+		h.respondWithError(c, err, "Failed to get image URL")
+		return
+	}
+
+	c.JSON(200, imageURL)
+}
+
+// GetImage streams a transaction's image through the server, for clients
+// whose content security policy blocks presigned S3 URLs.
+func (h *Handler) GetImage(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.Respond(c, errInvalidTransactionID, "")
+		return
+	}
+
+	image, err := h.service.GetImage(c.Request.Context(), id)
+	if err != nil {
+		h.respondWithError(c, err, "Failed to get image")
+		return
+	}
+	if image.RedirectURL != "" {
+		c.Redirect(302, image.RedirectURL)
+		return
+	}
+	defer image.Body.Close()
+
+	contentType := image.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	// Images are private to their owner, and a transaction's image can be
+	// replaced, so shared caches must not keep it and clients only briefly
+	c.DataFromReader(200, image.Size, contentType, image.Body, map[string]string{
+		"Cache-Control":          imageCacheControl,
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+func (h *Handler) AddAttachment(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.Respond(c, errInvalidTransactionID, "")
+		return
+	}
+
+	var req AddAttachmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.InvalidBody(err), "")
+		return
+	}
+
+	attachment, err := h.service.AddAttachment(c.Request.Context(), id, req.UploadID)
+	if err != nil {
+		h.respondWithError(c, err, "Failed to add attachment")
+		return
+	}
+
+	c.JSON(201, attachment)
+}
+
+func (h *Handler) RemoveAttachment(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.Respond(c, errInvalidTransactionID, "")
+		return
+	}
+
+	attachmentID, err := uuid.Parse(c.Param("attachment_id"))
+	if err != nil {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "invalid attachment ID"), "")
+		return
+	}
+
+	if err := h.service.RemoveAttachment(c.Request.Context(), id, attachmentID); err != nil {
+		h.respondWithError(c, err, "Failed to remove attachment")
+		return
+	}
+
+	c.Status(204)
+}
+
 func (h *Handler) ListTransactions(c *gin.Context) {
-	limitStr := c.DefaultQuery("limit", "20")
-	offsetStr := c.DefaultQuery("offset", "0")
+	// A missing or malformed limit falls back to the configured default
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	limit = h.service.PageLimit(limit)
+
+	filter, err := parseListFilter(c)
+	if err != nil {
+		apperror.Respond(c, err, "")
+		return
+	}
+
+	includeTotals, err := strconv.ParseBool(c.DefaultQuery("include_totals", "false"))
+	if err != nil {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "include_totals must be true or false"), "")
+		return
+	}
+
+	// Admin only, which the service enforces
+	filter.IncludeDeleted, err = strconv.ParseBool(c.DefaultQuery("include_deleted", "false"))
+	if err != nil {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "include_deleted must be true or false"), "")
+		return
+	}
+
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		h.listTransactionsAfter(c, filter, cursor, limit, includeTotals)
+		return
+	}
+
+	// The offset is echoed back and drives next_offset, so it must be valid
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "offset must be a non-negative integer"), "")
+		return
+	}
 
-	limit, err := strconv.Atoi(limitStr)
+	sort, err := parseListSort(c)
 	if err != nil {
-		limit = 20
+		apperror.Respond(c, err, "")
+		return
 	}
 
-	offset, err := strconv.Atoi(offsetStr)
+	withBalance, err := strconv.ParseBool(c.DefaultQuery("with_balance", "false"))
 	if err != nil {
-		offset = 0
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "with_balance must be true or false"), "")
+		return
+	}
+
+	// Running balances only cover live transactions
+	if withBalance && filter.IncludeDeleted {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "with_balance cannot be combined with include_deleted"), "")
+		return
 	}
 
-	transactions, total, err := h.service.ListTransactions(c.Request.Context(), limit, offset)
+	transactions, total, err := h.service.ListTransactions(c.Request.Context(), filter, sort, limit, offset, withBalance)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to list transactions"})
+		h.respondWithError(c, err, "Failed to list transactions")
 		return
 	}
 
@@ -70,48 +352,512 @@ func (h *Handler) ListTransactions(c *gin.Context) {
 		Total:        total,
 		Limit:        limit,
 		Offset:       offset,
+		NextOffset:   offset,
+	}
+
+	if includeTotals {
+		if response.Totals, err = h.service.ListTotals(c.Request.Context(), filter); err != nil {
+			h.respondWithError(c, err, "Failed to list transactions")
+			return
+		}
+	}
+
+	if next := offset + len(transactions); int64(next) < total {
+		response.HasMore = true
+		response.NextOffset = next
+	}
+
+	c.JSON(200, response)
+}
+
+// listTransactionsAfter serves cursor mode, selected by the presence of the
+// cursor parameter; an empty cursor starts from the newest transaction. Pages
+// are always newest first, so offset, sort, order and with_balance are not
+// supported.
+func (h *Handler) listTransactionsAfter(c *gin.Context, filter ListFilter, cursorStr string, limit int, includeTotals bool) {
+	if c.Query("sort") != "" || c.Query("order") != "" || c.Query("with_balance") != "" {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "sort, order and with_balance are not supported with cursor"), "")
+		return
+	}
+
+	var cursor *Cursor
+	if cursorStr != "" {
+		var err error
+		if cursor, err = decodeCursor(cursorStr); err != nil {
+			apperror.Respond(c, err, "")
+			return
+		}
+	}
+
+	transactions, next, err := h.service.ListTransactionsAfter(c.Request.Context(), filter, cursor, limit)
+	if err != nil {
+		h.respondWithError(c, err, "Failed to list transactions")
+		return
+	}
+
+	if transactions == nil {
+		transactions = []*Transaction{}
+	}
+
+	response := CursorPageResponse{
+		Transactions: transactions,
+		Limit:        limit,
+		HasMore:      next != "",
+		NextCursor:   next,
+	}
+
+	if includeTotals {
+		if response.Totals, err = h.service.ListTotals(c.Request.Context(), filter); err != nil {
+			h.respondWithError(c, err, "Failed to list transactions")
+			return
+		}
 	}
 
 	c.JSON(200, response)
 }
 
+func (h *Handler) ExportTransactions(c *gin.Context) {
+	filter, err := parseListFilter(c)
+	if err != nil {
+		apperror.Respond(c, err, "")
+		return
+	}
+
+	filename := fmt.Sprintf("transactions_%s.csv", time.Now().Format("20060102"))
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(200)
+
+	w := csv.NewWriter(c.Writer)
+	if err := w.Write([]string{"id", "date", "amount", "currency", "type", "category", "description"}); err != nil {
+		h.logger.Error("failed to write CSV header", slog.String("error", err.Error()))
+		return
+	}
+
+	err = h.service.StreamTransactions(c.Request.Context(), filter, func(t *Transaction) error {
+		return w.Write([]string{
+			t.ID.String(),
+			t.Date.Format(dateLayout),
+			t.Amount.String(),
+			t.Currency,
+			string(t.Type),
+			t.Category,
+			t.Description,
+		})
+	})
+	w.Flush()
+
+	// Headers are already sent, so a failure can only be logged
+	if err == nil {
+		err = w.Error()
+	}
+	if err != nil {
+		h.logger.Error("failed to export transactions", slog.String("error", err.Error()))
+	}
+}
+
+func (h *Handler) ListMerchants(c *gin.Context) {
+	merchants, err := h.service.ListMerchants(c.Request.Context())
+	if err != nil {
+		h.respondWithError(c, err, "Failed to list merchants")
+		return
+	}
+
+	c.JSON(200, gin.H{"merchants": merchants})
+}
+
+func (h *Handler) ListCategories(c *gin.Context) {
+	categories, err := h.service.ListCategories(c.Request.Context(), c.Query("month"))
+	if err != nil {
+		h.respondWithError(c, err, "Failed to list categories")
+		return
+	}
+
+	c.JSON(200, categories)
+}
+
 func (h *Handler) GetMonthlyAggregate(c *gin.Context) {
 	month := c.Query("month")
 	if month == "" {
-		c.JSON(400, gin.H{"error": "month query parameter is required (format: YYYY-MM)"})
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "month query parameter is required (format: YYYY-MM)"), "")
+		return
+	}
+
+	aggregate, err := h.service.GetMonthlyAggregate(c.Request.Context(), month, c.Query("currency"))
+	if err != nil {
+		h.respondWithError(c, err, "Failed to compute aggregate")
+		return
+	}
+
+	c.JSON(200, aggregate)
+}
+
+func (h *Handler) GetDailyAggregate(c *gin.Context) {
+	month := c.Query("month")
+	if month == "" {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "month query parameter is required (format: YYYY-MM)"), "")
+		return
+	}
+
+	fill, err := strconv.ParseBool(c.DefaultQuery("fill", "false"))
+	if err != nil {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "fill must be true or false"), "")
+		return
+	}
+
+	aggregates, err := h.service.GetDailyAggregate(c.Request.Context(), month, c.Query("currency"), fill)
+	if err != nil {
+		h.respondWithError(c, err, "Failed to compute aggregate")
+		return
+	}
+
+	c.JSON(200, aggregates)
+}
+
+func (h *Handler) CompareMonths(c *gin.Context) {
+	from, to := c.Query("from"), c.Query("to")
+	if from == "" || to == "" {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "from and to query parameters are required (format: YYYY-MM)"), "")
+		return
+	}
+
+	comparison, err := h.service.CompareMonths(c.Request.Context(), from, to, c.Query("currency"))
+	if err != nil {
+		h.respondWithError(c, err, "Failed to compute aggregate")
+		return
+	}
+
+	c.JSON(200, comparison)
+}
+
+func (h *Handler) GetWeeklyAggregate(c *gin.Context) {
+	year, err := strconv.Atoi(c.Query("year"))
+	if err != nil {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "year query parameter is required (format: YYYY)"), "")
+		return
+	}
+
+	week, err := strconv.Atoi(c.Query("week"))
+	if err != nil {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "week query parameter is required (1-53)"), "")
+		return
+	}
+
+	aggregate, err := h.service.GetWeeklyAggregate(c.Request.Context(), year, week, c.Query("currency"))
+	if err != nil {
+		h.respondWithError(c, err, "Failed to compute aggregate")
+		return
+	}
+
+	c.JSON(200, aggregate)
+}
+
+func (h *Handler) GetRangeAggregate(c *gin.Context) {
+	start, err := parseDateQuery(c, "start")
+	if err != nil {
+		apperror.Respond(c, err, "")
+		return
+	}
+
+	end, err := parseDateQuery(c, "end")
+	if err != nil {
+		apperror.Respond(c, err, "")
+		return
+	}
+
+	aggregate, err := h.service.GetRangeAggregate(c.Request.Context(), start, end, c.Query("currency"))
+	if err != nil {
+		h.respondWithError(c, err, "Failed to compute aggregate")
+		return
+	}
+
+	c.JSON(200, aggregate)
+}
+
+func (h *Handler) GetLifetimeAggregate(c *gin.Context) {
+	aggregate, err := h.service.GetLifetimeAggregate(c.Request.Context(), c.Query("currency"))
+	if err != nil {
+		h.respondWithError(c, err, "Failed to compute aggregate")
+		return
+	}
+
+	c.JSON(200, aggregate)
+}
+
+func (h *Handler) GetYearlyAggregate(c *gin.Context) {
+	yearStr := c.Query("year")
+	if yearStr == "" {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "year query parameter is required (format: YYYY)"), "")
 		return
 	}
 
-	aggregate, err := h.service.GetMonthlyAggregate(c.Request.Context(), month)
+	year, err := strconv.Atoi(yearStr)
+	if err != nil || len(yearStr) != 4 {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "invalid year, expected a 4-digit year"), "")
+		return
+	}
+
+	aggregate, err := h.service.GetYearlyAggregate(c.Request.Context(), year, c.Query("currency"))
 	if err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		h.respondWithError(c, err, "Failed to compute aggregate")
 		return
 	}
 
 	c.JSON(200, aggregate)
 }
 
+func (h *Handler) GetRollingSpending(c *gin.Context) {
+	window, err := strconv.Atoi(c.DefaultQuery("window", "30"))
+	if err != nil {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "window must be a number of days"), "")
+		return
+	}
+
+	from, err := parseDateQuery(c, "from")
+	if err != nil {
+		apperror.Respond(c, err, "")
+		return
+	}
+
+	to, err := parseDateQuery(c, "to")
+	if err != nil {
+		apperror.Respond(c, err, "")
+		return
+	}
+
+	rolling, err := h.service.GetRollingSpending(c.Request.Context(), window, from, to, c.Query("currency"))
+	if err != nil {
+		h.respondWithError(c, err, "Failed to compute aggregate")
+		return
+	}
+
+	c.JSON(200, rolling)
+}
+
+func (h *Handler) GetCadence(c *gin.Context) {
+	from, err := parseDateQuery(c, "from")
+	if err != nil {
+		apperror.Respond(c, err, "")
+		return
+	}
+
+	to, err := parseDateQuery(c, "to")
+	if err != nil {
+		apperror.Respond(c, err, "")
+		return
+	}
+
+	cadence, err := h.service.GetCadence(c.Request.Context(), from, to)
+	if err != nil {
+		h.respondWithError(c, err, "Failed to compute aggregate")
+		return
+	}
+
+	c.JSON(200, cadence)
+}
+
+func (h *Handler) GetCategoryCostRate(c *gin.Context) {
+	from, err := parseDateQuery(c, "from")
+	if err != nil {
+		apperror.Respond(c, err, "")
+		return
+	}
+
+	to, err := parseDateQuery(c, "to")
+	if err != nil {
+		apperror.Respond(c, err, "")
+		return
+	}
+
+	rate, err := h.service.GetCategoryCostRate(c.Request.Context(), c.Query("category"), from, to, c.Query("currency"))
+	if err != nil {
+		h.respondWithError(c, err, "Failed to compute aggregate")
+		return
+	}
+
+	c.JSON(200, rate)
+}
+
+func (h *Handler) GetNetWorthForecast(c *gin.Context) {
+	horizonMonths, err := strconv.Atoi(c.DefaultQuery("horizon_months", "12"))
+	if err != nil {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "horizon_months must be a number of months"), "")
+		return
+	}
+
+	forecast, err := h.service.GetNetWorthForecast(c.Request.Context(), horizonMonths, c.Query("currency"))
+	if err != nil {
+		h.respondWithError(c, err, "Failed to compute forecast")
+		return
+	}
+
+	c.JSON(200, forecast)
+}
+
 func (h *Handler) DeleteTransaction(c *gin.Context) {
 	idStr := c.Param("id")
 	if idStr == "" {
-		c.JSON(400, gin.H{"error": "transaction ID is required"})
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "transaction ID is required"), "")
 		return
 	}
 
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		c.JSON(400, gin.H{"error": "invalid transaction ID"})
+		apperror.Respond(c, errInvalidTransactionID, "")
 		return
 	}
 
 	if err := h.service.DeleteTransaction(c.Request.Context(), id); err != nil {
-		h.logger.Error("failed to delete transaction",
-			slog.String("error", err.Error()),
-			slog.String("id", id.String()))
-		c.JSON(500, gin.H{"error": "Failed to delete transaction"})
+		h.respondWithError(c, err, "Failed to delete transaction")
 		return
 	}
 
 	c.Status(204)
 }
 
+func (h *Handler) RestoreTransaction(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.Respond(c, errInvalidTransactionID, "")
+		return
+	}
+
+	transaction, err := h.service.RestoreTransaction(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrTransactionNotFound) {
+			apperror.Respond(c, errDeletedTransactionNotFound, "")
+			return
+		}
+		h.respondWithError(c, err, "Failed to restore transaction")
+		return
+	}
+
+	c.JSON(200, transaction)
+}
+
+func (h *Handler) ReverseTransaction(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.Respond(c, errInvalidTransactionID, "")
+		return
+	}
+
+	reversal, err := h.service.ReverseTransaction(c.Request.Context(), id)
+	if err != nil {
+		h.respondWithError(c, err, "Failed to reverse transaction")
+		return
+	}
+
+	c.JSON(201, reversal)
+}
+
+func (h *Handler) PatchTransaction(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.Respond(c, errInvalidTransactionID, "")
+		return
+	}
+
+	var req PatchTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.Respond(c, apperror.InvalidBody(err), "")
+		return
+	}
+
+	transaction, err := h.service.PatchTransaction(c.Request.Context(), id, req)
+	if err != nil {
+		h.respondWithError(c, err, "Failed to update transaction")
+		return
+	}
+
+	c.JSON(200, transaction)
+}
+
+// parseListFilter reads the optional type, category, merchant, q, tag and date
+// range query parameters shared by list and export.
+func parseListFilter(c *gin.Context) (ListFilter, error) {
+	txType := TransactionType(c.Query("type"))
+	if txType != "" && txType != TransactionTypeSpending && txType != TransactionTypeEarning {
+		return ListFilter{}, apperror.Invalid(apperror.CodeInvalidParameter, "type must be one of: spending, earning")
+	}
+
+	startDate, err := parseOptionalDateQuery(c, "start_date")
+	if err != nil {
+		return ListFilter{}, err
+	}
+
+	endDate, err := parseOptionalDateQuery(c, "end_date")
+	if err != nil {
+		return ListFilter{}, err
+	}
+
+	if !startDate.IsZero() && !endDate.IsZero() && startDate.After(endDate) {
+		return ListFilter{}, apperror.Invalid(apperror.CodeInvalidParameter, "start_date must not be after end_date")
+	}
+
+	return ListFilter{
+		Type:      txType,
+		Category:  c.Query("category"),
+		Merchant:  c.Query("merchant"),
+		Search:    strings.TrimSpace(c.Query("q")),
+		Tag:       strings.ToLower(strings.TrimSpace(c.Query("tag"))),
+		StartDate: startDate,
+		EndDate:   endDate,
+	}, nil
+}
+
+// parseListSort reads the sort (date, amount or created_at) and order (asc or
+// desc) query parameters, defaulting to newest first by date.
+func parseListSort(c *gin.Context) (ListSort, error) {
+	sort := ListSort{Field: c.DefaultQuery("sort", "date")}
+	switch sort.Field {
+	case "date", "amount", "created_at":
+	default:
+		return ListSort{}, apperror.Invalid(apperror.CodeInvalidParameter, "sort must be one of: date, amount, created_at")
+	}
+
+	switch strings.ToLower(c.DefaultQuery("order", "desc")) {
+	case "asc":
+		sort.Ascending = true
+	case "desc":
+	default:
+		return ListSort{}, apperror.Invalid(apperror.CodeInvalidParameter, "order must be one of: asc, desc")
+	}
+
+	return sort, nil
+}
+
+// respondWithError writes err as a structured error body. Errors that carry no
+// code are logged and reported as a 500 with the fallback message.
+func (h *Handler) respondWithError(c *gin.Context, err error, fallback string) {
+	if apperror.Status(err) >= 500 {
+		h.logger.Error("request failed",
+			slog.String("error", err.Error()),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("request_id", c.GetString(apperror.RequestIDKey)))
+	}
+	apperror.Respond(c, err, fallback)
+}
+
+func parseDateQuery(c *gin.Context, name string) (time.Time, error) {
+	if c.Query(name) == "" {
+		return time.Time{}, apperror.Invalid(apperror.CodeInvalidParameter, "%s query parameter is required (format: YYYY-MM-DD)", name)
+	}
+
+	return parseOptionalDateQuery(c, name)
+}
+
+// parseOptionalDateQuery returns the zero time when the parameter is absent.
+func parseOptionalDateQuery(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, apperror.Invalid(apperror.CodeInvalidParameter, "invalid %s, expected YYYY-MM-DD", name)
+	}
+
+	return date, nil
+}
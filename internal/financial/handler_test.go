@@ -0,0 +1,251 @@
+package financial
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
+	"github.com/kranti/cashflow/internal/auth"
+	"github.com/kranti/cashflow/internal/s3"
+)
+
+// imageService serves one image of the given size.
+type imageService struct {
+	Service
+	size int64
+}
+
+func (s imageService) GetImage(ctx context.Context, id uuid.UUID) (*ImageContent, error) {
+	return &ImageContent{
+		Body:        io.NopCloser(strings.NewReader("image bytes")),
+		ContentType: "image/jpeg",
+		Size:        s.size,
+	}, nil
+}
+
+func TestGetImageContentLength(t *testing.T) {
+	tests := []struct {
+		name              string
+		size              int64
+		wantContentLength string
+	}{
+		{name: "known size", size: 11, wantContentLength: "11"},
+		{name: "unknown size", size: -1, wantContentLength: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			handler := NewHandler(imageService{size: tt.size}, 1000, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			router := gin.New()
+			router.GET("/transactions/:id/image", handler.GetImage)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/transactions/"+uuid.NewString()+"/image", nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			if got := w.Header().Get("Content-Length"); got != tt.wantContentLength {
+				t.Errorf("Content-Length = %q, want %q", got, tt.wantContentLength)
+			}
+			if w.Body.String() != "image bytes" {
+				t.Errorf("body = %q, want image bytes", w.Body)
+			}
+		})
+	}
+}
+
+// imageRepo holds one transaction with an image.
+type imageRepo struct {
+	Repository
+	transaction *Transaction
+}
+
+func (r imageRepo) GetByID(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*Transaction, error) {
+	return r.transaction, nil
+}
+
+// missingObjectS3 has lost every object.
+type missingObjectS3 struct {
+	s3.Service
+}
+
+func (missingObjectS3) GetObject(ctx context.Context, key string) (*s3.Object, error) {
+	return nil, s3.ErrObjectNotFound
+}
+
+func TestGetImageMissingFromStorage(t *testing.T) {
+	const placeholderURL = "https://cdn.example.com/no-receipt.png"
+
+	tests := []struct {
+		mode            string
+		wantStatus      int
+		wantLocation    string
+		wantContentType string
+		wantBody        []byte
+	}{
+		{mode: MissingImageNotFound, wantStatus: http.StatusNotFound},
+		{mode: MissingImageRedirect, wantStatus: http.StatusFound, wantLocation: placeholderURL},
+		{mode: MissingImagePlaceholder, wantStatus: http.StatusOK, wantContentType: "image/png", wantBody: placeholderImage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			s := &service{
+				repo:      imageRepo{transaction: &Transaction{ID: uuid.New(), ImageKey: "receipts/gone.jpg"}},
+				s3Service: missingObjectS3{},
+				config:    &Config{Location: time.UTC, MissingImage: tt.mode, MissingImageURL: placeholderURL},
+				logger:    logger,
+				now:       time.Now,
+			}
+			handler := NewHandler(s, 1000, logger)
+
+			router := gin.New()
+			router.GET("/transactions/:id/image", func(c *gin.Context) {
+				c.Request = c.Request.WithContext(auth.WithUserID(c.Request.Context(), uuid.New()))
+			}, handler.GetImage)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/transactions/"+uuid.NewString()+"/image", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+			if tt.mode == MissingImageNotFound {
+				var body struct {
+					Error struct {
+						Code string `json:"code"`
+					} `json:"error"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error.Code != apperror.CodeImageNotFound {
+					t.Errorf("body = %s, want code %s", w.Body, apperror.CodeImageNotFound)
+				}
+			}
+			if tt.wantBody != nil {
+				if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+					t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+				}
+				if !bytes.Equal(w.Body.Bytes(), tt.wantBody) {
+					t.Errorf("body is %d bytes, want the %d-byte placeholder", w.Body.Len(), len(tt.wantBody))
+				}
+			}
+		})
+	}
+}
+
+// pagingService lists pages of a fixed number of transactions.
+type pagingService struct {
+	Service
+	total int
+}
+
+func (s pagingService) PageLimit(limit int) int {
+	if limit <= 0 {
+		return 20
+	}
+	return limit
+}
+
+func (s pagingService) ListTransactions(ctx context.Context, filter ListFilter, sort ListSort, limit, offset int, withBalance bool) ([]*Transaction, int64, error) {
+	n := max(min(limit, s.total-offset), 0)
+	transactions := make([]*Transaction, n)
+	for i := range transactions {
+		transactions[i] = &Transaction{ID: uuid.New()}
+	}
+	return transactions, int64(s.total), nil
+}
+
+func (s pagingService) ListTransactionsAfter(ctx context.Context, filter ListFilter, cursor *Cursor, limit int) ([]*Transaction, string, error) {
+	return []*Transaction{}, "", nil
+}
+
+func TestListTransactionsOffset(t *testing.T) {
+	tests := []struct {
+		query          string
+		wantStatus     int
+		wantOffset     int
+		wantNextOffset int
+		wantHasMore    bool
+	}{
+		{query: "", wantStatus: http.StatusOK, wantOffset: 0, wantNextOffset: 10, wantHasMore: true},
+		{query: "offset=10", wantStatus: http.StatusOK, wantOffset: 10, wantNextOffset: 20, wantHasMore: true},
+		{query: "offset=20", wantStatus: http.StatusOK, wantOffset: 20, wantNextOffset: 20},
+		{query: "offset=-5", wantStatus: http.StatusBadRequest},
+		{query: "offset=abc", wantStatus: http.StatusBadRequest},
+		// Cursor mode ignores the offset
+		{query: "cursor=&offset=-5", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			handler := NewHandler(pagingService{total: 25}, 1000, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			router := gin.New()
+			router.GET("/transactions", handler.ListTransactions)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/transactions?limit=10&"+tt.query, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK || strings.Contains(tt.query, "cursor") {
+				return
+			}
+
+			var response ListTransactionsResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decoding %s: %v", w.Body, err)
+			}
+			if response.Offset != tt.wantOffset || response.NextOffset != tt.wantNextOffset || response.HasMore != tt.wantHasMore {
+				t.Errorf("offset = %d, next_offset = %d, has_more = %v; want %d, %d, %v",
+					response.Offset, response.NextOffset, response.HasMore, tt.wantOffset, tt.wantNextOffset, tt.wantHasMore)
+			}
+		})
+	}
+}
+
+func TestAggregateTimeoutResponse(t *testing.T) {
+	s := newStatsService(&slowRepo{})
+	s.config.AggregateTimeout = 10 * time.Millisecond
+
+	gin.SetMode(gin.TestMode)
+	handler := NewHandler(s, 1000, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	router := gin.New()
+	router.GET("/transactions/rolling", func(c *gin.Context) {
+		c.Request = c.Request.WithContext(auth.WithUserID(c.Request.Context(), uuid.New()))
+	}, handler.GetRollingSpending)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/transactions/rolling?window=7&from=2024-01-01&to=2024-01-31", nil))
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504; body %s", w.Code, w.Body)
+	}
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	if body.Error.Code != apperror.CodeAggregateTimeout {
+		t.Errorf("code = %q, want %s", body.Error.Code, apperror.CodeAggregateTimeout)
+	}
+}
@@ -0,0 +1,100 @@
+package financial
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// errTooManyItems is returned while decoding an import that carries more
+// transactions than allowed.
+var errTooManyItems = errors.New("too many transactions")
+
+// decodeImportJSON decodes an ImportJSONRequest one transaction at a time, so
+// a request over maxItems transactions is rejected as soon as the limit is
+// passed rather than after the whole array has been read.
+func decodeImportJSON(r io.Reader, maxItems int) (ImportJSONRequest, error) {
+	var req ImportJSONRequest
+	dec := json.NewDecoder(r)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return req, err
+	}
+
+	found := false
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return req, err
+		}
+
+		switch key {
+		case "mapping":
+			if err := dec.Decode(&req.Mapping); err != nil {
+				return req, err
+			}
+		case "transactions":
+			found = true
+			if req.Transactions, err = decodeImportItems(dec, maxItems); err != nil {
+				return req, err
+			}
+		default:
+			var skipped json.RawMessage
+			if err := dec.Decode(&skipped); err != nil {
+				return req, err
+			}
+		}
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return req, err
+	}
+	if !found || req.Transactions == nil {
+		return req, errors.New("transactions is required")
+	}
+	return req, nil
+}
+
+// decodeImportItems decodes the transactions array, or null, stopping with
+// errTooManyItems once it holds more than maxItems entries.
+func decodeImportItems(dec *json.Decoder, maxItems int) ([]map[string]any, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("transactions must be an array")
+	}
+
+	items := []map[string]any{}
+	for dec.More() {
+		if len(items) == maxItems {
+			return nil, errTooManyItems
+		}
+		var item map[string]any
+		if err := dec.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("invalid character %v, expected %q", token, want)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package financial
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// importBody returns a JSON import request holding n transactions.
+func importBody(n int) string {
+	items := make([]string, n)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"amount":"%d.00","date":"2024-01-15","type":"spending"}`, i+1)
+	}
+	return `{"mapping":{"amount":"amount"},"transactions":[` + strings.Join(items, ",") + `]}`
+}
+
+func TestDecodeImportJSON(t *testing.T) {
+	const limit = 3
+
+	tests := []struct {
+		name      string
+		body      string
+		wantItems int
+		wantErr   string
+		wantLimit bool
+	}{
+		{name: "empty array", body: `{"transactions":[]}`, wantItems: 0},
+		{name: "at the limit", body: importBody(limit), wantItems: limit},
+		{name: "one over the limit", body: importBody(limit + 1), wantLimit: true},
+		{name: "far over the limit", body: importBody(1000), wantLimit: true},
+		{name: "unknown keys are skipped", body: `{"source":{"bank":"x"},"transactions":[{}]}`, wantItems: 1},
+		{name: "null transactions", body: `{"transactions":null}`, wantErr: "transactions is required"},
+		{name: "missing transactions", body: `{"mapping":{}}`, wantErr: "transactions is required"},
+		{name: "transactions not an array", body: `{"transactions":{}}`, wantErr: "transactions must be an array"},
+		{name: "not an object", body: `[]`, wantErr: "expected"},
+		{name: "empty body", body: ``, wantErr: "unexpected EOF"},
+		{name: "truncated", body: `{"transactions":[{}`, wantErr: "unexpected end of JSON input"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := decodeImportJSON(strings.NewReader(tt.body), limit)
+
+			switch {
+			case tt.wantLimit:
+				if !errors.Is(err, errTooManyItems) {
+					t.Fatalf("err = %v, want errTooManyItems", err)
+				}
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("decodeImportJSON: %v", err)
+				}
+				if len(req.Transactions) != tt.wantItems {
+					t.Errorf("transactions = %d, want %d", len(req.Transactions), tt.wantItems)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeImportJSONMapping(t *testing.T) {
+	body := `{"mapping":{"amount":"Betrag","date":"Datum"},"transactions":[{"Betrag":"4.20","Datum":"2024-03-01"}]}`
+
+	req, err := decodeImportJSON(strings.NewReader(body), 10)
+	if err != nil {
+		t.Fatalf("decodeImportJSON: %v", err)
+	}
+	if req.Mapping.Amount != "Betrag" || req.Mapping.Date != "Datum" {
+		t.Errorf("mapping = %+v", req.Mapping)
+	}
+	if got := req.Transactions[0]["Betrag"]; got != "4.20" {
+		t.Errorf("Betrag = %v, want 4.20", got)
+	}
+}
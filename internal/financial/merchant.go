@@ -0,0 +1,35 @@
+package financial
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	storeNumberPattern = regexp.MustCompile(`^#?\d+$`)
+	datePattern        = regexp.MustCompile(`^\d{1,4}[/-]\d{1,2}([/-]\d{1,4})?$`)
+)
+
+// normalizeMerchant extracts a display merchant name from a free-text
+// description such as a bank statement line. Everything from the first store
+// number or date onwards is dropped, so "STARBUCKS #1234 NY" becomes
+// "Starbucks". It returns an empty string when no name can be extracted.
+func normalizeMerchant(description string) string {
+	var words []string
+	for _, field := range strings.Fields(description) {
+		if storeNumberPattern.MatchString(field) || datePattern.MatchString(field) {
+			break
+		}
+
+		word := strings.Trim(field, "*,.;:-")
+		if word == "" {
+			continue
+		}
+		first, size := utf8.DecodeRuneInString(word)
+		words = append(words, string(unicode.ToUpper(first))+strings.ToLower(word[size:]))
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,84 @@
+package financial
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/testutil"
+)
+
+func TestNormalizeMerchant(t *testing.T) {
+	tests := []struct {
+		description string
+		want        string
+	}{
+		{description: "STARBUCKS #1234 NY", want: "Starbucks"},
+		{description: "AMAZON.COM*MK1AB2 SEATTLE", want: "Amazon.com*mk1ab2 Seattle"},
+		{description: "SQ *BLUE BOTTLE 03/14 OAKLAND", want: "Sq Blue Bottle"},
+		{description: "  whole   foods  ", want: "Whole Foods"},
+		{description: "ÉPICERIE ZÜRICH 4411", want: "Épicerie Zürich"},
+		{description: "ŻABKA Z1234 WARSZAWA", want: "Żabka Z1234 Warszawa"},
+		{description: "ñandú 2024-01-31", want: "Ñandú"},
+		{description: "#1234", want: ""},
+		{description: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			if got := normalizeMerchant(tt.description); got != tt.want {
+				t.Errorf("normalizeMerchant(%q) = %q, want %q", tt.description, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMerchantFilter checks that a merchant extracted on create is found by
+// the case-insensitive merchant filter. Needs TEST_DATABASE_URL.
+func TestMerchantFilter(t *testing.T) {
+	repo := NewRepository(testutil.DB(t))
+	ctx := context.Background()
+	userID := uuid.New()
+	now := time.Now()
+
+	for _, description := range []string{"STARBUCKS #1234 NY", "ÉPICERIE ZÜRICH 4411", "SHELL 0042"} {
+		transaction := &Transaction{
+			ID:          uuid.New(),
+			UserID:      userID,
+			Date:        time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+			Amount:      500,
+			Currency:    defaultCurrency,
+			Type:        TransactionTypeSpending,
+			Description: description,
+			Merchant:    normalizeMerchant(description),
+			Tags:        []string{},
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if err := repo.Create(ctx, transaction); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	tests := []struct {
+		merchant string
+		want     string
+	}{
+		{merchant: "starbucks", want: "STARBUCKS #1234 NY"},
+		{merchant: "Starbucks", want: "STARBUCKS #1234 NY"},
+		{merchant: "Épicerie Zürich", want: "ÉPICERIE ZÜRICH 4411"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.merchant, func(t *testing.T) {
+			transactions, err := repo.List(ctx, userID, ListFilter{Merchant: tt.merchant}, ListSort{Field: "date"}, 10, 0)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(transactions) != 1 || transactions[0].Description != tt.want {
+				t.Fatalf("merchant %q matched %d transactions, want only %q", tt.merchant, len(transactions), tt.want)
+			}
+		})
+	}
+}
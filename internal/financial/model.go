@@ -1,11 +1,37 @@
 package financial
 
 import (
+	"encoding/json"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// dateLayout is the YYYY-MM-DD format used for transaction dates in requests.
+const dateLayout = "2006-01-02"
+
+// maxNotesLength is the most characters a transaction's notes may hold.
+const maxNotesLength = 2000
+
+// defaultCurrency is applied when a create request omits the currency.
+const defaultCurrency = "USD"
+
+// supportedCurrencies is the ISO 4217 allowlist accepted on transactions.
+var supportedCurrencies = map[string]bool{
+	"USD": true,
+	"EUR": true,
+	"GBP": true,
+	"JPY": true,
+	"CAD": true,
+	"AUD": true,
+	"CHF": true,
+	"CNY": true,
+	"INR": true,
+	"MXN": true,
+}
+
 type TransactionType string
 
 const (
@@ -14,25 +40,156 @@ const (
 )
 
 type Transaction struct {
-	ID          uuid.UUID       `json:"id"`
-	Date        time.Time       `json:"date"`
-	Amount      float64         `json:"amount"`
-	Type        TransactionType `json:"type"`
-	Description string          `json:"description"`
-	ImageURL    string          `json:"image_url,omitempty"`  // Generated dynamically
-	ImageKey    string          `json:"image_key,omitempty"`
-	UploadID    string          `json:"upload_id,omitempty"`
-	CreatedAt   time.Time       `json:"created_at"`
-	UpdatedAt   time.Time       `json:"updated_at"`
+	ID             uuid.UUID       `json:"id"`
+	UserID         uuid.UUID       `json:"-"`
+	Date           time.Time       `json:"date"`
+	Amount         Money           `json:"amount"`
+	Currency       string          `json:"currency"`
+	Type           TransactionType `json:"type"`
+	Category       string          `json:"category"`
+	Description    string          `json:"description"`
+	Notes          string          `json:"notes,omitempty"` // Only loaded for single transactions
+	Merchant       string          `json:"merchant,omitempty"`
+	Tags           []string        `json:"tags"`
+	ImageURL       string          `json:"image_url,omitempty"` // Generated dynamically
+	ImageKey       string          `json:"image_key,omitempty"`
+	ThumbnailURL   string          `json:"thumbnail_url,omitempty"` // Generated dynamically
+	ThumbnailKey   string          `json:"thumbnail_key,omitempty"`
+	Attachments    []Attachment    `json:"attachments,omitempty"`
+	RunningBalance *Money          `json:"running_balance,omitempty"` // Only set when requested
+	UploadID       string          `json:"upload_id,omitempty"`
+	ReversesID     *uuid.UUID      `json:"reverses_id,omitempty"` // Set on a reversal
+	IdempotencyKey string          `json:"-"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	DeletedAt      *time.Time      `json:"deleted_at,omitempty"`
+}
+
+// Attachment is one receipt image of a transaction. ImageKey and ThumbnailKey
+// on the transaction mirror its first attachment by position.
+type Attachment struct {
+	ID            uuid.UUID `json:"id"`
+	TransactionID uuid.UUID `json:"-"`
+	Key           string    `json:"key"`
+	ThumbnailKey  string    `json:"thumbnail_key,omitempty"`
+	ContentType   string    `json:"content_type"`
+	Position      int       `json:"position"`
+	URL           string    `json:"url,omitempty"`           // Generated dynamically
+	ThumbnailURL  string    `json:"thumbnail_url,omitempty"` // Generated dynamically
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type AddAttachmentRequest struct {
+	UploadID string `json:"upload_id" binding:"required"`
 }
 
 type CreateTransactionRequest struct {
 	Date        string          `json:"date" binding:"required"`
-	Amount      float64         `json:"amount" binding:"required,gt=0"`
+	Amount      Money           `json:"amount" binding:"required,gt=0"`
+	Currency    string          `json:"currency"`
 	Type        TransactionType `json:"type" binding:"required,oneof=spending earning"`
+	Category    string          `json:"category"`
 	Description string          `json:"description"`
-	UploadID    string          `json:"upload_id,omitempty"`     // For presigned URL flow
-	ImageBase64 string          `json:"image_base64,omitempty"`  // Deprecated but kept for compatibility
+	Notes       string          `json:"notes,omitempty"`
+	Tags        []string        `json:"tags,omitempty"`
+	UploadID    string          `json:"upload_id,omitempty"`    // For presigned URL flow
+	ImageBase64 string          `json:"image_base64,omitempty"` // Deprecated but kept for compatibility
+
+	// IdempotencyKey comes from the Idempotency-Key header, not the body
+	IdempotencyKey string `json:"-"`
+	// AllowDuplicate comes from the allow_duplicate query parameter
+	AllowDuplicate bool `json:"-"`
+}
+
+// PatchTransactionRequest changes only the fields present in the body. A nil
+// field was absent. Category, description, notes and tags may also be sent as
+// null to clear them; the other fields cannot be null.
+type PatchTransactionRequest struct {
+	Date        *string          `json:"date"`
+	Amount      *Money           `json:"amount"`
+	Currency    *string          `json:"currency"`
+	Type        *TransactionType `json:"type"`
+	Category    *string          `json:"category"`
+	Description *string          `json:"description"`
+	Notes       *string          `json:"notes"`
+	Tags        *[]string        `json:"tags"`
+
+	// nulls holds the fields sent as an explicit null
+	nulls map[string]bool
+}
+
+func (r *PatchTransactionRequest) UnmarshalJSON(data []byte) error {
+	type fields PatchTransactionRequest
+	if err := json.Unmarshal(data, (*fields)(r)); err != nil {
+		return err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	r.nulls = make(map[string]bool)
+	for name, value := range raw {
+		if string(value) == "null" {
+			r.nulls[strings.ToLower(name)] = true
+		}
+	}
+	return nil
+}
+
+// TransactionPatch holds the validated columns of a partial update. Nil fields
+// are left unchanged.
+type TransactionPatch struct {
+	Date        *time.Time
+	Amount      *Money
+	Currency    *string
+	Type        *TransactionType
+	Category    *string
+	Description *string
+	Merchant    *string
+	Notes       *string
+	Tags        *[]string
+}
+
+// ListFilter narrows the transactions returned by List and Count. Zero-value
+// fields are not applied.
+type ListFilter struct {
+	Type      TransactionType
+	Category  string
+	Merchant  string
+	Search    string // case-insensitive substring of the description
+	Tag       string // lowercase tag the transaction must carry
+	StartDate time.Time
+	EndDate   time.Time
+	// Currency limits the rows to one currency; only the forecast sets it
+	Currency string
+	// IncludeDeleted lists soft-deleted transactions too; only admins may
+	// set it
+	IncludeDeleted bool
+}
+
+// ListSort orders List results. Field is one of date, amount or created_at;
+// the zero value sorts newest first by date.
+type ListSort struct {
+	Field     string
+	Ascending bool
+}
+
+// ImageURLResponse is a freshly presigned URL for a transaction's image.
+type ImageURLResponse struct {
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// ImageContent is a transaction's image streamed from storage. The caller
+// must close Body. Size is -1 when unknown. RedirectURL, when set, stands in
+// for a missing image and there is no Body.
+type ImageContent struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64
+	RedirectURL string
 }
 
 type ListTransactionsResponse struct {
@@ -40,12 +197,258 @@ type ListTransactionsResponse struct {
 	Total        int64          `json:"total"`
 	Limit        int            `json:"limit"`
 	Offset       int            `json:"offset"`
+	HasMore      bool           `json:"has_more"`
+	NextOffset   int            `json:"next_offset"`
+	Totals       []ListTotal    `json:"totals,omitempty"`
+}
+
+// CursorPageResponse is a page of transactions in cursor mode. NextCursor is
+// empty on the last page.
+type CursorPageResponse struct {
+	Transactions []*Transaction `json:"transactions"`
+	Limit        int            `json:"limit"`
+	HasMore      bool           `json:"has_more"`
+	NextCursor   string         `json:"next_cursor,omitempty"`
+	Totals       []ListTotal    `json:"totals,omitempty"`
+}
+
+// ListTotal sums every transaction matching a list filter in one currency,
+// not only those on the current page.
+type ListTotal struct {
+	Currency string `json:"currency"`
+	Income   Money  `json:"income"`
+	Spending Money  `json:"spending"`
+	Net      Money  `json:"net"`
 }
 
 type AggregatedData struct {
-	Month    string  `json:"month"`
-	Income   float64 `json:"income"`
-	Spending float64 `json:"spending"`
-	NetTotal float64 `json:"net_total"`
+	Month      string           `json:"month,omitempty"`
+	Week       string           `json:"week,omitempty"`
+	StartDate  string           `json:"start_date,omitempty"`
+	EndDate    string           `json:"end_date,omitempty"`
+	Currency   string           `json:"currency,omitempty"`
+	Income     Money            `json:"income"`
+	Spending   Money            `json:"spending"`
+	NetTotal   Money            `json:"net_total"`
+	Count      int64            `json:"count"`
+	ByCategory map[string]Money `json:"by_category,omitempty"`
+
+	// Budgets compares spending with the budget of each budgeted category.
+	// Only monthly aggregates include it.
+	Budgets map[string]CategoryBudget `json:"budgets,omitempty"`
+}
+
+type CategoryBudget struct {
+	Spent      Money `json:"spent"`
+	Budget     Money `json:"budget"`
+	Remaining  Money `json:"remaining"`
+	OverBudget bool  `json:"over_budget"`
+}
+
+// AggregateDelta is the change in one figure between two periods.
+// PercentChange is relative to the magnitude of the earlier value and is null
+// when that value is zero.
+type AggregateDelta struct {
+	Change        Money    `json:"change"`
+	PercentChange *float64 `json:"percent_change"`
+}
+
+type MonthComparison struct {
+	From     AggregatedData `json:"from"`
+	To       AggregatedData `json:"to"`
+	Currency string         `json:"currency,omitempty"`
+	Income   AggregateDelta `json:"income"`
+	Spending AggregateDelta `json:"spending"`
+	NetTotal AggregateDelta `json:"net_total"`
+}
+
+// AggregateTotal is the summed amount and row count of one currency and type,
+// and of one category when the query groups by category.
+type AggregateTotal struct {
+	Currency string
+	Type     TransactionType
+	Category string
+	Total    Money
+	Count    int64
 }
 
+// LifetimeTotal sums all of a user's transactions of one currency and type.
+type LifetimeTotal struct {
+	Currency  string
+	Type      TransactionType
+	Total     Money
+	Count     int64
+	FirstDate time.Time
+	LastDate  time.Time
+}
+
+// LifetimeAggregate summarizes every transaction a user has in one currency.
+// The dates are omitted when there are none.
+type LifetimeAggregate struct {
+	Currency  string `json:"currency,omitempty"`
+	Income    Money  `json:"income"`
+	Spending  Money  `json:"spending"`
+	NetTotal  Money  `json:"net_total"`
+	Count     int64  `json:"count"`
+	FirstDate string `json:"first_date,omitempty"`
+	LastDate  string `json:"last_date,omitempty"`
+}
+
+type YearlyAggregatedData struct {
+	Year     int              `json:"year"`
+	Currency string           `json:"currency,omitempty"`
+	Income   Money            `json:"income"`
+	Spending Money            `json:"spending"`
+	NetTotal Money            `json:"net_total"`
+	Count    int64            `json:"count"`
+	Months   []AggregatedData `json:"months"`
+}
+
+// FieldMapping tells the JSON importer which keys of each source object hold
+// the transaction fields. Empty entries fall back to the field's own name.
+type FieldMapping struct {
+	Amount      string `json:"amount"`
+	Currency    string `json:"currency"`
+	Date        string `json:"date"`
+	Type        string `json:"type"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+}
+
+// ImportJSONRequest is read by decodeImportJSON rather than gin binding, so
+// the size of Transactions can be checked while it is decoded.
+type ImportJSONRequest struct {
+	Mapping      FieldMapping     `json:"mapping"`
+	Transactions []map[string]any `json:"transactions"`
+}
+
+type ImportError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+	// ExistingID is set when the entry duplicates an existing transaction
+	ExistingID string `json:"existing_id,omitempty"`
+}
+
+// ImportOptions are the query parameters shared by the import endpoints.
+type ImportOptions struct {
+	// DryRun validates the entries without saving them
+	DryRun bool
+	// AllowDuplicates imports entries that match existing transactions
+	AllowDuplicates bool
+}
+
+type ImportSummary struct {
+	Total    int `json:"total"`
+	Imported int `json:"imported"`
+	// Skipped counts entries that are valid but carry nothing to import,
+	// such as zero-amount lines in a bank statement
+	Skipped int           `json:"skipped"`
+	Failed  int           `json:"failed"`
+	DryRun  bool          `json:"dry_run"`
+	Errors  []ImportError `json:"errors"`
+}
+
+// DailySum holds one currency's income and spending totals for a single
+// calendar day.
+type DailySum struct {
+	Date     time.Time
+	Currency string
+	Income   Money
+	Spending Money
+}
+
+// DailyTotal holds one currency's income and spending for a single day.
+type DailyTotal struct {
+	Date     time.Time
+	Currency string
+	Income   Money
+	Spending Money
+}
+
+type DailyAggregate struct {
+	Date     string `json:"date"`
+	Income   Money  `json:"income"`
+	Spending Money  `json:"spending"`
+	Net      Money  `json:"net"`
+}
+
+type DailyAggregates struct {
+	Month    string           `json:"month"`
+	Currency string           `json:"currency,omitempty"`
+	Days     []DailyAggregate `json:"days"`
+}
+
+type RollingTotal struct {
+	Date  string `json:"date"`
+	Total Money  `json:"total"`
+}
+
+type RollingSpending struct {
+	Window   int            `json:"window"`
+	Currency string         `json:"currency,omitempty"`
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	Totals   []RollingTotal `json:"totals"`
+}
+
+// CadenceStats describes the gaps, in days, between consecutive transactions.
+// The gap fields are null when fewer than two transactions fall in the period.
+type CadenceStats struct {
+	From           string   `json:"from"`
+	To             string   `json:"to"`
+	Count          int      `json:"count"`
+	AverageGapDays *float64 `json:"average_gap_days"`
+	MinGapDays     *int     `json:"min_gap_days"`
+	MaxGapDays     *int     `json:"max_gap_days"`
+}
+
+// CategoryCostRate is a category's spending over a period spread evenly over
+// its days, so a 120.00 yearly subscription costs 0.33 a day. Rates are
+// rounded to the cent.
+type CategoryCostRate struct {
+	Category string `json:"category"`
+	Currency string `json:"currency"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Days     int    `json:"days"`
+	Total    Money  `json:"total"`
+	PerDay   Money  `json:"per_day"`
+	PerMonth Money  `json:"per_month"`
+}
+
+// NetWorthForecast projects the balance of one currency to the end of the
+// current month and each month after it, up to HorizonMonths months. Each
+// month adds the future-dated transactions up to its end to the balance as of
+// today.
+type NetWorthForecast struct {
+	Currency      string          `json:"currency"`
+	AsOf          string          `json:"as_of"`
+	Balance       Money           `json:"balance"`
+	HorizonMonths int             `json:"horizon_months"`
+	Months        []MonthForecast `json:"months"`
+}
+
+// MonthForecast is the balance projected for the last day of Month.
+type MonthForecast struct {
+	Month   string `json:"month"` // YYYY-MM
+	Balance Money  `json:"balance"`
+}
+
+type MerchantCount struct {
+	Merchant string `json:"merchant"`
+	Count    int64  `json:"count"`
+}
+
+// CategorySummary is a category's spending total and transaction count, of
+// both types, in one currency.
+type CategorySummary struct {
+	Category string `json:"category"`
+	Currency string `json:"currency"`
+	Spending Money  `json:"spending"`
+	Count    int64  `json:"count"`
+}
+
+type CategoryList struct {
+	Month      string            `json:"month,omitempty"`
+	Categories []CategorySummary `json:"categories"`
+}
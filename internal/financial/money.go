@@ -0,0 +1,92 @@
+package financial
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/kranti/cashflow/internal/apperror"
+)
+
+// maxAmount bounds amounts well inside the range of Money.
+const maxAmount = 1e13
+
+// Money is an amount in cents. Sums of Money are exact, unlike sums of float64
+// amounts. In JSON it is written as a number with two decimals and read from
+// either a number or a decimal string, as amounts always have been.
+type Money int64
+
+// MoneyFromFloat converts a decimal amount to cents, rounding half away from
+// zero. Amounts from clients go through AmountFromFloat instead.
+func MoneyFromFloat(amount float64) Money {
+	return Money(math.Round(amount * 100))
+}
+
+// AmountFromFloat converts a client-supplied amount to cents. NaN, infinities,
+// amounts of maxAmount or more and amounts with more than two decimal places
+// are rejected rather than rounded.
+func AmountFromFloat(amount float64) (Money, error) {
+	if math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return 0, apperror.Invalid(apperror.CodeInvalidAmount, "amount must be a finite number")
+	}
+	if math.Abs(amount) >= maxAmount {
+		return 0, apperror.Invalid(apperror.CodeInvalidAmount, "amount must be less than %.0f", float64(maxAmount))
+	}
+
+	// Decimal amounts are rarely exact in binary, so allow for float error
+	cents := amount * 100
+	if math.Abs(cents-math.Round(cents)) > 1e-6 {
+		return 0, apperror.Invalid(apperror.CodeInvalidAmount, "amount must have at most 2 decimal places")
+	}
+
+	return Money(math.Round(cents)), nil
+}
+
+// ParseMoney parses a client-supplied decimal amount such as "12.34".
+func ParseMoney(s string) (Money, error) {
+	amount, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, apperror.Invalid(apperror.CodeInvalidAmount, "invalid amount %q", s)
+	}
+	return AmountFromFloat(amount)
+}
+
+// Float64 returns the amount in whole units, for ratios and other figures
+// that are not themselves money.
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// String formats the amount with exactly two decimals.
+func (m Money) String() string {
+	cents := int64(m)
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	text := string(data)
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+
+	amount, err := ParseMoney(text)
+	if err != nil {
+		return err
+	}
+	*m = amount
+	return nil
+}
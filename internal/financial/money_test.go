@@ -0,0 +1,194 @@
+package financial
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/kranti/cashflow/internal/apperror"
+)
+
+// wantInvalidAmount fails the test unless err is an INVALID_AMOUNT error.
+func wantInvalidAmount(t *testing.T, err error) {
+	t.Helper()
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) || appErr.Code != apperror.CodeInvalidAmount {
+		t.Errorf("err = %v, want %s", err, apperror.CodeInvalidAmount)
+	}
+}
+
+func TestAmountFromFloat(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  float64
+		want    Money
+		wantErr bool
+	}{
+		{name: "whole amount", amount: 12, want: 1200},
+		{name: "two decimals", amount: 12.34, want: 1234},
+		{name: "float sum", amount: 0.1 + 0.2, want: 30},
+		{name: "negative", amount: -12.34, want: -1234},
+		{name: "just under the limit", amount: 9999999999999.99, want: 999999999999999},
+		{name: "three decimals", amount: 1.005, wantErr: true},
+		{name: "at the limit", amount: 1e13, wantErr: true},
+		{name: "negative at the limit", amount: -1e13, wantErr: true},
+		{name: "NaN", amount: math.NaN(), wantErr: true},
+		{name: "Inf", amount: math.Inf(1), wantErr: true},
+		{name: "-Inf", amount: math.Inf(-1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AmountFromFloat(tt.amount)
+			if tt.wantErr {
+				wantInvalidAmount(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("AmountFromFloat(%v): %v", tt.amount, err)
+			}
+			if got != tt.want {
+				t.Errorf("AmountFromFloat(%v) = %d, want %d", tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Money
+		wantErr bool
+	}{
+		{input: "12.34", want: 1234},
+		{input: "12", want: 1200},
+		{input: "0.30", want: 30},
+		{input: "-0.05", want: -5},
+		{input: "12.345", wantErr: true},
+		{input: "1.005", wantErr: true},
+		{input: "NaN", wantErr: true},
+		{input: "Inf", wantErr: true},
+		{input: "-Inf", wantErr: true},
+		{input: "1e13", wantErr: true},
+		{input: "twelve", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseMoney(tt.input)
+			if tt.wantErr {
+				wantInvalidAmount(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMoney(%q): %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    Money
+		wantErr bool
+	}{
+		{name: "number", json: `12.34`, want: 1234},
+		{name: "string", json: `"12.34"`, want: 1234},
+		{name: "negative number", json: `-7.5`, want: -750},
+		{name: "negative string", json: `"-7.50"`, want: -750},
+		{name: "null leaves zero", json: `null`, want: 0},
+		{name: "too many decimals as number", json: `12.345`, wantErr: true},
+		{name: "too many decimals as string", json: `"12.345"`, wantErr: true},
+		{name: "NaN string", json: `"NaN"`, wantErr: true},
+		{name: "Inf string", json: `"Inf"`, wantErr: true},
+		{name: "too large", json: `1e13`, wantErr: true},
+		{name: "not a number", json: `"abc"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body struct {
+				Amount Money `json:"amount"`
+			}
+			err := json.Unmarshal([]byte(`{"amount":`+tt.json+`}`), &body)
+			if tt.wantErr {
+				wantInvalidAmount(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal(%s): %v", tt.json, err)
+			}
+			if body.Amount != tt.want {
+				t.Errorf("Unmarshal(%s) = %d, want %d", tt.json, body.Amount, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		cents Money
+		want  string
+	}{
+		{cents: 0, want: "0.00"},
+		{cents: 5, want: "0.05"},
+		{cents: -5, want: "-0.05"},
+		{cents: -99, want: "-0.99"},
+		{cents: 1234, want: "12.34"},
+		{cents: -1234, want: "-12.34"},
+		{cents: 100000, want: "1000.00"},
+		{cents: 999999999999999, want: "9999999999999.99"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.cents.String(); got != tt.want {
+				t.Errorf("Money(%d).String() = %q, want %q", int64(tt.cents), got, tt.want)
+			}
+
+			data, err := json.Marshal(tt.cents)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Marshal = %s, want %s", data, tt.want)
+			}
+
+			var back Money
+			if err := json.Unmarshal(data, &back); err != nil {
+				t.Fatalf("Unmarshal(%s): %v", data, err)
+			}
+			if back != tt.cents {
+				t.Errorf("round trip of %d gave %d", int64(tt.cents), int64(back))
+			}
+		})
+	}
+}
+
+func TestMoneySumIsExact(t *testing.T) {
+	// Ten thousand 0.10 amounts drift when summed as float64
+	var floatSum float64
+	var sum Money
+	for range 10000 {
+		floatSum += 0.1
+		amount, err := ParseMoney("0.10")
+		if err != nil {
+			t.Fatalf("ParseMoney: %v", err)
+		}
+		sum += amount
+	}
+
+	if floatSum == 1000 {
+		t.Fatalf("float64 sum is exact, so the test shows nothing")
+	}
+	if sum != 100000 || sum.String() != "1000.00" {
+		t.Errorf("sum = %s (%d cents), want 1000.00", sum, int64(sum))
+	}
+}
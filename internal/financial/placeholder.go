@@ -0,0 +1,11 @@
+package financial
+
+import _ "embed"
+
+// placeholderImage is the bundled image GetImage serves for a receipt gone
+// from storage when MissingImage is MissingImagePlaceholder.
+//
+//go:embed placeholder.png
+var placeholderImage []byte
+
+const placeholderContentType = "image/png"
@@ -3,20 +3,95 @@ package financial
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
+	"github.com/lib/pq"
 )
 
 type Repository interface {
 	Create(ctx context.Context, transaction *Transaction) error
-	List(ctx context.Context, limit, offset int) ([]*Transaction, error)
-	Count(ctx context.Context) (int64, error)
-	GetByMonth(ctx context.Context, year int, month int) ([]*Transaction, error)
-	GetByID(ctx context.Context, id uuid.UUID) (*Transaction, error)
-	Delete(ctx context.Context, id uuid.UUID) error
+	CreateBatch(ctx context.Context, transactions []*Transaction) error
+	FindDuplicates(ctx context.Context, userID uuid.UUID, transactions []*Transaction, windowDays int) (map[int]uuid.UUID, error)
+	List(ctx context.Context, userID uuid.UUID, filter ListFilter, sort ListSort, limit, offset int) ([]*Transaction, error)
+	ListWithBalance(ctx context.Context, userID uuid.UUID, filter ListFilter, sort ListSort, limit, offset int) ([]*Transaction, error)
+	ListAfter(ctx context.Context, userID uuid.UUID, filter ListFilter, cursor *Cursor, limit int) ([]*Transaction, error)
+	Update(ctx context.Context, userID uuid.UUID, id uuid.UUID, patch TransactionPatch) (*Transaction, error)
+	Count(ctx context.Context, userID uuid.UUID, filter ListFilter) (int64, error)
+	SumByCurrency(ctx context.Context, userID uuid.UUID, filter ListFilter) ([]ListTotal, error)
+	Stream(ctx context.Context, userID uuid.UUID, filter ListFilter, fn func(*Transaction) error) error
+	GetByMonth(ctx context.Context, userID uuid.UUID, year int, month int) ([]*Transaction, error)
+	GetByYear(ctx context.Context, userID uuid.UUID, year int) ([]*Transaction, error)
+	GetByWeek(ctx context.Context, userID uuid.UUID, year int, week int) ([]*Transaction, error)
+	SumByDay(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]DailySum, error)
+	ListDates(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]time.Time, error)
+	CountByMerchant(ctx context.Context, userID uuid.UUID) ([]MerchantCount, error)
+	SumByCategory(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]CategorySummary, error)
+	AggregateByRange(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]AggregateTotal, error)
+	AggregateByMonth(ctx context.Context, userID uuid.UUID, year int, month int) ([]AggregateTotal, error)
+	AggregateByDay(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]DailyTotal, error)
+	AggregateLifetime(ctx context.Context, userID uuid.UUID) ([]LifetimeTotal, error)
+	GetByID(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*Transaction, error)
+	GetByIdempotencyKey(ctx context.Context, userID uuid.UUID, key string, since time.Time) (*Transaction, error)
+	ReleaseIdempotencyKey(ctx context.Context, userID uuid.UUID, key string, before time.Time) error
+	Delete(ctx context.Context, userID uuid.UUID, id uuid.UUID) (time.Time, error)
+	Restore(ctx context.Context, userID uuid.UUID, id uuid.UUID) error
+	AddAttachment(ctx context.Context, userID uuid.UUID, attachment *Attachment) error
+	DeleteAttachment(ctx context.Context, userID uuid.UUID, transactionID uuid.UUID, attachmentID uuid.UUID) (*Attachment, error)
+	ListAttachments(ctx context.Context, transactionIDs []uuid.UUID) (map[uuid.UUID][]Attachment, error)
 }
 
+// ErrTransactionNotFound is returned when no transaction matches the given ID.
+var ErrTransactionNotFound = apperror.New(404, apperror.CodeTransactionNotFound, "transaction not found")
+
+// ErrAlreadyReversed is returned when a transaction already has a reversal
+// that isn't deleted.
+var ErrAlreadyReversed = apperror.New(409, apperror.CodeAlreadyReversed, "transaction has already been reversed")
+
+// ErrIdempotencyKeyTaken is returned when another transaction claimed the
+// idempotency key between the lookup and the insert.
+var ErrIdempotencyKeyTaken = errors.New("idempotency key already used")
+
+// ErrAttachmentNotFound is returned when a transaction has no attachment with
+// the given ID.
+var ErrAttachmentNotFound = apperror.New(404, apperror.CodeAttachmentNotFound, "attachment not found")
+
+const insertTransactionQuery = `
+	INSERT INTO transactions (
+		id, user_id, date, amount_cents, currency, type, category, description, merchant, tags,
+		image_key, thumbnail_key, upload_id, idempotency_key, created_at, updated_at, notes, reverses_id
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, NULLIF($12, ''), $13, NULLIF($14, ''), $15, $16, $17, $18)
+`
+
+const insertAttachmentQuery = `
+	INSERT INTO transaction_attachments (id, transaction_id, s3_key, thumbnail_key, content_type, position)
+	VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)
+	RETURNING created_at
+`
+
+// syncPrimaryImageQuery mirrors the first attachment into the legacy
+// image_key and thumbnail_key columns.
+const syncPrimaryImageQuery = `
+	UPDATE transactions t SET
+		image_key = (SELECT s3_key FROM transaction_attachments WHERE transaction_id = t.id ORDER BY position LIMIT 1),
+		thumbnail_key = (SELECT thumbnail_key FROM transaction_attachments WHERE transaction_id = t.id ORDER BY position LIMIT 1),
+		updated_at = NOW()
+	WHERE t.id = $1
+`
+
+const attachmentColumns = `id, transaction_id, s3_key, COALESCE(thumbnail_key, ''), content_type, position, created_at`
+
+const transactionColumns = `id, date, amount_cents, currency, type, category, description, COALESCE(merchant, ''), tags,
+	COALESCE(image_key, ''), COALESCE(thumbnail_key, ''), COALESCE(upload_id, ''), created_at, updated_at, deleted_at, reverses_id`
+
+// detailColumns adds the columns that are only read for a single transaction,
+// keeping list queries and payloads small.
+const detailColumns = transactionColumns + `, notes`
+
 type repository struct {
 	db *sql.DB
 }
@@ -25,62 +100,177 @@ func NewRepository(db *sql.DB) *repository {
 	return &repository{db: db}
 }
 
+// Create inserts a transaction together with its attachments.
 func (r *repository) Create(ctx context.Context, transaction *Transaction) error {
-	query := `
-		INSERT INTO transactions (id, date, amount, type, description, image_key, upload_id, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction insert: %w", err)
+	}
+	defer tx.Rollback()
 
-	_, err := r.db.ExecContext(ctx, query,
-		transaction.ID,
-		transaction.Date,
-		transaction.Amount,
-		transaction.Type,
-		transaction.Description,
-		transaction.ImageKey,
-		transaction.UploadID,
-		transaction.CreatedAt,
-		transaction.UpdatedAt,
-	)
+	if _, err := tx.ExecContext(ctx, insertTransactionQuery, insertArgs(transaction)...); err != nil {
+		if isReversalConflict(err) {
+			return ErrAlreadyReversed
+		}
+		if isIdempotencyConflict(err) {
+			return ErrIdempotencyKeyTaken
+		}
+		return fmt.Errorf("creating transaction: %w", err)
+	}
 
+	for i := range transaction.Attachments {
+		if err := insertAttachment(ctx, tx, &transaction.Attachments[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction insert: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) CreateBatch(ctx context.Context, transactions []*Transaction) error {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("creating transaction: %w", err)
+		return fmt.Errorf("beginning batch insert: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, insertTransactionQuery)
+	if err != nil {
+		return fmt.Errorf("preparing batch insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, transaction := range transactions {
+		if _, err := stmt.ExecContext(ctx, insertArgs(transaction)...); err != nil {
+			return fmt.Errorf("inserting transaction %s: %w", transaction.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing batch insert: %w", err)
 	}
 
 	return nil
 }
 
-func (r *repository) List(ctx context.Context, limit, offset int) ([]*Transaction, error) {
+// FindDuplicates looks for an existing transaction matching each of
+// transactions on amount, currency, type and description, dated at most
+// windowDays days either side of it. It returns the ID of the closest match by
+// date for each index that has one.
+func (r *repository) FindDuplicates(ctx context.Context, userID uuid.UUID, transactions []*Transaction, windowDays int) (map[int]uuid.UUID, error) {
+	duplicates := make(map[int]uuid.UUID)
+	if len(transactions) == 0 {
+		return duplicates, nil
+	}
+
+	dates := make([]string, len(transactions))
+	amounts := make([]int64, len(transactions))
+	currencies := make([]string, len(transactions))
+	types := make([]string, len(transactions))
+	descriptions := make([]string, len(transactions))
+	for i, t := range transactions {
+		dates[i] = t.Date.Format(dateLayout)
+		amounts[i] = int64(t.Amount)
+		currencies[i] = t.Currency
+		types[i] = string(t.Type)
+		descriptions[i] = t.Description
+	}
+
 	query := `
-		SELECT id, date, amount, type, description, COALESCE(image_key, ''), COALESCE(upload_id, ''), created_at, updated_at
-		FROM transactions
-		ORDER BY date DESC, created_at DESC
-		LIMIT $1 OFFSET $2
+		SELECT DISTINCT ON (c.idx) c.idx, t.id
+		FROM unnest($2::date[], $3::bigint[], $4::text[], $5::text[], $6::text[])
+			WITH ORDINALITY AS c(date, amount_cents, currency, type, description, idx)
+		JOIN transactions t
+			ON t.user_id = $1
+			AND t.deleted_at IS NULL
+			AND t.amount_cents = c.amount_cents
+			AND t.currency = c.currency
+			AND t.type = c.type
+			AND COALESCE(t.description, '') = c.description
+			AND t.date BETWEEN c.date - $7::int AND c.date + $7::int
+		ORDER BY c.idx, ABS(t.date - c.date), t.created_at DESC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, userID, pq.Array(dates), pq.Array(amounts),
+		pq.Array(currencies), pq.Array(types), pq.Array(descriptions), windowDays)
+	if err != nil {
+		return nil, fmt.Errorf("finding duplicate transactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var idx int
+		var id uuid.UUID
+		if err := rows.Scan(&idx, &id); err != nil {
+			return nil, fmt.Errorf("scanning duplicate transaction: %w", err)
+		}
+		// ORDINALITY counts from 1
+		duplicates[idx-1] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating duplicate transactions: %w", err)
+	}
+
+	return duplicates, nil
+}
+
+func (r *repository) List(ctx context.Context, userID uuid.UUID, filter ListFilter, sort ListSort, limit, offset int) ([]*Transaction, error) {
+	where, args := listConditions(userID, filter)
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM transactions
+		%s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, transactionColumns, where, orderBy(sort), len(args)+1, len(args)+2)
+
+	args = append(args, limit, offset)
+	transactions, err := r.queryTransactions(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("listing transactions: %w", err)
 	}
+
+	return transactions, nil
+}
+
+// ListWithBalance is List with RunningBalance set on each transaction: the
+// net of all the user's transactions in its currency up to and including it,
+// in date and creation order. The balance covers the whole ledger, so filters
+// narrow the rows returned but not the rows summed.
+func (r *repository) ListWithBalance(ctx context.Context, userID uuid.UUID, filter ListFilter, sort ListSort, limit, offset int) ([]*Transaction, error) {
+	where, args := listConditions(userID, filter)
+	query := fmt.Sprintf(`
+		SELECT %s, running_balance
+		FROM (
+			SELECT *, SUM(CASE WHEN type = '%s' THEN amount_cents ELSE -amount_cents END)
+				OVER (PARTITION BY currency ORDER BY date, created_at, id) AS running_balance
+			FROM transactions
+			WHERE user_id = $1 AND deleted_at IS NULL
+		) ledger
+		%s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, transactionColumns, TransactionTypeEarning, where, orderBy(sort), len(args)+1, len(args)+2)
+
+	args = append(args, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("listing transactions with balance: %w", err)
+	}
 	defer rows.Close()
 
 	var transactions []*Transaction
 	for rows.Next() {
 		var t Transaction
-		err := rows.Scan(
-			&t.ID,
-			&t.Date,
-			&t.Amount,
-			&t.Type,
-			&t.Description,
-			&t.ImageKey,
-			&t.UploadID,
-			&t.CreatedAt,
-			&t.UpdatedAt,
-		)
-		if err != nil {
+		var balance Money
+		if err := rows.Scan(append(transactionFields(&t), &balance)...); err != nil {
 			return nil, fmt.Errorf("scanning transaction: %w", err)
 		}
+		t.RunningBalance = &balance
 		transactions = append(transactions, &t)
 	}
 
@@ -91,41 +281,153 @@ func (r *repository) List(ctx context.Context, limit, offset int) ([]*Transactio
 	return transactions, nil
 }
 
-func (r *repository) GetByID(ctx context.Context, id uuid.UUID) (*Transaction, error) {
-	query := `
-		SELECT id, date, amount, type, description, COALESCE(image_key, ''), COALESCE(upload_id, ''), created_at, updated_at
+// ListAfter returns up to limit transactions ordered by date and ID, both
+// descending, starting after cursor, or from the newest when cursor is nil.
+// Unlike offset pages, deep pages cost the same as the first.
+func (r *repository) ListAfter(ctx context.Context, userID uuid.UUID, filter ListFilter, cursor *Cursor, limit int) ([]*Transaction, error) {
+	where, args := listConditions(userID, filter)
+	if cursor != nil {
+		args = append(args, cursor.Date, cursor.ID)
+		where += fmt.Sprintf(" AND (date, id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM transactions
-		WHERE id = $1
-	`
+		%s
+		ORDER BY date DESC, id DESC
+		LIMIT $%d
+	`, transactionColumns, where, len(args)+1)
 
-	var t Transaction
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&t.ID,
-		&t.Date,
-		&t.Amount,
-		&t.Type,
-		&t.Description,
-		&t.ImageKey,
-		&t.UploadID,
-		&t.CreatedAt,
-		&t.UpdatedAt,
-	)
+	args = append(args, limit)
+	transactions, err := r.queryTransactions(ctx, query, args...)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("transaction not found")
+		return nil, fmt.Errorf("listing transactions after cursor: %w", err)
+	}
+
+	return transactions, nil
+}
+
+func (r *repository) Stream(ctx context.Context, userID uuid.UUID, filter ListFilter, fn func(*Transaction) error) error {
+	where, args := listConditions(userID, filter)
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM transactions
+		%s
+		ORDER BY date DESC, created_at DESC
+	`, transactionColumns, where)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("streaming transactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return fmt.Errorf("scanning transaction: %w", err)
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating transactions: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetByID(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*Transaction, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM transactions
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`, detailColumns)
+
+	t, err := scanTransactionDetail(r.db.QueryRowContext(ctx, query, id, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTransactionNotFound
 		}
 		return nil, fmt.Errorf("getting transaction by id: %w", err)
 	}
 
-	return &t, nil
+	return t, nil
+}
+
+// GetByIdempotencyKey returns the transaction created with key at or after
+// since. Older uses of the key are treated as expired.
+func (r *repository) GetByIdempotencyKey(ctx context.Context, userID uuid.UUID, key string, since time.Time) (*Transaction, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM transactions
+		WHERE user_id = $1 AND idempotency_key = $2 AND created_at >= $3 AND deleted_at IS NULL
+	`, detailColumns)
+
+	t, err := scanTransactionDetail(r.db.QueryRowContext(ctx, query, userID, key, since))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTransactionNotFound
+		}
+		return nil, fmt.Errorf("getting transaction by idempotency key: %w", err)
+	}
+
+	return t, nil
+}
+
+// ReleaseIdempotencyKey frees a key held by a transaction created before the
+// cutoff or since deleted, so it can be reused by a new transaction.
+func (r *repository) ReleaseIdempotencyKey(ctx context.Context, userID uuid.UUID, key string, before time.Time) error {
+	query := `
+		UPDATE transactions
+		SET idempotency_key = NULL
+		WHERE user_id = $1 AND idempotency_key = $2 AND (created_at < $3 OR deleted_at IS NOT NULL)
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, key, before); err != nil {
+		return fmt.Errorf("releasing idempotency key: %w", err)
+	}
+
+	return nil
 }
 
-func (r *repository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM transactions WHERE id = $1`
+func (r *repository) Delete(ctx context.Context, userID uuid.UUID, id uuid.UUID) (time.Time, error) {
+	query := `
+		UPDATE transactions
+		SET deleted_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		RETURNING date
+	`
+
+	var date time.Time
+	err := r.db.QueryRowContext(ctx, query, id, userID).Scan(&date)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, ErrTransactionNotFound
+		}
+		return time.Time{}, fmt.Errorf("deleting transaction: %w", err)
+	}
+
+	return date, nil
+}
+
+// Restore clears deleted_at on a soft-deleted transaction.
+func (r *repository) Restore(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	query := `
+		UPDATE transactions
+		SET deleted_at = NULL
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+	`
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	result, err := r.db.ExecContext(ctx, query, id, userID)
 	if err != nil {
-		return fmt.Errorf("deleting transaction: %w", err)
+		if isReversalConflict(err) {
+			return ErrAlreadyReversed
+		}
+		return fmt.Errorf("restoring transaction: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -134,17 +436,77 @@ func (r *repository) Delete(ctx context.Context, id uuid.UUID) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("transaction not found")
+		return ErrTransactionNotFound
 	}
 
 	return nil
 }
 
-func (r *repository) Count(ctx context.Context) (int64, error) {
-	var count int64
-	query := `SELECT COUNT(*) FROM transactions`
+// Update sets the columns present in patch, and updated_at, on a transaction
+// that isn't deleted and returns the updated row.
+func (r *repository) Update(ctx context.Context, userID uuid.UUID, id uuid.UUID, patch TransactionPatch) (*Transaction, error) {
+	var sets []string
+	var args []any
+	set := func(column string, value any) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if patch.Date != nil {
+		set("date", *patch.Date)
+	}
+	if patch.Amount != nil {
+		set("amount_cents", *patch.Amount)
+	}
+	if patch.Currency != nil {
+		set("currency", *patch.Currency)
+	}
+	if patch.Type != nil {
+		set("type", *patch.Type)
+	}
+	if patch.Category != nil {
+		set("category", *patch.Category)
+	}
+	if patch.Description != nil {
+		set("description", *patch.Description)
+	}
+	if patch.Merchant != nil {
+		args = append(args, *patch.Merchant)
+		sets = append(sets, fmt.Sprintf("merchant = NULLIF($%d, '')", len(args)))
+	}
+	if patch.Notes != nil {
+		set("notes", *patch.Notes)
+	}
+	if patch.Tags != nil {
+		set("tags", pq.Array(*patch.Tags))
+	}
+	sets = append(sets, "updated_at = NOW()")
+
+	args = append(args, id, userID)
+	query := fmt.Sprintf(`
+		UPDATE transactions
+		SET %s
+		WHERE id = $%d AND user_id = $%d AND deleted_at IS NULL
+		RETURNING %s
+	`, strings.Join(sets, ", "), len(args)-1, len(args), detailColumns)
 
-	err := r.db.QueryRowContext(ctx, query).Scan(&count)
+	t, err := scanTransactionDetail(r.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTransactionNotFound
+		}
+		return nil, fmt.Errorf("updating transaction: %w", err)
+	}
+
+	return t, nil
+}
+
+func (r *repository) Count(ctx context.Context, userID uuid.UUID, filter ListFilter) (int64, error) {
+	where, args := listConditions(userID, filter)
+	query := `SELECT COUNT(*) FROM transactions ` + where
+
+	var count int64
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("counting transactions: %w", err)
 	}
@@ -152,38 +514,378 @@ func (r *repository) Count(ctx context.Context) (int64, error) {
 	return count, nil
 }
 
-func (r *repository) GetByMonth(ctx context.Context, year int, month int) ([]*Transaction, error) {
-	query := `
-		SELECT id, date, amount, type, description, COALESCE(image_key, ''), COALESCE(upload_id, ''), created_at, updated_at
+// SumByCurrency totals the income and spending of every transaction matching
+// filter, per currency, ordered by currency.
+func (r *repository) SumByCurrency(ctx context.Context, userID uuid.UUID, filter ListFilter) ([]ListTotal, error) {
+	where, args := listConditions(userID, filter)
+	n := len(args)
+	query := fmt.Sprintf(`
+		SELECT currency,
+			COALESCE(SUM(amount_cents) FILTER (WHERE type = $%d), 0)::BIGINT,
+			COALESCE(SUM(amount_cents) FILTER (WHERE type = $%d), 0)::BIGINT
 		FROM transactions
-		WHERE EXTRACT(YEAR FROM date) = $1 AND EXTRACT(MONTH FROM date) = $2
+		%s
+		GROUP BY currency
+		ORDER BY currency
+	`, n+1, n+2, where)
+	args = append(args, TransactionTypeEarning, TransactionTypeSpending)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("summing transactions by currency: %w", err)
+	}
+	defer rows.Close()
+
+	var totals []ListTotal
+	for rows.Next() {
+		var t ListTotal
+		if err := rows.Scan(&t.Currency, &t.Income, &t.Spending); err != nil {
+			return nil, fmt.Errorf("scanning currency total: %w", err)
+		}
+		t.Net = t.Income - t.Spending
+		totals = append(totals, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating currency totals: %w", err)
+	}
+
+	return totals, nil
+}
+
+func (r *repository) GetByMonth(ctx context.Context, userID uuid.UUID, year int, month int) ([]*Transaction, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM transactions
+		WHERE user_id = $1 AND EXTRACT(YEAR FROM date) = $2 AND EXTRACT(MONTH FROM date) = $3
+		AND deleted_at IS NULL
 		ORDER BY date DESC, created_at DESC
-	`
+	`, transactionColumns)
 
-	rows, err := r.db.QueryContext(ctx, query, year, month)
+	transactions, err := r.queryTransactions(ctx, query, userID, year, month)
 	if err != nil {
 		return nil, fmt.Errorf("getting transactions by month: %w", err)
 	}
+
+	return transactions, nil
+}
+
+func (r *repository) GetByYear(ctx context.Context, userID uuid.UUID, year int) ([]*Transaction, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM transactions
+		WHERE user_id = $1 AND date >= $2 AND date < $3 AND deleted_at IS NULL
+		ORDER BY date DESC, created_at DESC
+	`, transactionColumns)
+
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	transactions, err := r.queryTransactions(ctx, query, userID, start, start.AddDate(1, 0, 0))
+	if err != nil {
+		return nil, fmt.Errorf("getting transactions by year: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// GetByWeek returns transactions in an ISO 8601 week of an ISO week-numbering year.
+func (r *repository) GetByWeek(ctx context.Context, userID uuid.UUID, year int, week int) ([]*Transaction, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM transactions
+		WHERE user_id = $1 AND EXTRACT(ISOYEAR FROM date) = $2 AND EXTRACT(WEEK FROM date) = $3
+		AND deleted_at IS NULL
+		ORDER BY date DESC, created_at DESC
+	`, transactionColumns)
+
+	transactions, err := r.queryTransactions(ctx, query, userID, year, week)
+	if err != nil {
+		return nil, fmt.Errorf("getting transactions by week: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// SumByDay sums the income and spending of each day from start to end
+// inclusive, per currency. Days without transactions are omitted.
+func (r *repository) SumByDay(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]DailySum, error) {
+	query := `
+		SELECT date, currency,
+			COALESCE(SUM(amount_cents) FILTER (WHERE type = $4), 0)::BIGINT,
+			COALESCE(SUM(amount_cents) FILTER (WHERE type = $5), 0)::BIGINT
+		FROM transactions
+		WHERE user_id = $1 AND date >= $2 AND date <= $3 AND deleted_at IS NULL
+		GROUP BY date, currency
+		ORDER BY date
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, start, end, TransactionTypeEarning, TransactionTypeSpending)
+	if err != nil {
+		return nil, fmt.Errorf("summing transactions by day: %w", err)
+	}
+	defer rows.Close()
+
+	var sums []DailySum
+	for rows.Next() {
+		var d DailySum
+		if err := rows.Scan(&d.Date, &d.Currency, &d.Income, &d.Spending); err != nil {
+			return nil, fmt.Errorf("scanning daily sum: %w", err)
+		}
+		sums = append(sums, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating daily sums: %w", err)
+	}
+
+	return sums, nil
+}
+
+func (r *repository) ListDates(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]time.Time, error) {
+	query := `
+		SELECT date
+		FROM transactions
+		WHERE user_id = $1 AND date >= $2 AND date <= $3 AND deleted_at IS NULL
+		ORDER BY date
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("listing transaction dates: %w", err)
+	}
+	defer rows.Close()
+
+	var dates []time.Time
+	for rows.Next() {
+		var date time.Time
+		if err := rows.Scan(&date); err != nil {
+			return nil, fmt.Errorf("scanning transaction date: %w", err)
+		}
+		dates = append(dates, date)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating transaction dates: %w", err)
+	}
+
+	return dates, nil
+}
+
+func (r *repository) CountByMerchant(ctx context.Context, userID uuid.UUID) ([]MerchantCount, error) {
+	query := `
+		SELECT merchant, COUNT(*)
+		FROM transactions
+		WHERE user_id = $1 AND merchant IS NOT NULL AND deleted_at IS NULL
+		GROUP BY merchant
+		ORDER BY COUNT(*) DESC, merchant
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("counting transactions by merchant: %w", err)
+	}
+	defer rows.Close()
+
+	merchants := []MerchantCount{}
+	for rows.Next() {
+		var m MerchantCount
+		if err := rows.Scan(&m.Merchant, &m.Count); err != nil {
+			return nil, fmt.Errorf("scanning merchant count: %w", err)
+		}
+		merchants = append(merchants, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating merchant counts: %w", err)
+	}
+
+	return merchants, nil
+}
+
+// SumByCategory totals the spending and counts the transactions of each
+// non-empty category, per currency, most spent first. Transactions are
+// limited to dates from start up to but not including end unless start is
+// zero.
+func (r *repository) SumByCategory(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]CategorySummary, error) {
+	args := []any{userID, TransactionTypeSpending}
+	dateRange := ""
+	if !start.IsZero() {
+		args = append(args, start, end)
+		dateRange = "AND date >= $3 AND date < $4"
+	}
+
+	query := `
+		SELECT category, currency,
+			COALESCE(SUM(amount_cents) FILTER (WHERE type = $2), 0)::BIGINT,
+			COUNT(*)
+		FROM transactions
+		WHERE user_id = $1 AND category != '' AND deleted_at IS NULL ` + dateRange + `
+		GROUP BY category, currency
+		ORDER BY 3 DESC, category, currency
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("summing transactions by category: %w", err)
+	}
+	defer rows.Close()
+
+	categories := []CategorySummary{}
+	for rows.Next() {
+		var c CategorySummary
+		if err := rows.Scan(&c.Category, &c.Currency, &c.Spending, &c.Count); err != nil {
+			return nil, fmt.Errorf("scanning category summary: %w", err)
+		}
+		categories = append(categories, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating category summaries: %w", err)
+	}
+
+	return categories, nil
+}
+
+// AggregateByRange sums transactions dated between start and end inclusive,
+// grouped by currency and type, without loading the rows.
+func (r *repository) AggregateByRange(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]AggregateTotal, error) {
+	query := `
+		SELECT currency, type, '', SUM(amount_cents)::BIGINT, COUNT(*)
+		FROM transactions
+		WHERE user_id = $1 AND date >= $2 AND date <= $3 AND deleted_at IS NULL
+		GROUP BY currency, type
+	`
+
+	totals, err := r.queryAggregateTotals(ctx, query, userID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("aggregating transactions by range: %w", err)
+	}
+
+	return totals, nil
+}
+
+// AggregateByMonth sums a month's transactions grouped by currency, type and
+// category, so callers get category breakdowns without loading the rows.
+func (r *repository) AggregateByMonth(ctx context.Context, userID uuid.UUID, year int, month int) ([]AggregateTotal, error) {
+	query := `
+		SELECT currency, type, category, SUM(amount_cents)::BIGINT, COUNT(*)
+		FROM transactions
+		WHERE user_id = $1 AND date >= $2 AND date < $3 AND deleted_at IS NULL
+		GROUP BY currency, type, category
+	`
+
+	start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	totals, err := r.queryAggregateTotals(ctx, query, userID, start, start.AddDate(0, 1, 0))
+	if err != nil {
+		return nil, fmt.Errorf("aggregating transactions by month: %w", err)
+	}
+
+	return totals, nil
+}
+
+// AggregateLifetime sums all of a user's transactions by currency and type,
+// with the dates of the first and last of each.
+func (r *repository) AggregateLifetime(ctx context.Context, userID uuid.UUID) ([]LifetimeTotal, error) {
+	query := `
+		SELECT currency, type, SUM(amount_cents)::BIGINT, COUNT(*), MIN(date), MAX(date)
+		FROM transactions
+		WHERE user_id = $1 AND deleted_at IS NULL
+		GROUP BY currency, type
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("aggregating lifetime totals: %w", err)
+	}
+	defer rows.Close()
+
+	var totals []LifetimeTotal
+	for rows.Next() {
+		var t LifetimeTotal
+		if err := rows.Scan(&t.Currency, &t.Type, &t.Total, &t.Count, &t.FirstDate, &t.LastDate); err != nil {
+			return nil, fmt.Errorf("scanning lifetime total: %w", err)
+		}
+		totals = append(totals, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating lifetime totals: %w", err)
+	}
+
+	return totals, nil
+}
+
+// AggregateByDay sums the income and spending of each day from start up to but
+// not including end, per currency. Days without transactions are omitted.
+func (r *repository) AggregateByDay(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]DailyTotal, error) {
+	query := `
+		SELECT date, currency,
+			COALESCE(SUM(amount_cents) FILTER (WHERE type = $4), 0)::BIGINT,
+			COALESCE(SUM(amount_cents) FILTER (WHERE type = $5), 0)::BIGINT
+		FROM transactions
+		WHERE user_id = $1 AND date >= $2 AND date < $3 AND deleted_at IS NULL
+		GROUP BY date, currency
+		ORDER BY date
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, start, end, TransactionTypeEarning, TransactionTypeSpending)
+	if err != nil {
+		return nil, fmt.Errorf("aggregating transactions by day: %w", err)
+	}
+	defer rows.Close()
+
+	var totals []DailyTotal
+	for rows.Next() {
+		var d DailyTotal
+		if err := rows.Scan(&d.Date, &d.Currency, &d.Income, &d.Spending); err != nil {
+			return nil, fmt.Errorf("scanning daily total: %w", err)
+		}
+		totals = append(totals, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating daily totals: %w", err)
+	}
+
+	return totals, nil
+}
+
+func (r *repository) queryAggregateTotals(ctx context.Context, query string, args ...any) ([]AggregateTotal, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []AggregateTotal
+	for rows.Next() {
+		var t AggregateTotal
+		if err := rows.Scan(&t.Currency, &t.Type, &t.Category, &t.Total, &t.Count); err != nil {
+			return nil, fmt.Errorf("scanning aggregate total: %w", err)
+		}
+		totals = append(totals, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating aggregate totals: %w", err)
+	}
+
+	return totals, nil
+}
+
+func (r *repository) queryTransactions(ctx context.Context, query string, args ...any) ([]*Transaction, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	var transactions []*Transaction
 	for rows.Next() {
-		var t Transaction
-		err := rows.Scan(
-			&t.ID,
-			&t.Date,
-			&t.Amount,
-			&t.Type,
-			&t.Description,
-			&t.ImageKey,
-			&t.UploadID,
-			&t.CreatedAt,
-			&t.UpdatedAt,
-		)
+		t, err := scanTransaction(rows)
 		if err != nil {
 			return nil, fmt.Errorf("scanning transaction: %w", err)
 		}
-		transactions = append(transactions, &t)
+		transactions = append(transactions, t)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -192,3 +894,342 @@ func (r *repository) GetByMonth(ctx context.Context, year int, month int) ([]*Tr
 
 	return transactions, nil
 }
+
+// AddAttachment appends an attachment after the transaction's existing ones
+// and refreshes the transaction's primary image. The transaction row is locked
+// so concurrent adds get distinct positions.
+func (r *repository) AddAttachment(ctx context.Context, userID uuid.UUID, attachment *Attachment) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning attachment insert: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockTransaction(ctx, tx, userID, attachment.TransactionID); err != nil {
+		return err
+	}
+
+	query := `SELECT COALESCE(MAX(position) + 1, 0) FROM transaction_attachments WHERE transaction_id = $1`
+	if err := tx.QueryRowContext(ctx, query, attachment.TransactionID).Scan(&attachment.Position); err != nil {
+		return fmt.Errorf("getting next attachment position: %w", err)
+	}
+
+	if err := insertAttachment(ctx, tx, attachment); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, syncPrimaryImageQuery, attachment.TransactionID); err != nil {
+		return fmt.Errorf("updating primary image: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing attachment insert: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteAttachment removes an attachment from a transaction owned by userID
+// and returns it, so the caller can delete its objects.
+func (r *repository) DeleteAttachment(ctx context.Context, userID uuid.UUID, transactionID uuid.UUID, attachmentID uuid.UUID) (*Attachment, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("beginning attachment delete: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockTransaction(ctx, tx, userID, transactionID); err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		DELETE FROM transaction_attachments
+		WHERE id = $1 AND transaction_id = $2
+		RETURNING %s
+	`, attachmentColumns)
+
+	attachment, err := scanAttachment(tx.QueryRowContext(ctx, query, attachmentID, transactionID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, fmt.Errorf("deleting attachment: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, syncPrimaryImageQuery, transactionID); err != nil {
+		return nil, fmt.Errorf("updating primary image: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("committing attachment delete: %w", err)
+	}
+
+	return attachment, nil
+}
+
+// ListAttachments returns the attachments of the given transactions keyed by
+// transaction ID, each ordered by position. Callers must only pass IDs of
+// transactions the user owns.
+func (r *repository) ListAttachments(ctx context.Context, transactionIDs []uuid.UUID) (map[uuid.UUID][]Attachment, error) {
+	attachments := make(map[uuid.UUID][]Attachment)
+	if len(transactionIDs) == 0 {
+		return attachments, nil
+	}
+
+	ids := make([]string, len(transactionIDs))
+	for i, id := range transactionIDs {
+		ids[i] = id.String()
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM transaction_attachments
+		WHERE transaction_id = ANY($1::uuid[])
+		ORDER BY transaction_id, position
+	`, attachmentColumns)
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("listing attachments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning attachment: %w", err)
+		}
+		attachments[a.TransactionID] = append(attachments[a.TransactionID], *a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating attachments: %w", err)
+	}
+
+	return attachments, nil
+}
+
+// lockTransaction locks a live transaction owned by userID for the rest of tx.
+func lockTransaction(ctx context.Context, tx *sql.Tx, userID uuid.UUID, id uuid.UUID) error {
+	query := `SELECT id FROM transactions WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE`
+
+	var locked uuid.UUID
+	if err := tx.QueryRowContext(ctx, query, id, userID).Scan(&locked); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTransactionNotFound
+		}
+		return fmt.Errorf("locking transaction: %w", err)
+	}
+
+	return nil
+}
+
+func insertAttachment(ctx context.Context, tx *sql.Tx, a *Attachment) error {
+	err := tx.QueryRowContext(ctx, insertAttachmentQuery,
+		a.ID, a.TransactionID, a.Key, a.ThumbnailKey, a.ContentType, a.Position,
+	).Scan(&a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("inserting attachment: %w", err)
+	}
+
+	return nil
+}
+
+// scanAttachment reads a row selected with attachmentColumns.
+func scanAttachment(row rowScanner) (*Attachment, error) {
+	var a Attachment
+	err := row.Scan(
+		&a.ID,
+		&a.TransactionID,
+		&a.Key,
+		&a.ThumbnailKey,
+		&a.ContentType,
+		&a.Position,
+		&a.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// uniqueViolation is the Postgres error code for a unique constraint failure.
+const uniqueViolation = "23505"
+
+// reversesIndex is the unique index allowing one live reversal per
+// transaction.
+const reversesIndex = "idx_transactions_reverses_id"
+
+// isReversalConflict reports whether err is a violation of reversesIndex.
+func isReversalConflict(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && pqErr.Constraint == reversesIndex
+}
+
+// idempotencyIndex is the unique index allowing one transaction per user and
+// idempotency key.
+const idempotencyIndex = "idx_transactions_idempotency_key"
+
+// isIdempotencyConflict reports whether err is a violation of
+// idempotencyIndex.
+func isIdempotencyConflict(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && pqErr.Constraint == idempotencyIndex
+}
+
+// scanTransaction reads a row selected with transactionColumns.
+func scanTransaction(row rowScanner) (*Transaction, error) {
+	var t Transaction
+	if err := row.Scan(transactionFields(&t)...); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// scanTransactionDetail reads a row selected with detailColumns.
+func scanTransactionDetail(row rowScanner) (*Transaction, error) {
+	var t Transaction
+	if err := row.Scan(append(transactionFields(&t), &t.Notes)...); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// transactionFields returns the scan destinations for transactionColumns.
+func transactionFields(t *Transaction) []any {
+	return []any{
+		&t.ID,
+		&t.Date,
+		&t.Amount,
+		&t.Currency,
+		&t.Type,
+		&t.Category,
+		&t.Description,
+		&t.Merchant,
+		pq.Array(&t.Tags),
+		&t.ImageKey,
+		&t.ThumbnailKey,
+		&t.UploadID,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+		&t.DeletedAt,
+		&t.ReversesID,
+	}
+}
+
+func insertArgs(t *Transaction) []any {
+	return []any{
+		t.ID,
+		t.UserID,
+		t.Date,
+		t.Amount,
+		t.Currency,
+		t.Type,
+		t.Category,
+		t.Description,
+		t.Merchant,
+		pq.Array(t.Tags),
+		t.ImageKey,
+		t.ThumbnailKey,
+		t.UploadID,
+		t.IdempotencyKey,
+		t.CreatedAt,
+		t.UpdatedAt,
+		t.Notes,
+		t.ReversesID,
+	}
+}
+
+// listConditions builds the WHERE clause shared by List, Count, SumByCurrency
+// and Stream. Rows are always scoped to userID, and soft-deleted rows are
+// excluded unless the filter includes them. Placeholders are numbered from
+// $1, so callers append their own arguments after args.
+func listConditions(userID uuid.UUID, filter ListFilter) (string, []any) {
+	conditions := []string{"user_id = $1"}
+	args := []any{userID}
+
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+
+	if filter.Type != "" {
+		args = append(args, filter.Type)
+		conditions = append(conditions, fmt.Sprintf("type = $%d", len(args)))
+	}
+
+	if filter.Category != "" {
+		args = append(args, filter.Category)
+		conditions = append(conditions, fmt.Sprintf("category = $%d", len(args)))
+	}
+
+	if filter.Merchant != "" {
+		args = append(args, filter.Merchant)
+		conditions = append(conditions, fmt.Sprintf("LOWER(merchant) = LOWER($%d)", len(args)))
+	}
+
+	if filter.Search != "" {
+		args = append(args, escapeLike(filter.Search))
+		conditions = append(conditions, fmt.Sprintf(`description ILIKE '%%' || $%d || '%%' ESCAPE '\'`, len(args)))
+	}
+
+	if filter.Tag != "" {
+		args = append(args, filter.Tag)
+		conditions = append(conditions, fmt.Sprintf("$%d = ANY(tags)", len(args)))
+	}
+
+	if filter.Currency != "" {
+		args = append(args, filter.Currency)
+		conditions = append(conditions, fmt.Sprintf("currency = $%d", len(args)))
+	}
+
+	if !filter.StartDate.IsZero() {
+		args = append(args, filter.StartDate)
+		conditions = append(conditions, fmt.Sprintf("date >= $%d", len(args)))
+	}
+
+	if !filter.EndDate.IsZero() {
+		args = append(args, filter.EndDate)
+		conditions = append(conditions, fmt.Sprintf("date <= $%d", len(args)))
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// sortColumns allowlists the columns List may order by. Only these constant
+// strings are ever interpolated into the query.
+var sortColumns = map[string]string{
+	"date":       "date",
+	"amount":     "amount_cents",
+	"created_at": "created_at",
+}
+
+// orderBy builds the ORDER BY clause for sort, breaking ties by creation time
+// and ID so pages stay stable. Unknown fields fall back to date.
+func orderBy(sort ListSort) string {
+	column, ok := sortColumns[sort.Field]
+	if !ok {
+		column = "date"
+	}
+
+	direction := "DESC"
+	if sort.Ascending {
+		direction = "ASC"
+	}
+
+	if column == "created_at" {
+		return fmt.Sprintf("created_at %[1]s, id %[1]s", direction)
+	}
+	return fmt.Sprintf("%[1]s %[2]s, created_at %[2]s, id %[2]s", column, direction)
+}
+
+// likeEscaper escapes LIKE wildcards so user input only matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
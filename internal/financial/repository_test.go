@@ -0,0 +1,113 @@
+package financial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/testutil"
+	"github.com/lib/pq"
+)
+
+func TestUniqueConflicts(t *testing.T) {
+	tests := []struct {
+		name            string
+		err             error
+		wantIdempotency bool
+		wantReversal    bool
+	}{
+		{name: "idempotency index", err: &pq.Error{Code: uniqueViolation, Constraint: idempotencyIndex}, wantIdempotency: true},
+		{name: "wrapped idempotency index", err: fmt.Errorf("insert: %w", &pq.Error{Code: uniqueViolation, Constraint: idempotencyIndex}), wantIdempotency: true},
+		{name: "reversal index", err: &pq.Error{Code: uniqueViolation, Constraint: reversesIndex}, wantReversal: true},
+		{name: "other unique index", err: &pq.Error{Code: uniqueViolation, Constraint: "transactions_pkey"}},
+		{name: "other error on the index", err: &pq.Error{Code: "23503", Constraint: idempotencyIndex}},
+		{name: "not a Postgres error", err: errors.New("connection reset")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isIdempotencyConflict(tt.err); got != tt.wantIdempotency {
+				t.Errorf("isIdempotencyConflict = %v, want %v", got, tt.wantIdempotency)
+			}
+			if got := isReversalConflict(tt.err); got != tt.wantReversal {
+				t.Errorf("isReversalConflict = %v, want %v", got, tt.wantReversal)
+			}
+		})
+	}
+}
+
+// seedMonth inserts n transactions for a new user spread over January 2024,
+// across a handful of categories and both types, and returns the user ID.
+func seedMonth(tb testing.TB, repo *repository, n int) uuid.UUID {
+	tb.Helper()
+
+	userID := uuid.New()
+	categories := []string{"groceries", "rent", "transport", "dining", "utilities"}
+	now := time.Now()
+
+	transactions := make([]*Transaction, n)
+	for i := range transactions {
+		transactionType := TransactionTypeSpending
+		if i%10 == 0 {
+			transactionType = TransactionTypeEarning
+		}
+		transactions[i] = &Transaction{
+			ID:          uuid.New(),
+			UserID:      userID,
+			Date:        time.Date(2024, 1, 1+i%31, 0, 0, 0, 0, time.UTC),
+			Amount:      Money(100 + i%5000),
+			Currency:    defaultCurrency,
+			Type:        transactionType,
+			Category:    categories[i%len(categories)],
+			Description: fmt.Sprintf("seeded transaction %d", i),
+			Tags:        []string{},
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+	}
+
+	if err := repo.CreateBatch(context.Background(), transactions); err != nil {
+		tb.Fatalf("seeding transactions: %v", err)
+	}
+	return userID
+}
+
+// BenchmarkMonthlyAggregate compares summing a month in SQL with
+// AggregateByMonth against loading every row with GetByMonth and summing in
+// Go, as monthly aggregates used to. B/op and allocs/op show the memory each
+// path needs as the month grows. Needs TEST_DATABASE_URL.
+func BenchmarkMonthlyAggregate(b *testing.B) {
+	repo := NewRepository(testutil.DB(b))
+	ctx := context.Background()
+
+	for _, n := range []int{100, 1000, 10000} {
+		userID := seedMonth(b, repo, n)
+
+		b.Run(fmt.Sprintf("AggregateByMonth/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				totals, err := repo.AggregateByMonth(ctx, userID, 2024, 1)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := summarizeTotals(totals, "", true); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("GetByMonth+summarize/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				transactions, err := repo.GetByMonth(ctx, userID, 2024, 1)
+				if err != nil {
+					b.Fatal(err)
+				}
+				summarize(transactions)
+			}
+		})
+	}
+}
@@ -1,71 +1,153 @@
 package financial
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
+	"github.com/kranti/cashflow/internal/auth"
+	"github.com/kranti/cashflow/internal/importer"
 	"github.com/kranti/cashflow/internal/s3"
+	"github.com/kranti/cashflow/internal/upload"
+	"golang.org/x/sync/errgroup"
 )
 
+const (
+	// maxRollingWindow caps the trailing window, in days, for rolling totals.
+	maxRollingWindow = 365
+
+	// maxStatsDays caps the from-to range of the daily stats, which walk
+	// every day in it.
+	maxStatsDays = 366
+
+	// maxForecastMonths caps how many months a net worth forecast covers.
+	maxForecastMonths = 60
+
+	minAggregateYear = 1900
+	maxAggregateYear = 2100
+
+	// idempotencyKeyTTL is how long a repeated Idempotency-Key returns the
+	// original transaction instead of creating a new one.
+	idempotencyKeyTTL = 24 * time.Hour
+
+	// presignConcurrency caps concurrent presign calls when listing.
+	presignConcurrency = 10
+
+	// daysPerMonth is the average length of a Gregorian month, used to turn
+	// a daily rate into a monthly one.
+	daysPerMonth = 365.2425 / 12
+)
+
+// ErrAggregateTimeout is returned when an aggregate computation exceeds the
+// configured time budget.
+var ErrAggregateTimeout = apperror.New(504, apperror.CodeAggregateTimeout, "aggregate computation timed out")
+
+// ErrNoImage is returned when a transaction has no image to presign.
+var ErrNoImage = apperror.New(404, apperror.CodeImageNotFound, "transaction has no image")
+
+// errImageMissing is returned when a transaction's image is gone from storage.
+var errImageMissing = apperror.New(404, apperror.CodeImageNotFound, "image not found")
+
 type service struct {
 	repo          Repository
 	s3Service     s3.Service
 	uploadService UploadService
+	budgetService BudgetService
+	notifier      Notifier
+	config        *Config
 	logger        *slog.Logger
+	// now is the clock deciding what today is; tests replace it
+	now func() time.Time
+
+	// aggregates caches monthly totals; writes invalidate the months they touch
+	aggregates *aggregateCache
 }
 
 type UploadService interface {
-	VerifyAndLinkUpload(ctx context.Context, uploadID string, transactionID uuid.UUID) (string, error)
+	VerifyUpload(ctx context.Context, uploadID string) (*upload.LinkedUpload, error)
+	LinkUpload(ctx context.Context, uploadID string, transactionID uuid.UUID) error
+	ReleaseTransactionUploads(ctx context.Context, transactionID uuid.UUID) error
+}
+
+// BudgetService supplies the category budgets compared in monthly aggregates.
+type BudgetService interface {
+	MonthlyLimits(ctx context.Context, month time.Time, currency string) (map[string]Money, error)
+}
+
+// Notifier publishes transaction events to external integrations. Notify must
+// not block or fail the caller.
+type Notifier interface {
+	Notify(event string, payload any)
 }
 
-func NewService(repo Repository, s3Service s3.Service, uploadService UploadService, logger *slog.Logger) *service {
+func NewService(repo Repository, s3Service s3.Service, uploadService UploadService, budgetService BudgetService, notifier Notifier, config *Config, logger *slog.Logger) *service {
 	return &service{
 		repo:          repo,
 		s3Service:     s3Service,
 		uploadService: uploadService,
+		budgetService: budgetService,
+		notifier:      notifier,
+		config:        config,
 		logger:        logger,
+		now:           time.Now,
+		aggregates:    newAggregateCache(config.AggregateCacheSize, config.AggregateCacheTTL),
 	}
 }
 
 func (s *service) CreateTransaction(ctx context.Context, req CreateTransactionRequest) (*Transaction, error) {
-	if req.Amount <= 0 {
-		return nil, fmt.Errorf("amount must be greater than 0")
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	if req.Type != TransactionTypeSpending && req.Type != TransactionTypeEarning {
-		return nil, fmt.Errorf("invalid transaction type: %s", req.Type)
+	if req.IdempotencyKey != "" {
+		existing, err := s.findIdempotentTransaction(ctx, userID, req.IdempotencyKey)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return existing, nil
+		}
 	}
 
-	date, err := time.Parse("2006-01-02", req.Date)
+	transaction, err := s.newTransaction(userID, req)
 	if err != nil {
-		return nil, fmt.Errorf("invalid date format, expected YYYY-MM-DD: %w", err)
+		return nil, err
 	}
+	transaction.IdempotencyKey = req.IdempotencyKey
 
-	now := time.Now()
-	transaction := &Transaction{
-		ID:          uuid.New(),
-		Date:        date,
-		Amount:      req.Amount,
-		Type:        req.Type,
-		Description: req.Description,
-		CreatedAt:   now,
-		UpdatedAt:   now,
+	if s.config.DuplicateCheck && !req.AllowDuplicate {
+		duplicates, err := s.repo.FindDuplicates(ctx, userID, []*Transaction{transaction}, s.config.DuplicateWindowDays)
+		if err != nil {
+			return nil, fmt.Errorf("checking for duplicates: %w", err)
+		}
+		if existingID, ok := duplicates[0]; ok {
+			return nil, duplicateError(existingID)
+		}
 	}
 
 	// Handle image upload
 	if req.UploadID != "" {
 		// New presigned URL flow
-		imageKey, err := s.uploadService.VerifyAndLinkUpload(ctx, req.UploadID, transaction.ID)
+		linked, err := s.uploadService.VerifyUpload(ctx, req.UploadID)
 		if err != nil {
 			return nil, fmt.Errorf("verifying upload: %w", err)
 		}
-		transaction.ImageKey = imageKey
+		transaction.Attachments = []Attachment{s.newAttachment(transaction.ID, linked.Key, linked.ThumbnailKey, linked.ContentType)}
+		transaction.ImageKey = linked.Key
+		transaction.ThumbnailKey = linked.ThumbnailKey
 		transaction.UploadID = req.UploadID
 	} else if req.ImageBase64 != "" {
 		// Legacy base64 flow (deprecated)
@@ -79,70 +161,362 @@ func (s *service) CreateTransaction(ctx context.Context, req CreateTransactionRe
 			return nil, fmt.Errorf("uploading image: %w", err)
 		}
 
+		transaction.Attachments = []Attachment{s.newAttachment(transaction.ID, key, "", contentType)}
 		transaction.ImageKey = key
 		transaction.ImageURL = url
 	}
 
 	if err := s.repo.Create(ctx, transaction); err != nil {
+		if errors.Is(err, ErrIdempotencyKeyTaken) {
+			// A concurrent request with the same key won the insert. It may
+			// have verified the same upload, so objects it references are
+			// kept, as are the upload's when it can't be read.
+			existing, err := s.idempotentTransaction(ctx, userID, req.IdempotencyKey, s.now().Add(-idempotencyKeyTTL))
+			if err == nil || req.UploadID == "" {
+				s.discardUnusedImages(ctx, transaction, existing)
+			}
+			return existing, err
+		}
+		// No row references the image or upload this request stored
+		s.discardUnusedImages(ctx, transaction, nil)
 		s.logger.Error("failed to create transaction",
 			slog.String("error", err.Error()),
 			slog.String("type", string(req.Type)),
-			slog.Float64("amount", req.Amount))
+			slog.String("amount", req.Amount.String()))
 		return nil, fmt.Errorf("creating transaction: %w", err)
 	}
+	s.aggregates.invalidate(userID, transaction.Date)
+	s.linkUpload(ctx, transaction.UploadID, transaction.ID)
 
 	// Generate presigned URL for response if image exists
-	if transaction.ImageKey != "" {
-		url, err := s.s3Service.GetPresignedURL(ctx, transaction.ImageKey)
-		if err != nil {
-			s.logger.Warn("failed to generate presigned URL for new transaction",
-				slog.String("error", err.Error()),
-				slog.String("key", transaction.ImageKey))
-		} else {
-			transaction.ImageURL = url
-		}
-	}
+	s.attachImageURL(ctx, transaction)
 
 	s.logger.Info("transaction created",
 		slog.String("id", transaction.ID.String()),
 		slog.String("type", string(transaction.Type)),
-		slog.Float64("amount", transaction.Amount))
+		slog.String("amount", transaction.Amount.String()))
+
+	s.notifier.Notify("transaction.created", transaction)
 
 	return transaction, nil
 }
 
-func (s *service) ListTransactions(ctx context.Context, limit, offset int) ([]*Transaction, int64, error) {
+// isDuplicate reports whether a and b match as FindDuplicates matches a new
+// transaction against a stored one.
+func isDuplicate(a, b *Transaction, windowDays int) bool {
+	if a.Amount != b.Amount || a.Currency != b.Currency || a.Type != b.Type || a.Description != b.Description {
+		return false
+	}
+	days := int(a.Date.Sub(b.Date).Hours() / 24)
+	return days >= -windowDays && days <= windowDays
+}
+
+// duplicateError reports that a new transaction matches an existing one,
+// carrying the existing transaction's ID for the client.
+func duplicateError(existingID uuid.UUID) error {
+	err := apperror.New(409, apperror.CodeDuplicateTransaction,
+		"a matching transaction already exists; set allow_duplicate=true to create it anyway")
+	err.Details = map[string]any{"existing_id": existingID}
+	return err
+}
+
+// findIdempotentTransaction returns the transaction already created with key,
+// or nil when the key is unused or expired. Expired keys are released so the
+// new transaction can claim them.
+func (s *service) findIdempotentTransaction(ctx context.Context, userID uuid.UUID, key string) (*Transaction, error) {
+	cutoff := s.now().Add(-idempotencyKeyTTL)
+
+	existing, err := s.idempotentTransaction(ctx, userID, key, cutoff)
+	if !errors.Is(err, ErrTransactionNotFound) {
+		return existing, err
+	}
+
+	if err := s.repo.ReleaseIdempotencyKey(ctx, userID, key, cutoff); err != nil {
+		return nil, fmt.Errorf("releasing idempotency key: %w", err)
+	}
+
+	return nil, nil
+}
+
+// idempotentTransaction loads the live transaction created with key since
+// cutoff, with its attachments and image URL.
+func (s *service) idempotentTransaction(ctx context.Context, userID uuid.UUID, key string, cutoff time.Time) (*Transaction, error) {
+	existing, err := s.repo.GetByIdempotencyKey(ctx, userID, key, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("checking idempotency key: %w", err)
+	}
+
+	s.logger.Info("returning transaction for repeated idempotency key",
+		slog.String("id", existing.ID.String()))
+	if err := s.loadAttachments(ctx, []*Transaction{existing}); err != nil {
+		return nil, err
+	}
+	s.attachImageURL(ctx, existing)
+	return existing, nil
+}
+
+// linkUpload marks uploadID as attached to the stored transaction. The
+// transaction and its attachment are already committed, so a failure is only
+// logged; the upload record stays pending and the cleanup worker expires it.
+func (s *service) linkUpload(ctx context.Context, uploadID string, transactionID uuid.UUID) {
+	if uploadID == "" {
+		return
+	}
+	if err := s.uploadService.LinkUpload(ctx, uploadID, transactionID); err != nil {
+		s.logger.Error("failed to link upload",
+			slog.String("error", err.Error()),
+			slog.String("upload_id", uploadID),
+			slog.String("transaction_id", transactionID.String()))
+	}
+}
+
+func (s *service) ImportJSON(ctx context.Context, req ImportJSONRequest, opts ImportOptions) (*ImportSummary, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := req.Mapping.withDefaults()
+	summary := &ImportSummary{
+		Total:  len(req.Transactions),
+		DryRun: opts.DryRun,
+		Errors: []ImportError{},
+	}
+
+	transactions := make([]*Transaction, 0, len(req.Transactions))
+	indexes := make([]int, 0, len(req.Transactions))
+	for i, item := range req.Transactions {
+		createReq, err := mapping.toCreateRequest(item)
+		if err == nil {
+			var transaction *Transaction
+			transaction, err = s.newTransaction(userID, createReq)
+			if err == nil {
+				transactions = append(transactions, transaction)
+				indexes = append(indexes, i)
+				continue
+			}
+		}
+		summary.Errors = append(summary.Errors, ImportError{Index: i, Error: err.Error()})
+	}
+
+	return s.saveImported(ctx, userID, transactions, indexes, summary, opts)
+}
+
+// ImportOFX creates the transactions of a parsed OFX or QFX statement. Debits
+// become spending and credits earnings; the memo is used as the description,
+// falling back to the payee name. Entries with a zero amount are skipped.
+func (s *service) ImportOFX(ctx context.Context, statement *importer.Statement, opts ImportOptions) (*ImportSummary, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ImportSummary{
+		Total:  len(statement.Entries),
+		DryRun: opts.DryRun,
+		Errors: []ImportError{},
+	}
+
+	transactions := make([]*Transaction, 0, len(statement.Entries))
+	indexes := make([]int, 0, len(statement.Entries))
+	for i, entry := range statement.Entries {
+		createReq, err := ofxCreateRequest(entry)
+		if err == nil && createReq.Amount == 0 {
+			summary.Skipped++
+			continue
+		}
+		if err == nil {
+			var transaction *Transaction
+			transaction, err = s.newTransaction(userID, createReq)
+			if err == nil {
+				transactions = append(transactions, transaction)
+				indexes = append(indexes, i)
+				continue
+			}
+		}
+		summary.Errors = append(summary.Errors, ImportError{Index: i, Error: err.Error()})
+	}
+
+	return s.saveImported(ctx, userID, transactions, indexes, summary, opts)
+}
+
+// saveImported creates the transactions that passed validation in one batch
+// and completes the summary. indexes holds the position of each transaction
+// in the import. When the duplicate check is on and duplicates aren't allowed,
+// transactions matching existing ones, or an earlier entry of the import, are
+// reported as errors instead. A dry run only counts them.
+func (s *service) saveImported(ctx context.Context, userID uuid.UUID, transactions []*Transaction, indexes []int, summary *ImportSummary, opts ImportOptions) (*ImportSummary, error) {
+	if s.config.DuplicateCheck && !opts.AllowDuplicates {
+		duplicates, err := s.repo.FindDuplicates(ctx, userID, transactions, s.config.DuplicateWindowDays)
+		if err != nil {
+			return nil, fmt.Errorf("checking for duplicates: %w", err)
+		}
+
+		unique := transactions[:0]
+		keptIndexes := make([]int, 0, len(transactions))
+		for i, t := range transactions {
+			existingID, ok := duplicates[i]
+			if !ok {
+				unique = append(unique, t)
+				keptIndexes = append(keptIndexes, indexes[i])
+				continue
+			}
+			summary.Errors = append(summary.Errors, ImportError{
+				Index:      indexes[i],
+				Error:      "duplicate of an existing transaction",
+				ExistingID: existingID.String(),
+			})
+		}
+		transactions = unique
+
+		// The stored rows don't include the rest of this import, so entries
+		// repeating an earlier one are checked here
+		unique = transactions[:0]
+		uniqueIndexes := make([]int, 0, len(transactions))
+		for i, t := range transactions {
+			earlier := -1
+			for j, u := range unique {
+				if isDuplicate(t, u, s.config.DuplicateWindowDays) {
+					earlier = uniqueIndexes[j]
+					break
+				}
+			}
+			if earlier < 0 {
+				unique = append(unique, t)
+				uniqueIndexes = append(uniqueIndexes, keptIndexes[i])
+				continue
+			}
+			summary.Errors = append(summary.Errors, ImportError{
+				Index: keptIndexes[i],
+				Error: fmt.Sprintf("duplicate of entry %d in this import", earlier),
+			})
+		}
+		transactions = unique
+
+		sort.Slice(summary.Errors, func(i, j int) bool {
+			return summary.Errors[i].Index < summary.Errors[j].Index
+		})
+	}
+	summary.Failed = len(summary.Errors)
+
+	if opts.DryRun {
+		summary.Imported = len(transactions)
+		return summary, nil
+	}
+
+	if len(transactions) == 0 {
+		return summary, nil
+	}
+
+	if err := s.repo.CreateBatch(ctx, transactions); err != nil {
+		s.logger.Error("failed to import transactions",
+			slog.String("error", err.Error()),
+			slog.Int("count", len(transactions)))
+		return nil, fmt.Errorf("importing transactions: %w", err)
+	}
+	for _, t := range transactions {
+		s.aggregates.invalidate(userID, t.Date)
+	}
+	summary.Imported = len(transactions)
+
+	s.logger.Info("transactions imported",
+		slog.Int("imported", summary.Imported),
+		slog.Int("skipped", summary.Skipped),
+		slog.Int("failed", summary.Failed))
+
+	return summary, nil
+}
+
+var errIncludeDeletedForbidden = apperror.New(403, apperror.CodeForbidden, "include_deleted requires admin access")
+
+// checkListAccess rejects list filters that only admins may use.
+func checkListAccess(ctx context.Context, filter ListFilter) error {
+	if filter.IncludeDeleted && !auth.IsAdmin(ctx) {
+		return errIncludeDeletedForbidden
+	}
+	return nil
+}
+
+// PageLimit resolves a requested page size: zero or negative selects the
+// configured default and anything above the configured maximum is capped.
+func (s *service) PageLimit(limit int) int {
 	if limit <= 0 {
-		limit = 20
+		return s.config.DefaultListLimit
+	}
+	if limit > s.config.MaxListLimit {
+		return s.config.MaxListLimit
 	}
-	if limit > 100 {
-		limit = 100
+	return limit
+}
+
+// ListTransactionsAfter returns a page in cursor mode along with the cursor of
+// the next page, which is empty on the last page.
+func (s *service) ListTransactionsAfter(ctx context.Context, filter ListFilter, cursor *Cursor, limit int) ([]*Transaction, string, error) {
+	limit = s.PageLimit(limit)
+
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := checkListAccess(ctx, filter); err != nil {
+		return nil, "", err
+	}
+
+	// One extra row tells whether another page follows
+	transactions, err := s.repo.ListAfter(ctx, userID, filter, cursor, limit+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("listing transactions: %w", err)
 	}
+
+	var next string
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+		next = encodeCursor(transactions[limit-1])
+	}
+
+	if err := s.loadAttachments(ctx, transactions); err != nil {
+		return nil, "", err
+	}
+	s.attachImageURLs(ctx, transactions)
+
+	return transactions, next, nil
+}
+
+// ListTransactions returns a page of transactions and the total matching
+// filter. withBalance adds each transaction's running balance.
+func (s *service) ListTransactions(ctx context.Context, filter ListFilter, sort ListSort, limit, offset int, withBalance bool) ([]*Transaction, int64, error) {
+	limit = s.PageLimit(limit)
 	if offset < 0 {
 		offset = 0
 	}
 
-	transactions, err := s.repo.List(ctx, limit, offset)
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := checkListAccess(ctx, filter); err != nil {
+		return nil, 0, err
+	}
+
+	list := s.repo.List
+	if withBalance {
+		list = s.repo.ListWithBalance
+	}
+
+	transactions, err := list(ctx, userID, filter, sort, limit, offset)
 	if err != nil {
 		s.logger.Error("failed to list transactions", slog.String("error", err.Error()))
 		return nil, 0, fmt.Errorf("listing transactions: %w", err)
 	}
 
-	// Generate presigned URLs for images
-	for _, t := range transactions {
-		if t.ImageKey != "" {
-			url, err := s.s3Service.GetPresignedURL(ctx, t.ImageKey)
-			if err != nil {
-				s.logger.Warn("failed to generate presigned URL",
-					slog.String("error", err.Error()),
-					slog.String("key", t.ImageKey))
-			} else {
-				t.ImageURL = url
-			}
-		}
+	if err := s.loadAttachments(ctx, transactions); err != nil {
+		return nil, 0, err
 	}
 
-	count, err := s.repo.Count(ctx)
+	// Generate presigned URLs for images
+	s.attachImageURLs(ctx, transactions)
+
+	count, err := s.repo.Count(ctx, userID, filter)
 	if err != nil {
 		s.logger.Error("failed to count transactions", slog.String("error", err.Error()))
 		return nil, 0, fmt.Errorf("counting transactions: %w", err)
@@ -151,86 +525,1713 @@ func (s *service) ListTransactions(ctx context.Context, limit, offset int) ([]*T
 	return transactions, count, nil
 }
 
-func (s *service) GetMonthlyAggregate(ctx context.Context, month string) (*AggregatedData, error) {
-	parts := strings.Split(month, "-")
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid month format, expected YYYY-MM")
+// StreamTransactions calls fn for every transaction matching filter, in list
+// order, without loading the full result set into memory.
+func (s *service) StreamTransactions(ctx context.Context, filter ListFilter, fn func(*Transaction) error) error {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return err
 	}
 
-	year, err := strconv.Atoi(parts[0])
+	if err := s.repo.Stream(ctx, userID, filter, fn); err != nil {
+		s.logger.Error("failed to stream transactions", slog.String("error", err.Error()))
+		return fmt.Errorf("streaming transactions: %w", err)
+	}
+
+	return nil
+}
+
+func (s *service) GetTransaction(ctx context.Context, id uuid.UUID) (*Transaction, error) {
+	userID, err := auth.UserID(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("invalid year: %w", err)
+		return nil, err
 	}
 
-	monthNum, err := strconv.Atoi(parts[1])
+	transaction, err := s.repo.GetByID(ctx, userID, id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid month: %w", err)
+		return nil, fmt.Errorf("getting transaction: %w", err)
 	}
 
-	if monthNum < 1 || monthNum > 12 {
-		return nil, fmt.Errorf("month must be between 1 and 12")
+	if err := s.loadAttachments(ctx, []*Transaction{transaction}); err != nil {
+		return nil, err
 	}
 
-	transactions, err := s.repo.GetByMonth(ctx, year, monthNum)
+	s.attachImageURL(ctx, transaction)
+
+	return transaction, nil
+}
+
+// GetTransactionVersion returns when a transaction was last updated, without
+// loading its attachments or presigning its image, so a conditional request
+// can be answered cheaply.
+func (s *service) GetTransactionVersion(ctx context.Context, id uuid.UUID) (time.Time, error) {
+	userID, err := auth.UserID(ctx)
 	if err != nil {
-		s.logger.Error("failed to get monthly transactions",
-			slog.String("error", err.Error()),
-			slog.String("month", month))
-		return nil, fmt.Errorf("getting monthly transactions: %w", err)
+		return time.Time{}, err
 	}
 
-	var income, spending float64
-	for _, t := range transactions {
-		switch t.Type {
-		case TransactionTypeEarning:
-			income += t.Amount
-		case TransactionTypeSpending:
-			spending += t.Amount
+	transaction, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("getting transaction: %w", err)
+	}
+
+	return transaction.UpdatedAt, nil
+}
+
+// GetImageURL presigns a new URL for a transaction's image, so clients can
+// refresh an expired URL without listing again.
+func (s *service) GetImageURL(ctx context.Context, id uuid.UUID) (*ImageURLResponse, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting transaction: %w", err)
+	}
+
+	if transaction.ImageKey == "" {
+		return nil, ErrNoImage
+	}
+
+	// Taken before presigning so the reported expiry is never late
+	expiresAt := s.now().Add(s.s3Service.URLExpiration()).UTC()
+
+	url, err := s.s3Service.GetPresignedURL(ctx, transaction.ImageKey)
+	if err != nil {
+		return nil, fmt.Errorf("presigning image URL: %w", err)
+	}
+
+	return &ImageURLResponse{
+		URL:          url,
+		ThumbnailURL: s.presign(ctx, transaction.ThumbnailKey),
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// GetImage opens a transaction's image for streaming to clients that can't
+// load presigned URLs.
+func (s *service) GetImage(ctx context.Context, id uuid.UUID) (*ImageContent, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting transaction: %w", err)
+	}
+
+	if transaction.ImageKey == "" {
+		return nil, ErrNoImage
+	}
+
+	object, err := s.s3Service.GetObject(ctx, transaction.ImageKey)
+	if errors.Is(err, s3.ErrObjectNotFound) {
+		return s.missingImage()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting image: %w", err)
+	}
+
+	return &ImageContent{Body: object.Body, ContentType: object.ContentType, Size: object.ContentLength}, nil
+}
+
+// missingImage is what GetImage serves in place of an image gone from
+// storage: a 404, a redirect to the configured placeholder URL or the bundled
+// placeholder image.
+func (s *service) missingImage() (*ImageContent, error) {
+	switch s.config.MissingImage {
+	case MissingImageRedirect:
+		return &ImageContent{RedirectURL: s.config.MissingImageURL}, nil
+	case MissingImagePlaceholder:
+		return &ImageContent{
+			Body:        io.NopCloser(bytes.NewReader(placeholderImage)),
+			ContentType: placeholderContentType,
+			Size:        int64(len(placeholderImage)),
+		}, nil
+	default:
+		return nil, errImageMissing
+	}
+}
+
+// ListTotals sums the income and spending of every transaction matching
+// filter, per currency, for list views that show a summary beside the page.
+func (s *service) ListTotals(ctx context.Context, filter ListFilter) ([]ListTotal, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkListAccess(ctx, filter); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.AggregateTimeout)
+	defer cancel()
+
+	totals, err := s.repo.SumByCurrency(ctx, userID, filter)
+	if err != nil {
+		s.logger.Error("failed to total transactions", slog.String("error", err.Error()))
+		return nil, aggregateError(ctx, "totalling transactions", err)
+	}
+
+	if totals == nil {
+		totals = []ListTotal{}
+	}
+	return totals, nil
+}
+
+func (s *service) ListMerchants(ctx context.Context) ([]MerchantCount, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.AggregateTimeout)
+	defer cancel()
+
+	merchants, err := s.repo.CountByMerchant(ctx, userID)
+	if err != nil {
+		s.logger.Error("failed to list merchants", slog.String("error", err.Error()))
+		return nil, aggregateError(ctx, "listing merchants", err)
+	}
+
+	return merchants, nil
+}
+
+// ListCategories summarizes every category the user has used, or only those
+// used in month (YYYY-MM) when it is given.
+func (s *service) ListCategories(ctx context.Context, month string) (*CategoryList, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var start, end time.Time
+	if month != "" {
+		year, monthNum, err := parseAggregateMonth(month)
+		if err != nil {
+			return nil, err
 		}
+		start = time.Date(year, time.Month(monthNum), 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 1, 0)
 	}
 
-	aggregate := &AggregatedData{
-		Month:    month,
-		Income:   income,
-		Spending: spending,
-		NetTotal: income - spending,
+	ctx, cancel := context.WithTimeout(ctx, s.config.AggregateTimeout)
+	defer cancel()
+
+	categories, err := s.repo.SumByCategory(ctx, userID, start, end)
+	if err != nil {
+		s.logger.Error("failed to list categories", slog.String("error", err.Error()))
+		return nil, aggregateError(ctx, "listing categories", err)
 	}
 
+	return &CategoryList{Month: month, Categories: categories}, nil
+}
+
+func (s *service) GetMonthlyAggregate(ctx context.Context, month string, currency string) (*AggregatedData, error) {
+	year, monthNum, err := parseAggregateMonth(month)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.AggregateTimeout)
+	defer cancel()
+
+	totals, err := s.monthTotals(ctx, userID, year, monthNum)
+	if err != nil {
+		s.logger.Error("failed to aggregate monthly transactions",
+			slog.String("error", err.Error()),
+			slog.String("month", month))
+		return nil, aggregateError(ctx, "aggregating monthly transactions", err)
+	}
+
+	aggregate, err := summarizeTotals(totals, currency, true)
+	if err != nil {
+		return nil, err
+	}
+	aggregate.Month = month
+	s.applyBudgets(ctx, aggregate, time.Date(year, time.Month(monthNum), 1, 0, 0, 0, 0, time.UTC))
+
 	s.logger.Info("calculated monthly aggregate",
 		slog.String("month", month),
-		slog.Float64("income", income),
-		slog.Float64("spending", spending),
-		slog.Float64("net", aggregate.NetTotal))
+		slog.String("income", aggregate.Income.String()),
+		slog.String("spending", aggregate.Spending.String()),
+		slog.String("net", aggregate.NetTotal.String()))
 
 	return aggregate, nil
 }
 
-func (s *service) DeleteTransaction(ctx context.Context, id uuid.UUID) error {
-	// Get transaction to retrieve image key
-	transaction, err := s.repo.GetByID(ctx, id)
+// monthTotals returns a month's totals from the aggregate cache, querying and
+// caching them on a miss.
+func (s *service) monthTotals(ctx context.Context, userID uuid.UUID, year, month int) ([]AggregateTotal, error) {
+	key := monthKey{userID: userID, year: year, month: month}
+	if totals, ok := s.aggregates.get(key); ok {
+		return totals, nil
+	}
+
+	version := s.aggregates.version()
+	totals, err := s.repo.AggregateByMonth(ctx, userID, year, month)
 	if err != nil {
-		return fmt.Errorf("getting transaction: %w", err)
+		return nil, err
 	}
 
-	// Delete image from S3 if exists
-	if transaction.ImageKey != "" {
-		if err := s.s3Service.DeleteImage(ctx, transaction.ImageKey); err != nil {
-			s.logger.Error("failed to delete image from S3",
-				slog.String("error", err.Error()),
-				slog.String("key", transaction.ImageKey))
-			// Continue with transaction deletion even if image deletion fails
-		}
+	s.aggregates.put(key, totals, version, s.today())
+	return totals, nil
+}
+
+// GetDailyAggregate totals income and spending for each day of month. Only
+// days with transactions are included unless fill is set, in which case every
+// day of the month is listed and empty days are zero.
+func (s *service) GetDailyAggregate(ctx context.Context, month string, currency string, fill bool) (*DailyAggregates, error) {
+	year, monthNum, err := parseAggregateMonth(month)
+	if err != nil {
+		return nil, err
 	}
 
-	// Delete transaction from database
-	if err := s.repo.Delete(ctx, id); err != nil {
-		return fmt.Errorf("deleting transaction: %w", err)
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	s.logger.Info("transaction deleted",
-		slog.String("id", id.String()))
+	ctx, cancel := context.WithTimeout(ctx, s.config.AggregateTimeout)
+	defer cancel()
 
-	return nil
+	start := time.Date(year, time.Month(monthNum), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	totals, err := s.repo.AggregateByDay(ctx, userID, start, end)
+	if err != nil {
+		s.logger.Error("failed to aggregate daily transactions",
+			slog.String("error", err.Error()),
+			slog.String("month", month))
+		return nil, aggregateError(ctx, "aggregating daily transactions", err)
+	}
+
+	// Like the other aggregates, never sum across currencies
+	if currency, err = aggregateCurrency(currency); err != nil {
+		return nil, err
+	}
+	if currency == "" {
+		seen := make(map[string]bool)
+		for _, t := range totals {
+			seen[t.Currency] = true
+		}
+		if currency, err = onlyCurrency(seen); err != nil {
+			return nil, err
+		}
+	}
+
+	byDate := make(map[string]DailyAggregate)
+	var dates []string
+	for _, t := range totals {
+		if t.Currency != currency {
+			continue
+		}
+		date := t.Date.Format(dateLayout)
+		byDate[date] = DailyAggregate{
+			Date:     date,
+			Income:   t.Income,
+			Spending: t.Spending,
+			Net:      t.Income - t.Spending,
+		}
+		dates = append(dates, date)
+	}
+
+	if fill {
+		dates = dates[:0]
+		for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+			dates = append(dates, day.Format(dateLayout))
+		}
+	}
+
+	aggregates := &DailyAggregates{
+		Month:    start.Format("2006-01"),
+		Currency: currency,
+		Days:     make([]DailyAggregate, 0, len(dates)),
+	}
+	for _, date := range dates {
+		day := byDate[date]
+		day.Date = date
+		aggregates.Days = append(aggregates.Days, day)
+	}
+
+	return aggregates, nil
+}
+
+// parseAggregateMonth splits a YYYY-MM month into its year and month number.
+func parseAggregateMonth(month string) (int, int, error) {
+	parts := strings.Split(month, "-")
+	if len(parts) != 2 {
+		return 0, 0, apperror.Invalid(apperror.CodeInvalidParameter, "invalid month format, expected YYYY-MM")
+	}
+
+	year, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, apperror.Invalid(apperror.CodeInvalidParameter, "invalid year %q, expected YYYY-MM", parts[0])
+	}
+
+	monthNum, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, apperror.Invalid(apperror.CodeInvalidParameter, "invalid month %q, expected YYYY-MM", parts[1])
+	}
+
+	if monthNum < 1 || monthNum > 12 {
+		return 0, 0, apperror.Invalid(apperror.CodeInvalidParameter, "month must be between 1 and 12")
+	}
+
+	return year, monthNum, nil
+}
+
+// applyBudgets sets Budgets on a monthly aggregate. Budgets are an addition to
+// the aggregate, so a failed lookup is logged rather than returned.
+func (s *service) applyBudgets(ctx context.Context, aggregate *AggregatedData, month time.Time) {
+	currency := aggregate.Currency
+	if currency == "" {
+		currency = defaultCurrency
+	}
+
+	limits, err := s.budgetService.MonthlyLimits(ctx, month, currency)
+	if err != nil {
+		s.logger.Warn("failed to load budgets",
+			slog.String("error", err.Error()),
+			slog.String("month", aggregate.Month))
+		return
+	}
+	if len(limits) == 0 {
+		return
+	}
+
+	aggregate.Budgets = make(map[string]CategoryBudget, len(limits))
+	for category, limit := range limits {
+		spent := aggregate.ByCategory[category]
+		aggregate.Budgets[category] = CategoryBudget{
+			Spent:      spent,
+			Budget:     limit,
+			Remaining:  limit - spent,
+			OverBudget: spent > limit,
+		}
+	}
+}
+
+// CompareMonths computes the aggregates of two months and how income,
+// spending and net total changed from the first to the second.
+func (s *service) CompareMonths(ctx context.Context, from, to string, currency string) (*MonthComparison, error) {
+	fromAggregate, err := s.GetMonthlyAggregate(ctx, from, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	toAggregate, err := s.GetMonthlyAggregate(ctx, to, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each month picks its own currency when none is given, so they may differ
+	if fromAggregate.Currency != "" && toAggregate.Currency != "" && fromAggregate.Currency != toAggregate.Currency {
+		return nil, apperror.Invalid(apperror.CodeCurrencyRequired,
+			"months use different currencies (%s, %s), specify a currency", fromAggregate.Currency, toAggregate.Currency)
+	}
+
+	comparison := &MonthComparison{
+		From:     *fromAggregate,
+		To:       *toAggregate,
+		Currency: fromAggregate.Currency,
+		Income:   delta(fromAggregate.Income, toAggregate.Income),
+		Spending: delta(fromAggregate.Spending, toAggregate.Spending),
+		NetTotal: delta(fromAggregate.NetTotal, toAggregate.NetTotal),
+	}
+	if comparison.Currency == "" {
+		comparison.Currency = toAggregate.Currency
+	}
+
+	return comparison, nil
+}
+
+// delta reports the change from before to after, with the percentage rounded
+// to two decimals. A zero before has no percentage.
+func delta(before, after Money) AggregateDelta {
+	d := AggregateDelta{Change: after - before}
+	if before != 0 {
+		percent := math.Round(float64(after-before)/math.Abs(float64(before))*10000) / 100
+		d.PercentChange = &percent
+	}
+	return d
+}
+
+func (s *service) GetWeeklyAggregate(ctx context.Context, year int, week int, currency string) (*AggregatedData, error) {
+	if year < minAggregateYear || year > maxAggregateYear {
+		return nil, apperror.Invalid(apperror.CodeInvalidParameter, "year must be between %d and %d", minAggregateYear, maxAggregateYear)
+	}
+
+	if week < 1 || week > 53 {
+		return nil, apperror.Invalid(apperror.CodeInvalidParameter, "week must be between 1 and 53")
+	}
+
+	start := isoWeekStart(year, week)
+	if y, w := start.ISOWeek(); y != year || w != week {
+		return nil, apperror.Invalid(apperror.CodeInvalidParameter, "year %d has no ISO week %d", year, week)
+	}
+
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.AggregateTimeout)
+	defer cancel()
+
+	transactions, err := s.repo.GetByWeek(ctx, userID, year, week)
+	if err != nil {
+		s.logger.Error("failed to get weekly transactions",
+			slog.String("error", err.Error()),
+			slog.Int("year", year),
+			slog.Int("week", week))
+		return nil, aggregateError(ctx, "getting weekly transactions", err)
+	}
+
+	transactions, currency, err = selectCurrency(transactions, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregate := summarize(transactions)
+	if ctx.Err() != nil {
+		return nil, aggregateError(ctx, "summing weekly transactions", ctx.Err())
+	}
+	aggregate.Week = fmt.Sprintf("%d-W%02d", year, week)
+	aggregate.StartDate = start.Format(dateLayout)
+	aggregate.EndDate = start.AddDate(0, 0, 6).Format(dateLayout)
+	aggregate.Currency = currency
+
+	s.logger.Info("calculated weekly aggregate",
+		slog.String("week", aggregate.Week),
+		slog.String("income", aggregate.Income.String()),
+		slog.String("spending", aggregate.Spending.String()),
+		slog.String("net", aggregate.NetTotal.String()))
+
+	return aggregate, nil
+}
+
+// GetRangeAggregate totals transactions dated from start to end inclusive. The
+// sums are computed in SQL rather than over loaded rows.
+func (s *service) GetRangeAggregate(ctx context.Context, start, end time.Time, currency string) (*AggregatedData, error) {
+	if start.After(end) {
+		return nil, apperror.Invalid(apperror.CodeInvalidParameter, "start must not be after end")
+	}
+
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.AggregateTimeout)
+	defer cancel()
+
+	totals, err := s.repo.AggregateByRange(ctx, userID, start, end)
+	if err != nil {
+		s.logger.Error("failed to aggregate transactions by range",
+			slog.String("error", err.Error()),
+			slog.String("start", start.Format(dateLayout)),
+			slog.String("end", end.Format(dateLayout)))
+		return nil, aggregateError(ctx, "aggregating transactions by range", err)
+	}
+
+	aggregate, err := summarizeTotals(totals, currency, false)
+	if err != nil {
+		return nil, err
+	}
+	aggregate.StartDate = start.Format(dateLayout)
+	aggregate.EndDate = end.Format(dateLayout)
+
+	s.logger.Info("calculated range aggregate",
+		slog.String("start", aggregate.StartDate),
+		slog.String("end", aggregate.EndDate),
+		slog.String("income", aggregate.Income.String()),
+		slog.String("spending", aggregate.Spending.String()),
+		slog.String("net", aggregate.NetTotal.String()))
+
+	return aggregate, nil
+}
+
+// GetLifetimeAggregate sums every transaction the user has in one currency,
+// which may be omitted when they only use one. With no transactions all
+// totals are zero.
+func (s *service) GetLifetimeAggregate(ctx context.Context, currency string) (*LifetimeAggregate, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.AggregateTimeout)
+	defer cancel()
+
+	totals, err := s.repo.AggregateLifetime(ctx, userID)
+	if err != nil {
+		s.logger.Error("failed to aggregate lifetime totals", slog.String("error", err.Error()))
+		return nil, aggregateError(ctx, "aggregating lifetime totals", err)
+	}
+
+	if currency, err = aggregateCurrency(currency); err != nil {
+		return nil, err
+	}
+	if currency == "" {
+		seen := make(map[string]bool)
+		for _, t := range totals {
+			seen[t.Currency] = true
+		}
+		if currency, err = onlyCurrency(seen); err != nil {
+			return nil, err
+		}
+	}
+
+	aggregate := &LifetimeAggregate{Currency: currency}
+	var first, last time.Time
+	for _, t := range totals {
+		if t.Currency != currency {
+			continue
+		}
+		switch t.Type {
+		case TransactionTypeEarning:
+			aggregate.Income += t.Total
+		case TransactionTypeSpending:
+			aggregate.Spending += t.Total
+		}
+		aggregate.Count += t.Count
+		if first.IsZero() || t.FirstDate.Before(first) {
+			first = t.FirstDate
+		}
+		if t.LastDate.After(last) {
+			last = t.LastDate
+		}
+	}
+	aggregate.NetTotal = aggregate.Income - aggregate.Spending
+	if aggregate.Count > 0 {
+		aggregate.FirstDate = first.Format(dateLayout)
+		aggregate.LastDate = last.Format(dateLayout)
+	}
+
+	return aggregate, nil
+}
+
+func (s *service) GetYearlyAggregate(ctx context.Context, year int, currency string) (*YearlyAggregatedData, error) {
+	if year < minAggregateYear || year > maxAggregateYear {
+		return nil, apperror.Invalid(apperror.CodeInvalidParameter, "year must be between %d and %d", minAggregateYear, maxAggregateYear)
+	}
+
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.AggregateTimeout)
+	defer cancel()
+
+	transactions, err := s.repo.GetByYear(ctx, userID, year)
+	if err != nil {
+		s.logger.Error("failed to get yearly transactions",
+			slog.String("error", err.Error()),
+			slog.Int("year", year))
+		return nil, aggregateError(ctx, "getting yearly transactions", err)
+	}
+
+	transactions, currency, err = selectCurrency(transactions, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	months := make([]AggregatedData, 12)
+	for i := range months {
+		months[i].Month = fmt.Sprintf("%d-%02d", year, i+1)
+	}
+
+	for _, t := range transactions {
+		m := &months[t.Date.Month()-1]
+		m.Count++
+		switch t.Type {
+		case TransactionTypeEarning:
+			m.Income += t.Amount
+		case TransactionTypeSpending:
+			m.Spending += t.Amount
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil, aggregateError(ctx, "summing yearly transactions", ctx.Err())
+	}
+
+	aggregate := &YearlyAggregatedData{
+		Year:     year,
+		Currency: currency,
+		Months:   months,
+	}
+	for i := range months {
+		months[i].NetTotal = months[i].Income - months[i].Spending
+		aggregate.Income += months[i].Income
+		aggregate.Spending += months[i].Spending
+		aggregate.Count += months[i].Count
+	}
+	aggregate.NetTotal = aggregate.Income - aggregate.Spending
+
+	s.logger.Info("calculated yearly aggregate",
+		slog.Int("year", year),
+		slog.String("income", aggregate.Income.String()),
+		slog.String("spending", aggregate.Spending.String()),
+		slog.String("net", aggregate.NetTotal.String()))
+
+	return aggregate, nil
+}
+
+func (s *service) GetRollingSpending(ctx context.Context, window int, from, to time.Time, currency string) (*RollingSpending, error) {
+	if window < 1 || window > maxRollingWindow {
+		return nil, apperror.Invalid(apperror.CodeInvalidParameter, "window must be between 1 and %d days", maxRollingWindow)
+	}
+
+	if err := checkStatsRange(from, to); err != nil {
+		return nil, err
+	}
+
+	currency, err := aggregateCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch enough history before from so the first day has a full window
+	start := from.AddDate(0, 0, -(window - 1))
+	ctx, cancel := context.WithTimeout(ctx, s.config.AggregateTimeout)
+	defer cancel()
+
+	sums, err := s.repo.SumByDay(ctx, userID, start, to)
+	if err != nil {
+		s.logger.Error("failed to get daily sums",
+			slog.String("error", err.Error()),
+			slog.Int("window", window))
+		return nil, aggregateError(ctx, "getting daily sums", err)
+	}
+
+	// Like the other aggregates, never sum across currencies
+	if currency == "" {
+		seen := make(map[string]bool)
+		for _, d := range sums {
+			seen[d.Currency] = true
+		}
+		if currency, err = onlyCurrency(seen); err != nil {
+			return nil, err
+		}
+	}
+
+	daily := make(map[string]Money, len(sums))
+	for _, d := range sums {
+		if d.Currency == currency {
+			daily[d.Date.Format(dateLayout)] = d.Spending
+		}
+	}
+
+	totals := []RollingTotal{}
+	var running Money
+	for day := start; !day.After(to); day = day.AddDate(0, 0, 1) {
+		running += daily[day.Format(dateLayout)]
+		if dropped := day.AddDate(0, 0, -window); !dropped.Before(start) {
+			running -= daily[dropped.Format(dateLayout)]
+		}
+
+		if !day.Before(from) {
+			totals = append(totals, RollingTotal{
+				Date:  day.Format(dateLayout),
+				Total: running,
+			})
+		}
+	}
+
+	return &RollingSpending{
+		Window:   window,
+		Currency: currency,
+		From:     from.Format(dateLayout),
+		To:       to.Format(dateLayout),
+		Totals:   totals,
+	}, nil
+}
+
+func (s *service) GetCadence(ctx context.Context, from, to time.Time) (*CadenceStats, error) {
+	if err := checkStatsRange(from, to); err != nil {
+		return nil, err
+	}
+
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.AggregateTimeout)
+	defer cancel()
+
+	dates, err := s.repo.ListDates(ctx, userID, from, to)
+	if err != nil {
+		s.logger.Error("failed to list transaction dates", slog.String("error", err.Error()))
+		return nil, aggregateError(ctx, "listing transaction dates", err)
+	}
+
+	stats := &CadenceStats{
+		From:  from.Format(dateLayout),
+		To:    to.Format(dateLayout),
+		Count: len(dates),
+	}
+
+	if len(dates) < 2 {
+		return stats, nil
+	}
+
+	minGap, maxGap, totalGap := -1, 0, 0
+	for i := 1; i < len(dates); i++ {
+		gap := int(dates[i].Sub(dates[i-1]).Hours() / 24)
+		if minGap < 0 || gap < minGap {
+			minGap = gap
+		}
+		if gap > maxGap {
+			maxGap = gap
+		}
+		totalGap += gap
+	}
+
+	average := float64(totalGap) / float64(len(dates)-1)
+	stats.AverageGapDays = &average
+	stats.MinGapDays = &minGap
+	stats.MaxGapDays = &maxGap
+
+	return stats, nil
+}
+
+// GetCategoryCostRate spreads a category's spending from from to to inclusive
+// evenly over the period, giving what it costs per day and per month. Like the
+// other aggregates, spending in several currencies needs a currency.
+func (s *service) GetCategoryCostRate(ctx context.Context, category string, from, to time.Time, currency string) (*CategoryCostRate, error) {
+	category = strings.TrimSpace(category)
+	if category == "" {
+		return nil, apperror.Invalid(apperror.CodeInvalidParameter, "category is required")
+	}
+
+	// The period is inclusive, so it is at least one day long and the rates
+	// never divide by zero
+	if from.After(to) {
+		return nil, apperror.Invalid(apperror.CodeInvalidParameter, "from must not be after to")
+	}
+
+	currency, err := aggregateCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.AggregateTimeout)
+	defer cancel()
+
+	summaries, err := s.repo.SumByCategory(ctx, userID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		s.logger.Error("failed to sum category spending",
+			slog.String("error", err.Error()),
+			slog.String("category", category))
+		return nil, aggregateError(ctx, "summing category spending", err)
+	}
+
+	totals := make(map[string]Money)
+	seen := make(map[string]bool)
+	for _, summary := range summaries {
+		if summary.Category != category || summary.Spending == 0 {
+			continue
+		}
+		totals[summary.Currency] += summary.Spending
+		seen[summary.Currency] = true
+	}
+
+	if currency == "" {
+		if currency, err = onlyCurrency(seen); err != nil {
+			return nil, err
+		}
+	}
+
+	days := int(to.Sub(from).Hours()/24) + 1
+	total := totals[currency]
+
+	return &CategoryCostRate{
+		Category: category,
+		Currency: currency,
+		From:     from.Format(dateLayout),
+		To:       to.Format(dateLayout),
+		Days:     days,
+		Total:    total,
+		PerDay:   Money(math.Round(float64(total) / float64(days))),
+		PerMonth: Money(math.Round(float64(total) * daysPerMonth / float64(days))),
+	}, nil
+}
+
+// GetNetWorthForecast projects the balance of currency, as of today, over the
+// next horizonMonths month ends. The balance is the running balance of the
+// latest transaction dated up to today, and each month end adds the income and
+// spending dated after today up to it. Without future-dated transactions the
+// projection is flat.
+func (s *service) GetNetWorthForecast(ctx context.Context, horizonMonths int, currency string) (*NetWorthForecast, error) {
+	if horizonMonths < 1 || horizonMonths > maxForecastMonths {
+		return nil, apperror.Invalid(apperror.CodeInvalidParameter, "horizon_months must be between 1 and %d", maxForecastMonths)
+	}
+
+	currency, err := aggregateCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.AggregateTimeout)
+	defer cancel()
+
+	// Like the other aggregates, a user with one currency needn't name it
+	if currency == "" {
+		totals, err := s.repo.AggregateLifetime(ctx, userID)
+		if err != nil {
+			s.logger.Error("failed to aggregate lifetime totals", slog.String("error", err.Error()))
+			return nil, aggregateError(ctx, "aggregating lifetime totals", err)
+		}
+
+		seen := make(map[string]bool)
+		for _, t := range totals {
+			seen[t.Currency] = true
+		}
+		if currency, err = onlyCurrency(seen); err != nil {
+			return nil, err
+		}
+	}
+
+	today := s.today()
+	latest, err := s.repo.ListWithBalance(ctx, userID, ListFilter{Currency: currency, EndDate: today}, ListSort{}, 1, 0)
+	if err != nil {
+		s.logger.Error("failed to get running balance", slog.String("error", err.Error()))
+		return nil, aggregateError(ctx, "getting running balance", err)
+	}
+
+	var balance Money
+	if len(latest) > 0 && latest[0].RunningBalance != nil {
+		balance = *latest[0].RunningBalance
+	}
+
+	month := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	future, err := s.repo.AggregateByDay(ctx, userID, today.AddDate(0, 0, 1), month.AddDate(0, horizonMonths, 0))
+	if err != nil {
+		s.logger.Error("failed to aggregate future transactions", slog.String("error", err.Error()))
+		return nil, aggregateError(ctx, "aggregating future transactions", err)
+	}
+
+	forecast := &NetWorthForecast{
+		Currency:      currency,
+		AsOf:          today.Format(dateLayout),
+		Balance:       balance,
+		HorizonMonths: horizonMonths,
+		Months:        make([]MonthForecast, horizonMonths),
+	}
+
+	// The days come back in date order, so each month end carries the
+	// balance forward and adds the days before the next month starts
+	projected, next := balance, 0
+	for i := range forecast.Months {
+		monthEnd := month.AddDate(0, i+1, 0)
+		for ; next < len(future) && future[next].Date.Before(monthEnd); next++ {
+			if d := future[next]; d.Currency == currency {
+				projected += d.Income - d.Spending
+			}
+		}
+		forecast.Months[i] = MonthForecast{
+			Month:   month.AddDate(0, i, 0).Format("2006-01"),
+			Balance: projected,
+		}
+	}
+
+	return forecast, nil
+}
+
+// DeleteTransaction soft-deletes a transaction. Its image stays in S3 so a
+// restore keeps the receipt; removing images is left to a purge job.
+func (s *service) DeleteTransaction(ctx context.Context, id uuid.UUID) error {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return err
+	}
+
+	date, err := s.repo.Delete(ctx, userID, id)
+	if err != nil {
+		return fmt.Errorf("deleting transaction: %w", err)
+	}
+	s.aggregates.invalidate(userID, date)
+
+	// The transaction is already deleted, so upload bookkeeping failures are
+	// only logged
+	if err := s.uploadService.ReleaseTransactionUploads(ctx, id); err != nil {
+		s.logger.Warn("failed to release transaction uploads",
+			slog.String("error", err.Error()),
+			slog.String("id", id.String()))
+	}
+
+	s.logger.Info("transaction deleted",
+		slog.String("id", id.String()))
+
+	return nil
+}
+
+func (s *service) RestoreTransaction(ctx context.Context, id uuid.UUID) (*Transaction, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Restore(ctx, userID, id); err != nil {
+		return nil, fmt.Errorf("restoring transaction: %w", err)
+	}
+	// The restored date isn't known yet, so drop the user's cached months
+	s.aggregates.invalidateUser(userID)
+
+	s.logger.Info("transaction restored",
+		slog.String("id", id.String()))
+
+	return s.GetTransaction(ctx, id)
+}
+
+// ReverseTransaction records a correction of a transaction without changing
+// it: a new transaction of the opposite type for the same amount, currency,
+// category and tags, dated today and linked to the original by ReversesID.
+// A transaction can only have one reversal at a time.
+func (s *service) ReverseTransaction(ctx context.Context, id uuid.UUID) (*Transaction, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting transaction: %w", err)
+	}
+
+	reversedType := TransactionTypeSpending
+	if original.Type == TransactionTypeSpending {
+		reversedType = TransactionTypeEarning
+	}
+
+	description := "Reversal of transaction " + original.ID.String()
+	if original.Description != "" {
+		description = "Reversal of " + original.Description
+	}
+	if runes := []rune(description); len(runes) > s.config.MaxDescriptionLength {
+		description = string(runes[:s.config.MaxDescriptionLength])
+	}
+
+	now := s.now()
+	reversal := &Transaction{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Date:        s.today(),
+		Amount:      original.Amount,
+		Currency:    original.Currency,
+		Type:        reversedType,
+		Category:    original.Category,
+		Description: description,
+		Merchant:    original.Merchant,
+		Tags:        original.Tags,
+		ReversesID:  &original.ID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err := s.repo.Create(ctx, reversal); err != nil {
+		return nil, fmt.Errorf("creating reversal: %w", err)
+	}
+	s.aggregates.invalidate(userID, reversal.Date)
+
+	s.logger.Info("transaction reversed",
+		slog.String("id", original.ID.String()),
+		slog.String("reversal_id", reversal.ID.String()))
+
+	s.notifier.Notify("transaction.created", reversal)
+
+	return reversal, nil
+}
+
+// PatchTransaction changes only the fields present in req, validating each
+// with the same rules as create. Changing the description also updates the
+// merchant derived from it.
+func (s *service) PatchTransaction(ctx context.Context, id uuid.UUID, req PatchTransactionRequest) (*Transaction, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := s.transactionPatch(req)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction, err := s.repo.Update(ctx, userID, id, patch)
+	if err != nil {
+		return nil, fmt.Errorf("updating transaction: %w", err)
+	}
+
+	// A changed date moves the transaction out of a month that isn't known
+	// here, so drop all of the user's cached months
+	if patch.Date != nil {
+		s.aggregates.invalidateUser(userID)
+	} else {
+		s.aggregates.invalidate(userID, transaction.Date)
+	}
+
+	if err := s.loadAttachments(ctx, []*Transaction{transaction}); err != nil {
+		return nil, err
+	}
+	s.attachImageURL(ctx, transaction)
+
+	s.logger.Info("transaction updated",
+		slog.String("id", id.String()))
+
+	s.notifier.Notify("transaction.updated", transaction)
+
+	return transaction, nil
+}
+
+// transactionPatch validates the fields set in req. Nulls clear the optional
+// text fields and tags and are rejected for the rest.
+func (s *service) transactionPatch(req PatchTransactionRequest) (TransactionPatch, error) {
+	var patch TransactionPatch
+	empty := ""
+
+	for _, field := range []string{"date", "amount", "currency", "type"} {
+		if req.nulls[field] {
+			return patch, apperror.Invalid(apperror.CodeInvalidRequest, "%s cannot be null", field)
+		}
+	}
+
+	if req.Date != nil {
+		date, err := s.parseDate(*req.Date)
+		if err != nil {
+			return patch, err
+		}
+		patch.Date = &date
+	}
+
+	if req.Amount != nil {
+		if err := validateAmount(*req.Amount); err != nil {
+			return patch, err
+		}
+		patch.Amount = req.Amount
+	}
+
+	if req.Currency != nil {
+		currency, err := NormalizeCurrency(*req.Currency)
+		if err != nil {
+			return patch, err
+		}
+		patch.Currency = &currency
+	}
+
+	if req.Type != nil {
+		if err := validateType(*req.Type); err != nil {
+			return patch, err
+		}
+		patch.Type = req.Type
+	}
+
+	if req.Category != nil {
+		category := strings.TrimSpace(*req.Category)
+		patch.Category = &category
+	} else if req.nulls["category"] {
+		patch.Category = &empty
+	}
+
+	if req.Description != nil || req.nulls["description"] {
+		var description string
+		if req.Description != nil {
+			var err error
+			if description, err = normalizeDescription(*req.Description, s.config.MaxDescriptionLength); err != nil {
+				return patch, err
+			}
+		}
+		merchant := normalizeMerchant(description)
+		patch.Description = &description
+		patch.Merchant = &merchant
+	}
+
+	if req.Notes != nil {
+		if err := validateNotes(*req.Notes); err != nil {
+			return patch, err
+		}
+		patch.Notes = req.Notes
+	} else if req.nulls["notes"] {
+		patch.Notes = &empty
+	}
+
+	if req.Tags != nil || req.nulls["tags"] {
+		var tags []string
+		if req.Tags != nil {
+			tags = *req.Tags
+		}
+		normalized, err := normalizeTags(tags)
+		if err != nil {
+			return patch, err
+		}
+		patch.Tags = &normalized
+	}
+
+	if patch == (TransactionPatch{}) {
+		return patch, apperror.Invalid(apperror.CodeInvalidRequest, "no fields to update")
+	}
+
+	return patch, nil
+}
+
+// AddAttachment links an upload to an existing transaction as its next
+// attachment.
+func (s *service) AddAttachment(ctx context.Context, transactionID uuid.UUID, uploadID string) (*Attachment, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check ownership before the upload is moved out of staging
+	if _, err := s.repo.GetByID(ctx, userID, transactionID); err != nil {
+		return nil, fmt.Errorf("getting transaction: %w", err)
+	}
+
+	linked, err := s.uploadService.VerifyUpload(ctx, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("verifying upload: %w", err)
+	}
+
+	attachment := s.newAttachment(transactionID, linked.Key, linked.ThumbnailKey, linked.ContentType)
+	if err := s.repo.AddAttachment(ctx, userID, &attachment); err != nil {
+		// The upload has left staging, so nothing else will remove its objects
+		s.discardImage(ctx, linked.Key)
+		if linked.ThumbnailKey != "" {
+			s.discardImage(ctx, linked.ThumbnailKey)
+		}
+		return nil, fmt.Errorf("adding attachment: %w", err)
+	}
+	s.linkUpload(ctx, uploadID, transactionID)
+
+	attachment.URL = s.presign(ctx, attachment.Key)
+	attachment.ThumbnailURL = s.presign(ctx, attachment.ThumbnailKey)
+
+	s.logger.Info("attachment added",
+		slog.String("id", attachment.ID.String()),
+		slog.String("transaction_id", transactionID.String()),
+		slog.Int("position", attachment.Position))
+
+	return &attachment, nil
+}
+
+// RemoveAttachment detaches an attachment and deletes its objects. Object
+// deletion failures are only logged, since the attachment is already gone.
+func (s *service) RemoveAttachment(ctx context.Context, transactionID uuid.UUID, attachmentID uuid.UUID) error {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return err
+	}
+
+	attachment, err := s.repo.DeleteAttachment(ctx, userID, transactionID, attachmentID)
+	if err != nil {
+		return fmt.Errorf("deleting attachment: %w", err)
+	}
+
+	for _, key := range []string{attachment.Key, attachment.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := s.s3Service.DeleteImage(ctx, key); err != nil {
+			s.logger.Warn("failed to delete attachment object",
+				slog.String("error", err.Error()),
+				slog.String("key", key))
+		}
+	}
+
+	s.logger.Info("attachment removed",
+		slog.String("id", attachmentID.String()),
+		slog.String("transaction_id", transactionID.String()))
+
+	return nil
+}
+
+// loadAttachments sets Attachments on each transaction from one query.
+// Transactions without a primary image have no attachments, so they're
+// skipped.
+func (s *service) loadAttachments(ctx context.Context, transactions []*Transaction) error {
+	ids := make([]uuid.UUID, 0, len(transactions))
+	for _, t := range transactions {
+		if t.ImageKey != "" {
+			ids = append(ids, t.ID)
+		}
+	}
+
+	attachments, err := s.repo.ListAttachments(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("loading attachments: %w", err)
+	}
+
+	for _, t := range transactions {
+		t.Attachments = attachments[t.ID]
+	}
+
+	return nil
+}
+
+// attachImageURL sets presigned ImageURL and ThumbnailURL for the keys the
+// transaction and its attachments have. Presign failures are logged and leave
+// the URL empty.
+func (s *service) attachImageURL(ctx context.Context, t *Transaction) {
+	t.ImageURL = s.presign(ctx, t.ImageKey)
+	t.ThumbnailURL = s.presign(ctx, t.ThumbnailKey)
+
+	for i := range t.Attachments {
+		a := &t.Attachments[i]
+		a.URL = s.presign(ctx, a.Key)
+		a.ThumbnailURL = s.presign(ctx, a.ThumbnailKey)
+	}
+}
+
+func (s *service) presign(ctx context.Context, key string) string {
+	if key == "" {
+		return ""
+	}
+
+	url, err := s.s3Service.GetPresignedURL(ctx, key)
+	if err != nil {
+		s.logger.Warn("failed to generate presigned URL",
+			slog.String("error", err.Error()),
+			slog.String("key", key))
+		return ""
+	}
+	return url
+}
+
+// summarize totals income and spending, with spending broken down by category.
+func summarize(transactions []*Transaction) *AggregatedData {
+	aggregate := &AggregatedData{
+		ByCategory: make(map[string]Money),
+	}
+
+	for _, t := range transactions {
+		switch t.Type {
+		case TransactionTypeEarning:
+			aggregate.Income += t.Amount
+		case TransactionTypeSpending:
+			aggregate.Spending += t.Amount
+			aggregate.ByCategory[t.Category] += t.Amount
+		}
+	}
+	aggregate.NetTotal = aggregate.Income - aggregate.Spending
+	aggregate.Count = int64(len(transactions))
+
+	return aggregate
+}
+
+// summarizeTotals combines SQL aggregate totals into an AggregatedData, with
+// spending broken down by category when byCategory is set and the totals were
+// grouped by category. Like selectCurrency, totals in several currencies
+// require a currency to be given.
+func summarizeTotals(totals []AggregateTotal, currency string, byCategory bool) (*AggregatedData, error) {
+	currency, err := aggregateCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+	if currency == "" {
+		seen := make(map[string]bool)
+		for _, t := range totals {
+			seen[t.Currency] = true
+		}
+		if currency, err = onlyCurrency(seen); err != nil {
+			return nil, err
+		}
+	}
+
+	aggregate := &AggregatedData{Currency: currency}
+	if byCategory {
+		aggregate.ByCategory = make(map[string]Money)
+	}
+	for _, t := range totals {
+		if t.Currency != currency {
+			continue
+		}
+		switch t.Type {
+		case TransactionTypeEarning:
+			aggregate.Income += t.Total
+		case TransactionTypeSpending:
+			aggregate.Spending += t.Total
+			if byCategory {
+				aggregate.ByCategory[t.Category] += t.Total
+			}
+		}
+		aggregate.Count += t.Count
+	}
+	aggregate.NetTotal = aggregate.Income - aggregate.Spending
+
+	return aggregate, nil
+}
+
+// isoWeekStart returns the Monday of the given ISO 8601 week. January 4th
+// always falls in week 1.
+func isoWeekStart(year, week int) time.Time {
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+	offset := (int(jan4.Weekday()) + 6) % 7
+	return jan4.AddDate(0, 0, -offset+(week-1)*7)
+}
+
+// selectCurrency keeps the transactions in the requested currency so amounts
+// are never summed across currencies. With no currency requested it succeeds
+// only when all transactions share one currency, which it returns.
+func selectCurrency(transactions []*Transaction, currency string) ([]*Transaction, string, error) {
+	currency, err := aggregateCurrency(currency)
+	if err != nil {
+		return nil, "", err
+	}
+	if currency != "" {
+		selected := make([]*Transaction, 0, len(transactions))
+		for _, t := range transactions {
+			if t.Currency == currency {
+				selected = append(selected, t)
+			}
+		}
+		return selected, currency, nil
+	}
+
+	seen := make(map[string]bool)
+	for _, t := range transactions {
+		seen[t.Currency] = true
+	}
+
+	currency, err = onlyCurrency(seen)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return transactions, currency, nil
+}
+
+// checkStatsRange rejects a from-to range, inclusive, that is inverted or
+// spans more than maxStatsDays days.
+func checkStatsRange(from, to time.Time) error {
+	if from.After(to) {
+		return apperror.Invalid(apperror.CodeInvalidParameter, "from must not be after to")
+	}
+	if days := int(to.Sub(from).Hours()/24) + 1; days > maxStatsDays {
+		return apperror.Invalid(apperror.CodeInvalidParameter, "from and to must span at most %d days", maxStatsDays)
+	}
+	return nil
+}
+
+// aggregateCurrency validates the currency requested for an aggregate. Unlike
+// NormalizeCurrency it keeps an empty currency empty, since aggregates then
+// use the one currency the transactions share.
+func aggregateCurrency(value string) (string, error) {
+	if strings.TrimSpace(value) == "" {
+		return "", nil
+	}
+	return NormalizeCurrency(value)
+}
+
+// onlyCurrency returns the single currency in seen, "" when it is empty, and
+// an error naming the currencies when there are several.
+func onlyCurrency(seen map[string]bool) (string, error) {
+	if len(seen) > 1 {
+		currencies := make([]string, 0, len(seen))
+		for c := range seen {
+			currencies = append(currencies, c)
+		}
+		sort.Strings(currencies)
+		return "", apperror.Invalid(apperror.CodeCurrencyRequired, "transactions span multiple currencies (%s), specify a currency", strings.Join(currencies, ", "))
+	}
+
+	for c := range seen {
+		return c, nil
+	}
+	return "", nil
+}
+
+// attachImageURLs presigns image URLs for a page of transactions concurrently.
+// Each goroutine writes only its own transaction, so ordering is preserved.
+func (s *service) attachImageURLs(ctx context.Context, transactions []*Transaction) {
+	var g errgroup.Group
+	g.SetLimit(presignConcurrency)
+
+	for _, t := range transactions {
+		if t.ImageKey == "" {
+			continue
+		}
+		g.Go(func() error {
+			s.attachImageURL(ctx, t)
+			return nil
+		})
+	}
+
+	_ = g.Wait()
+}
+
+// aggregateError wraps an aggregate failure, reporting ErrAggregateTimeout
+// when the aggregate deadline expired. The driver surfaces a cancelled query
+// as its own error, so the context is checked rather than err itself.
+func aggregateError(ctx context.Context, msg string, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s: %w", msg, ErrAggregateTimeout)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+func (s *service) newAttachment(transactionID uuid.UUID, key, thumbnailKey, contentType string) Attachment {
+	return Attachment{
+		ID:            uuid.New(),
+		TransactionID: transactionID,
+		Key:           key,
+		ThumbnailKey:  thumbnailKey,
+		ContentType:   contentType,
+		CreatedAt:     s.now(),
+	}
+}
+
+// newTransaction validates a create request and builds the transaction it
+// describes for userID. It is shared by single creates and imports.
+func (s *service) newTransaction(userID uuid.UUID, req CreateTransactionRequest) (*Transaction, error) {
+	if err := validateAmount(req.Amount); err != nil {
+		return nil, err
+	}
+
+	if err := validateType(req.Type); err != nil {
+		return nil, err
+	}
+
+	date, err := s.parseDate(req.Date)
+	if err != nil {
+		return nil, err
+	}
+
+	currency, err := NormalizeCurrency(req.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	description, err := normalizeDescription(req.Description, s.config.MaxDescriptionLength)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateNotes(req.Notes); err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	return &Transaction{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Date:        date,
+		Amount:      req.Amount,
+		Currency:    currency,
+		Type:        req.Type,
+		Category:    strings.TrimSpace(req.Category),
+		Description: description,
+		Notes:       req.Notes,
+		Merchant:    normalizeMerchant(description),
+		Tags:        tags,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
+
+func validateAmount(amount Money) error {
+	if amount <= 0 {
+		return apperror.Invalid(apperror.CodeInvalidAmount, "amount must be greater than 0")
+	}
+	return nil
+}
+
+func validateType(t TransactionType) error {
+	if t != TransactionTypeSpending && t != TransactionTypeEarning {
+		return apperror.Invalid(apperror.CodeInvalidType, "invalid transaction type: %s", t)
+	}
+	return nil
+}
+
+// parseDate parses a YYYY-MM-DD transaction date, rejecting dates after today
+// in the application timezone unless they are allowed.
+func (s *service) parseDate(value string) (time.Time, error) {
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, apperror.Invalid(apperror.CodeInvalidDate, "invalid date format, expected YYYY-MM-DD")
+	}
+
+	if !s.config.AllowFutureDates {
+		if date.After(s.today()) {
+			return time.Time{}, apperror.Invalid(apperror.CodeInvalidDate, "date cannot be in the future")
+		}
+	}
+
+	return date, nil
+}
+
+// NormalizeCurrency upper-cases a currency code, defaulting an empty one, and
+// rejects codes outside supportedCurrencies. Budgets validate with it too, so
+// they accept the same currencies as transactions.
+func NormalizeCurrency(value string) (string, error) {
+	currency := strings.ToUpper(strings.TrimSpace(value))
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	if !supportedCurrencies[currency] {
+		return "", apperror.Invalid(apperror.CodeInvalidCurrency, "unsupported currency: %s", value)
+	}
+	return currency, nil
+}
+
+func validateNotes(notes string) error {
+	if utf8.RuneCountInString(notes) > maxNotesLength {
+		return apperror.Invalid(apperror.CodeInvalidNotes, "notes must be at most %d characters", maxNotesLength)
+	}
+	return nil
+}
+
+func (m FieldMapping) withDefaults() FieldMapping {
+	if m.Amount == "" {
+		m.Amount = "amount"
+	}
+	if m.Currency == "" {
+		m.Currency = "currency"
+	}
+	if m.Date == "" {
+		m.Date = "date"
+	}
+	if m.Type == "" {
+		m.Type = "type"
+	}
+	if m.Category == "" {
+		m.Category = "category"
+	}
+	if m.Description == "" {
+		m.Description = "description"
+	}
+	return m
+}
+
+// ofxCreateRequest maps a statement entry to a create request, taking the
+// type from the sign of the amount.
+func ofxCreateRequest(entry importer.Entry) (CreateTransactionRequest, error) {
+	var req CreateTransactionRequest
+	if entry.Err != nil {
+		return req, entry.Err
+	}
+
+	amount, err := ParseMoney(entry.Amount)
+	if err != nil {
+		return req, err
+	}
+	req.Type = TransactionTypeEarning
+	if amount < 0 {
+		req.Type = TransactionTypeSpending
+		amount = -amount
+	}
+	req.Amount = amount
+
+	req.Date = entry.Date.Format(dateLayout)
+	req.Currency = entry.Currency
+	req.Description = entry.Memo
+	if req.Description == "" {
+		req.Description = entry.Name
+	}
+	return req, nil
+}
+
+func (m FieldMapping) toCreateRequest(item map[string]any) (CreateTransactionRequest, error) {
+	var req CreateTransactionRequest
+
+	switch v := item[m.Amount].(type) {
+	case float64:
+		amount, err := AmountFromFloat(v)
+		if err != nil {
+			return req, err
+		}
+		req.Amount = amount
+	case string:
+		amount, err := ParseMoney(strings.TrimSpace(v))
+		if err != nil {
+			return req, err
+		}
+		req.Amount = amount
+	case nil:
+		return req, fmt.Errorf("missing field %q", m.Amount)
+	default:
+		return req, fmt.Errorf("invalid amount type for field %q", m.Amount)
+	}
+
+	if currency, ok := item[m.Currency].(string); ok {
+		req.Currency = currency
+	}
+
+	date, ok := item[m.Date].(string)
+	if !ok {
+		return req, fmt.Errorf("missing or non-string field %q", m.Date)
+	}
+	req.Date = date
+
+	txType, ok := item[m.Type].(string)
+	if !ok {
+		return req, fmt.Errorf("missing or non-string field %q", m.Type)
+	}
+	req.Type = TransactionType(strings.ToLower(txType))
+
+	if category, ok := item[m.Category].(string); ok {
+		req.Category = category
+	}
+
+	if description, ok := item[m.Description].(string); ok {
+		req.Description = description
+	}
+
+	return req, nil
+}
+
+// discardImage deletes an uploaded image that no transaction was stored for.
+// A failure only leaves an orphaned object behind, so it is logged.
+// discardUnusedImages deletes the image and thumbnail stored for a
+// transaction that was never inserted, except any that kept, the transaction
+// stored in its place, also references.
+func (s *service) discardUnusedImages(ctx context.Context, transaction, kept *Transaction) {
+	for _, key := range []string{transaction.ImageKey, transaction.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if kept != nil && (key == kept.ImageKey || key == kept.ThumbnailKey) {
+			continue
+		}
+		s.discardImage(ctx, key)
+	}
+}
+
+func (s *service) discardImage(ctx context.Context, key string) {
+	if err := s.s3Service.DeleteImage(ctx, key); err != nil {
+		s.logger.Warn("failed to delete unused image",
+			slog.String("error", err.Error()),
+			slog.String("key", key))
+	}
 }
 
 func (s *service) decodeBase64Image(base64Str string) ([]byte, string, error) {
@@ -259,7 +2260,7 @@ func (s *service) decodeBase64Image(base64Str string) ([]byte, string, error) {
 
 	imageData, err := base64.StdEncoding.DecodeString(data)
 	if err != nil {
-		return nil, "", fmt.Errorf("decoding base64: %w", err)
+		return nil, "", apperror.Invalid(apperror.CodeInvalidImage, "image_base64 is not valid base64")
 	}
 
 	return imageData, contentType, nil
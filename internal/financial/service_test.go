@@ -0,0 +1,1184 @@
+package financial
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
+	"github.com/kranti/cashflow/internal/auth"
+	"github.com/kranti/cashflow/internal/s3"
+	"github.com/kranti/cashflow/internal/upload"
+)
+
+// idempotencyRepo stands in for the database around an idempotent create. The
+// first key lookup misses; later ones find stored, as they would once a
+// concurrent request has committed it.
+type idempotencyRepo struct {
+	Repository
+	createErr error
+	stored    *Transaction
+	lookups   int
+	created   *Transaction
+	// cutoffs records the since and before of each key lookup and release
+	cutoffs []time.Time
+}
+
+func (r *idempotencyRepo) GetByIdempotencyKey(ctx context.Context, userID uuid.UUID, key string, since time.Time) (*Transaction, error) {
+	r.lookups++
+	r.cutoffs = append(r.cutoffs, since)
+	if r.lookups == 1 || r.stored == nil {
+		return nil, ErrTransactionNotFound
+	}
+	return r.stored, nil
+}
+
+func (r *idempotencyRepo) ReleaseIdempotencyKey(ctx context.Context, userID uuid.UUID, key string, before time.Time) error {
+	r.cutoffs = append(r.cutoffs, before)
+	return nil
+}
+
+func (r *idempotencyRepo) Create(ctx context.Context, transaction *Transaction) error {
+	if r.createErr != nil {
+		return r.createErr
+	}
+	r.created = transaction
+	return nil
+}
+
+func (r *idempotencyRepo) ListAttachments(ctx context.Context, transactionIDs []uuid.UUID) (map[uuid.UUID][]Attachment, error) {
+	return map[uuid.UUID][]Attachment{}, nil
+}
+
+// recordingUploads verifies every upload and records which get linked.
+type recordingUploads struct {
+	UploadService
+	links map[string]uuid.UUID
+}
+
+func (u *recordingUploads) VerifyUpload(ctx context.Context, uploadID string) (*upload.LinkedUpload, error) {
+	return &upload.LinkedUpload{Key: "transactions/" + uploadID + ".jpg", ContentType: "image/jpeg"}, nil
+}
+
+func (u *recordingUploads) LinkUpload(ctx context.Context, uploadID string, transactionID uuid.UUID) error {
+	u.links[uploadID] = transactionID
+	return nil
+}
+
+type presigningS3 struct {
+	s3.Service
+}
+
+func (presigningS3) GetPresignedURL(ctx context.Context, key string) (string, error) {
+	return "https://example.com/" + key, nil
+}
+
+type discardNotifier struct{}
+
+func (discardNotifier) Notify(event string, payload any) {}
+
+func TestCreateTransactionIdempotencyRace(t *testing.T) {
+	stored := &Transaction{ID: uuid.New(), Type: TransactionTypeSpending, Amount: 1250, IdempotencyKey: "key-1"}
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		createErr error
+		// wantStored expects the transaction the concurrent request stored
+		wantStored bool
+		wantErr    bool
+		wantLinked bool
+	}{
+		{name: "insert succeeds", wantLinked: true},
+		{name: "concurrent request won the insert", createErr: ErrIdempotencyKeyTaken, wantStored: true},
+		{name: "insert fails", createErr: errors.New("connection reset"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &idempotencyRepo{createErr: tt.createErr, stored: stored}
+			uploads := &recordingUploads{links: map[string]uuid.UUID{}}
+			s := &service{
+				repo:          repo,
+				s3Service:     &uploadingS3{},
+				uploadService: uploads,
+				notifier:      discardNotifier{},
+				config:        &Config{Location: time.UTC, MaxDescriptionLength: 255},
+				logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+				now:           func() time.Time { return now },
+			}
+			ctx := auth.WithUserID(context.Background(), uuid.New())
+
+			got, err := s.CreateTransaction(ctx, CreateTransactionRequest{
+				Date:           "2024-01-15",
+				Amount:         1250,
+				Type:           TransactionTypeSpending,
+				UploadID:       "upload-1",
+				IdempotencyKey: "key-1",
+			})
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("CreateTransaction succeeded, want an error")
+				}
+			} else if err != nil {
+				t.Fatalf("CreateTransaction: %v", err)
+			}
+			if tt.wantStored && got.ID != stored.ID {
+				t.Errorf("got transaction %s, want the stored %s", got.ID, stored.ID)
+			}
+			// Keys are looked up and released on the service's clock
+			for _, cutoff := range repo.cutoffs {
+				if !cutoff.Equal(now.Add(-idempotencyKeyTTL)) {
+					t.Errorf("idempotency cutoff = %s, want %s", cutoff, now.Add(-idempotencyKeyTTL))
+				}
+			}
+
+			transactionID, linked := uploads.links["upload-1"]
+			if linked != tt.wantLinked {
+				t.Fatalf("upload linked = %v, want %v", linked, tt.wantLinked)
+			}
+			if linked && transactionID != repo.created.ID {
+				t.Errorf("upload linked to %s, want the created %s", transactionID, repo.created.ID)
+			}
+			// Timestamps come from the service's clock too
+			if created := repo.created; created != nil {
+				if !created.CreatedAt.Equal(now) || !created.UpdatedAt.Equal(now) || !created.Attachments[0].CreatedAt.Equal(now) {
+					t.Errorf("created at %s, updated at %s, attached at %s, want %s",
+						created.CreatedAt, created.UpdatedAt, created.Attachments[0].CreatedAt, now)
+				}
+			}
+		})
+	}
+}
+
+// uploadingS3 stores every image under one key and records deletions.
+type uploadingS3 struct {
+	presigningS3
+	deleted []string
+}
+
+func (s *uploadingS3) UploadImage(ctx context.Context, imageData []byte, contentType string) (string, string, error) {
+	return "https://example.com/receipts/new.jpg", "receipts/new.jpg", nil
+}
+
+func (s *uploadingS3) DeleteImage(ctx context.Context, key string) error {
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+func TestCreateTransactionDiscardsUnusedImage(t *testing.T) {
+	stored := &Transaction{ID: uuid.New(), Type: TransactionTypeSpending, Amount: 1250, IdempotencyKey: "key-1", ImageKey: "receipts/winner.jpg"}
+
+	tests := []struct {
+		name        string
+		createErr   error
+		wantDeleted []string
+	}{
+		{name: "insert succeeds"},
+		{name: "concurrent request won the insert", createErr: ErrIdempotencyKeyTaken, wantDeleted: []string{"receipts/new.jpg"}},
+		{name: "insert fails", createErr: errors.New("connection reset"), wantDeleted: []string{"receipts/new.jpg"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &uploadingS3{}
+			s := &service{
+				repo:      &idempotencyRepo{createErr: tt.createErr, stored: stored},
+				s3Service: storage,
+				notifier:  discardNotifier{},
+				config:    &Config{Location: time.UTC, MaxDescriptionLength: 255},
+				logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+				now:       time.Now,
+			}
+			ctx := auth.WithUserID(context.Background(), uuid.New())
+
+			s.CreateTransaction(ctx, CreateTransactionRequest{
+				Date:           "2024-01-15",
+				Amount:         1250,
+				Type:           TransactionTypeSpending,
+				ImageBase64:    base64.StdEncoding.EncodeToString([]byte("image bytes")),
+				IdempotencyKey: "key-1",
+			})
+
+			if !reflect.DeepEqual(storage.deleted, tt.wantDeleted) {
+				t.Errorf("deleted %v, want %v", storage.deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+// thumbnailUploads verifies every upload with a thumbnail, as VerifyUpload
+// leaves them once moved out of staging.
+type thumbnailUploads struct {
+	recordingUploads
+}
+
+func (u *thumbnailUploads) VerifyUpload(ctx context.Context, uploadID string) (*upload.LinkedUpload, error) {
+	return &upload.LinkedUpload{
+		Key:          "transactions/" + uploadID + ".jpg",
+		ThumbnailKey: "transactions/thumb_" + uploadID + ".jpg",
+		ContentType:  "image/jpeg",
+	}, nil
+}
+
+func TestCreateTransactionDiscardsUnusedUpload(t *testing.T) {
+	moved := []string{"transactions/upload-1.jpg", "transactions/thumb_upload-1.jpg"}
+
+	tests := []struct {
+		name      string
+		createErr error
+		// stored is the transaction a concurrent request inserted
+		stored      *Transaction
+		wantDeleted []string
+	}{
+		{name: "insert succeeds"},
+		{name: "insert fails", createErr: errors.New("connection reset"), wantDeleted: moved},
+		{
+			name: "concurrent request won with another upload", createErr: ErrIdempotencyKeyTaken,
+			stored:      &Transaction{ID: uuid.New(), IdempotencyKey: "key-1", ImageKey: "transactions/upload-2.jpg"},
+			wantDeleted: moved,
+		},
+		{
+			name: "concurrent request won with the same upload", createErr: ErrIdempotencyKeyTaken,
+			stored: &Transaction{ID: uuid.New(), IdempotencyKey: "key-1", ImageKey: moved[0], ThumbnailKey: moved[1]},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &uploadingS3{}
+			s := &service{
+				repo:          &idempotencyRepo{createErr: tt.createErr, stored: tt.stored},
+				s3Service:     storage,
+				uploadService: &thumbnailUploads{recordingUploads{links: map[string]uuid.UUID{}}},
+				notifier:      discardNotifier{},
+				config:        &Config{Location: time.UTC, MaxDescriptionLength: 255},
+				logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+				now:           time.Now,
+			}
+			ctx := auth.WithUserID(context.Background(), uuid.New())
+
+			s.CreateTransaction(ctx, CreateTransactionRequest{
+				Date:           "2024-01-15",
+				Amount:         1250,
+				Type:           TransactionTypeSpending,
+				UploadID:       "upload-1",
+				IdempotencyKey: "key-1",
+			})
+
+			if !reflect.DeepEqual(storage.deleted, tt.wantDeleted) {
+				t.Errorf("deleted %v, want %v", storage.deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+// attachmentRepo owns every transaction and fails attachment inserts with err.
+type attachmentRepo struct {
+	Repository
+	err error
+}
+
+func (r *attachmentRepo) GetByID(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*Transaction, error) {
+	return &Transaction{ID: id, UserID: userID}, nil
+}
+
+func (r *attachmentRepo) AddAttachment(ctx context.Context, userID uuid.UUID, attachment *Attachment) error {
+	return r.err
+}
+
+func TestAddAttachmentDiscardsUnusedUpload(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantDeleted []string
+	}{
+		{name: "insert succeeds"},
+		{name: "insert fails", err: errors.New("connection reset"), wantDeleted: []string{"transactions/upload-1.jpg", "transactions/thumb_upload-1.jpg"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &uploadingS3{}
+			s := &service{
+				repo:          &attachmentRepo{err: tt.err},
+				s3Service:     storage,
+				uploadService: &thumbnailUploads{recordingUploads{links: map[string]uuid.UUID{}}},
+				config:        &Config{Location: time.UTC},
+				logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+				now:           time.Now,
+			}
+			ctx := auth.WithUserID(context.Background(), uuid.New())
+
+			_, err := s.AddAttachment(ctx, uuid.New(), "upload-1")
+			if (err != nil) != (tt.err != nil) {
+				t.Fatalf("AddAttachment err = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(storage.deleted, tt.wantDeleted) {
+				t.Errorf("deleted %v, want %v", storage.deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+// duplicatesRepo reports the transactions at the indexes in matches as
+// duplicates of existing, and records what it creates.
+type duplicatesRepo struct {
+	idempotencyRepo
+	matches  []int
+	existing uuid.UUID
+	batch    []*Transaction
+}
+
+func (r *duplicatesRepo) FindDuplicates(ctx context.Context, userID uuid.UUID, transactions []*Transaction, windowDays int) (map[int]uuid.UUID, error) {
+	duplicates := make(map[int]uuid.UUID)
+	for _, i := range r.matches {
+		duplicates[i] = r.existing
+	}
+	return duplicates, nil
+}
+
+func (r *duplicatesRepo) CreateBatch(ctx context.Context, transactions []*Transaction) error {
+	r.batch = transactions
+	return nil
+}
+
+func TestDuplicateCheckOffByDefault(t *testing.T) {
+	t.Setenv("DUPLICATE_CHECK", "")
+	config, err := NewConfig()
+	if err != nil {
+		t.Fatalf("NewConfig: %v", err)
+	}
+	if config.DuplicateCheck {
+		t.Fatal("duplicate check on without DUPLICATE_CHECK")
+	}
+
+	// Two coffees on the same day are both created
+	repo := &duplicatesRepo{matches: []int{0}, existing: uuid.New()}
+	s := &service{
+		repo:      repo,
+		s3Service: presigningS3{},
+		notifier:  discardNotifier{},
+		config:    config,
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		now:       time.Now,
+	}
+	ctx := auth.WithUserID(context.Background(), uuid.New())
+
+	if _, err := s.CreateTransaction(ctx, CreateTransactionRequest{
+		Date:        "2024-01-15",
+		Amount:      450,
+		Type:        TransactionTypeSpending,
+		Description: "Coffee",
+	}); err != nil {
+		t.Fatalf("CreateTransaction: %v", err)
+	}
+	if repo.created == nil {
+		t.Error("transaction not created")
+	}
+}
+
+func TestSaveImportedDuplicates(t *testing.T) {
+	coffee := func(day int) *Transaction {
+		return &Transaction{ID: uuid.New(), Date: jan(day), Amount: 450, Currency: "USD", Type: TransactionTypeSpending, Description: "Coffee"}
+	}
+	existing := uuid.New()
+
+	tests := []struct {
+		name        string
+		windowDays  int
+		matches     []int
+		wantCreated int
+		wantErrors  []ImportError
+	}{
+		{
+			name: "repeated within the import", wantCreated: 3,
+			wantErrors: []ImportError{{Index: 2, Error: "duplicate of entry 0 in this import"}},
+		},
+		{
+			name: "window spans the import", windowDays: 1, wantCreated: 2,
+			wantErrors: []ImportError{
+				{Index: 2, Error: "duplicate of entry 0 in this import"},
+				{Index: 3, Error: "duplicate of entry 0 in this import"},
+			},
+		},
+		{
+			// With the first entry rejected, its repeat is the one created
+			name: "stored and repeated", matches: []int{0}, wantCreated: 3,
+			wantErrors: []ImportError{{Index: 0, Error: "duplicate of an existing transaction", ExistingID: existing.String()}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &duplicatesRepo{matches: tt.matches, existing: existing}
+			s := newStatsService(repo)
+			s.config.DuplicateCheck = true
+			s.config.DuplicateWindowDays = tt.windowDays
+			ctx := context.Background()
+
+			// Entries 0 and 2 match; entry 3 is a day later
+			transactions := []*Transaction{coffee(1), coffee(1), coffee(1), coffee(2)}
+			transactions[1].Amount = 500
+			summary := &ImportSummary{Total: len(transactions), Errors: []ImportError{}}
+
+			summary, err := s.saveImported(ctx, uuid.New(), transactions, []int{0, 1, 2, 3}, summary, ImportOptions{})
+			if err != nil {
+				t.Fatalf("saveImported: %v", err)
+			}
+
+			if len(repo.batch) != tt.wantCreated || summary.Imported != tt.wantCreated {
+				t.Errorf("created %d, imported %d, want %d", len(repo.batch), summary.Imported, tt.wantCreated)
+			}
+			if !reflect.DeepEqual(summary.Errors, tt.wantErrors) {
+				t.Errorf("errors = %+v, want %+v", summary.Errors, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestAggregateCurrency(t *testing.T) {
+	totals := []AggregateTotal{
+		{Currency: "USD", Type: TransactionTypeSpending, Category: "groceries", Total: 4250, Count: 3},
+		{Currency: "EUR", Type: TransactionTypeEarning, Total: 10000, Count: 1},
+	}
+	transactions := []*Transaction{
+		{Currency: "USD", Type: TransactionTypeSpending, Amount: 4250},
+		{Currency: "EUR", Type: TransactionTypeEarning, Amount: 10000},
+	}
+
+	tests := []struct {
+		currency     string
+		wantCurrency string
+		wantCode     string
+	}{
+		{currency: "USD", wantCurrency: "USD"},
+		{currency: "eur", wantCurrency: "EUR"},
+		{currency: " usd ", wantCurrency: "USD"},
+		{currency: "XYZ", wantCode: apperror.CodeInvalidCurrency},
+		{currency: "US", wantCode: apperror.CodeInvalidCurrency},
+		{currency: "usd;drop", wantCode: apperror.CodeInvalidCurrency},
+		// With no currency the transactions must share one, and these don't
+		{currency: "", wantCode: apperror.CodeCurrencyRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.currency, func(t *testing.T) {
+			aggregate, err := summarizeTotals(totals, tt.currency, true)
+			_, selected, selectErr := selectCurrency(transactions, tt.currency)
+
+			for name, got := range map[string]struct {
+				currency string
+				err      error
+			}{
+				"summarizeTotals": {currency: currencyOf(aggregate), err: err},
+				"selectCurrency":  {currency: selected, err: selectErr},
+			} {
+				if tt.wantCode != "" {
+					var appErr *apperror.Error
+					if !errors.As(got.err, &appErr) || appErr.Code != tt.wantCode || appErr.Status != 400 {
+						t.Errorf("%s: err = %v, want 400 %s", name, got.err, tt.wantCode)
+					}
+					continue
+				}
+				if got.err != nil {
+					t.Fatalf("%s: %v", name, got.err)
+				}
+				if got.currency != tt.wantCurrency {
+					t.Errorf("%s: currency = %q, want %q", name, got.currency, tt.wantCurrency)
+				}
+			}
+		})
+	}
+}
+
+func currencyOf(aggregate *AggregatedData) string {
+	if aggregate == nil {
+		return ""
+	}
+	return aggregate.Currency
+}
+
+func TestFieldMappingToCreateRequest(t *testing.T) {
+	bankMapping := FieldMapping{
+		Amount:      "value",
+		Currency:    "ccy",
+		Date:        "booked_on",
+		Type:        "direction",
+		Category:    "bucket",
+		Description: "memo",
+	}
+
+	tests := []struct {
+		name    string
+		mapping FieldMapping
+		item    map[string]any
+		want    CreateTransactionRequest
+		wantErr string
+	}{
+		{
+			name:    "custom keys",
+			mapping: bankMapping,
+			item:    map[string]any{"value": 12.5, "ccy": "EUR", "booked_on": "2024-01-31", "direction": "Spending", "bucket": "groceries", "memo": "Market"},
+			want:    CreateTransactionRequest{Amount: 1250, Currency: "EUR", Date: "2024-01-31", Type: TransactionTypeSpending, Category: "groceries", Description: "Market"},
+		},
+		{
+			name:    "amount as string",
+			mapping: bankMapping,
+			item:    map[string]any{"value": " 99.99 ", "booked_on": "2024-01-31", "direction": "earning"},
+			want:    CreateTransactionRequest{Amount: 9999, Date: "2024-01-31", Type: TransactionTypeEarning},
+		},
+		{
+			name:    "unmapped fields use their own names",
+			mapping: FieldMapping{Amount: "value"},
+			item:    map[string]any{"value": 3.0, "date": "2024-02-01", "type": "spending", "description": "Bus"},
+			want:    CreateTransactionRequest{Amount: 300, Date: "2024-02-01", Type: TransactionTypeSpending, Description: "Bus"},
+		},
+		{
+			name:    "default keys are ignored once mapped",
+			mapping: bankMapping,
+			item:    map[string]any{"amount": 1.0, "date": "2024-01-31", "type": "spending"},
+			wantErr: `missing field "value"`,
+		},
+		{
+			name:    "optional fields of the wrong type are skipped",
+			mapping: bankMapping,
+			item:    map[string]any{"value": 1.0, "booked_on": "2024-01-31", "direction": "spending", "ccy": 978, "memo": true},
+			want:    CreateTransactionRequest{Amount: 100, Date: "2024-01-31", Type: TransactionTypeSpending},
+		},
+		{
+			name:    "amount of the wrong type",
+			mapping: bankMapping,
+			item:    map[string]any{"value": []any{1.0}, "booked_on": "2024-01-31", "direction": "spending"},
+			wantErr: `invalid amount type for field "value"`,
+		},
+		{
+			name:    "amount with too many decimals",
+			mapping: bankMapping,
+			item:    map[string]any{"value": "1.005", "booked_on": "2024-01-31", "direction": "spending"},
+			wantErr: "amount",
+		},
+		{
+			name:    "missing date",
+			mapping: bankMapping,
+			item:    map[string]any{"value": 1.0, "direction": "spending"},
+			wantErr: `missing or non-string field "booked_on"`,
+		},
+		{
+			name:    "non-string type",
+			mapping: bankMapping,
+			item:    map[string]any{"value": 1.0, "booked_on": "2024-01-31", "direction": 1.0},
+			wantErr: `missing or non-string field "direction"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.mapping.withDefaults().toCreateRequest(tt.item)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("toCreateRequest: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("request = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// statsRepo serves the daily history behind the rolling and cadence
+// endpoints from memory, limited to the requested range, and the category
+// totals behind cost rates.
+type statsRepo struct {
+	Repository
+	sums       []DailySum
+	dates      []time.Time
+	categories []CategorySummary
+	// start and end record the range last asked for
+	start, end time.Time
+}
+
+func (r *statsRepo) SumByDay(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]DailySum, error) {
+	r.start, r.end = start, end
+	var sums []DailySum
+	for _, d := range r.sums {
+		if !d.Date.Before(start) && !d.Date.After(end) {
+			sums = append(sums, d)
+		}
+	}
+	return sums, nil
+}
+
+func (r *statsRepo) ListDates(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]time.Time, error) {
+	r.start, r.end = start, end
+	var dates []time.Time
+	for _, date := range r.dates {
+		if !date.Before(start) && !date.After(end) {
+			dates = append(dates, date)
+		}
+	}
+	return dates, nil
+}
+
+// SumByCategory returns the seeded totals whatever the range, which is only
+// recorded, so they stand for the spending dated inside it.
+func (r *statsRepo) SumByCategory(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]CategorySummary, error) {
+	r.start, r.end = start, end
+	return r.categories, nil
+}
+
+func newStatsService(repo Repository) *service {
+	return &service{
+		repo:   repo,
+		config: &Config{Location: time.UTC, AggregateTimeout: time.Second},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		now:    time.Now,
+	}
+}
+
+func jan(day int) time.Time {
+	return time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC)
+}
+
+// longestRange is the one-day rolling totals of the seeded spending over the
+// longest range allowed, from 1 January 2024.
+func longestRange() []Money {
+	totals := make([]Money, maxStatsDays)
+	copy(totals, []Money{100, 200, 300, 400, 500, 0, 0, 800})
+	return totals
+}
+
+func TestGetRollingSpending(t *testing.T) {
+	// Spending on Jan 1-5 and 8, nothing on 6-7; income never counts
+	seeded := []DailySum{
+		{Date: jan(1), Currency: "USD", Spending: 100},
+		{Date: jan(2), Currency: "USD", Spending: 200},
+		{Date: jan(3), Currency: "USD", Spending: 300, Income: 5000},
+		{Date: jan(4), Currency: "USD", Spending: 400},
+		{Date: jan(5), Currency: "USD", Spending: 500},
+		{Date: jan(8), Currency: "USD", Spending: 800},
+	}
+
+	tests := []struct {
+		name      string
+		window    int
+		from, to  time.Time
+		want      []Money
+		wantStart time.Time
+		wantErr   bool
+	}{
+		{name: "one-day window is the daily spending", window: 1, from: jan(1), to: jan(5), want: []Money{100, 200, 300, 400, 500}, wantStart: jan(1)},
+		{name: "three-day window", window: 3, from: jan(3), to: jan(8), want: []Money{600, 900, 1200, 900, 500, 800}, wantStart: jan(1)},
+		{name: "window reaches before from", window: 7, from: jan(7), to: jan(8), want: []Money{1500, 2200}, wantStart: jan(1)},
+		{name: "days before the history are empty", window: 2, from: jan(1), to: jan(2), want: []Money{100, 300}, wantStart: time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{name: "single day", window: 3, from: jan(6), to: jan(6), want: []Money{900}, wantStart: jan(4)},
+		{name: "zero window", window: 0, from: jan(1), to: jan(5), wantErr: true},
+		{name: "window above the maximum", window: maxRollingWindow + 1, from: jan(1), to: jan(5), wantErr: true},
+		{name: "from after to", window: 3, from: jan(5), to: jan(1), wantErr: true},
+		{name: "longest range", window: 1, from: jan(1), to: jan(1).AddDate(0, 0, maxStatsDays-1), want: longestRange(), wantStart: jan(1)},
+		{name: "range above the maximum", window: 1, from: jan(1), to: jan(1).AddDate(0, 0, maxStatsDays), wantErr: true},
+		{name: "range from year one", window: 30, from: time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC), to: jan(31), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &statsRepo{sums: seeded}
+			s := newStatsService(repo)
+			ctx := auth.WithUserID(context.Background(), uuid.New())
+
+			rolling, err := s.GetRollingSpending(ctx, tt.window, tt.from, tt.to, "")
+			if tt.wantErr {
+				var appErr *apperror.Error
+				if !errors.As(err, &appErr) || appErr.Code != apperror.CodeInvalidParameter {
+					t.Fatalf("err = %v, want %s", err, apperror.CodeInvalidParameter)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetRollingSpending: %v", err)
+			}
+
+			if !repo.start.Equal(tt.wantStart) || !repo.end.Equal(tt.to) {
+				t.Errorf("queried %s to %s, want %s to %s", repo.start.Format(dateLayout), repo.end.Format(dateLayout),
+					tt.wantStart.Format(dateLayout), tt.to.Format(dateLayout))
+			}
+			if len(rolling.Totals) != len(tt.want) {
+				t.Fatalf("totals = %+v, want %d days", rolling.Totals, len(tt.want))
+			}
+			for i, total := range rolling.Totals {
+				wantDate := tt.from.AddDate(0, 0, i).Format(dateLayout)
+				if total.Date != wantDate || total.Total != tt.want[i] {
+					t.Errorf("day %d = %s %s, want %s %s", i, total.Date, total.Total, wantDate, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGetRollingSpendingCurrency(t *testing.T) {
+	seeded := []DailySum{
+		{Date: jan(1), Currency: "USD", Spending: 100},
+		{Date: jan(1), Currency: "EUR", Spending: 7000},
+		{Date: jan(2), Currency: "USD", Spending: 200},
+		{Date: jan(3), Currency: "EUR", Spending: 9000},
+	}
+
+	tests := []struct {
+		name     string
+		currency string
+		want     []Money
+		wantCode string
+	}{
+		{name: "usd only", currency: "USD", want: []Money{100, 300, 300}},
+		{name: "eur only", currency: "eur", want: []Money{7000, 7000, 16000}},
+		{name: "several currencies need one", wantCode: apperror.CodeCurrencyRequired},
+		{name: "unsupported currency", currency: "dollars", wantCode: apperror.CodeInvalidCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStatsService(&statsRepo{sums: seeded})
+			ctx := auth.WithUserID(context.Background(), uuid.New())
+
+			rolling, err := s.GetRollingSpending(ctx, 7, jan(1), jan(3), tt.currency)
+			if tt.wantCode != "" {
+				var appErr *apperror.Error
+				if !errors.As(err, &appErr) || appErr.Code != tt.wantCode {
+					t.Fatalf("err = %v, want %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetRollingSpending: %v", err)
+			}
+
+			if rolling.Currency != strings.ToUpper(tt.currency) {
+				t.Errorf("currency = %q, want %q", rolling.Currency, strings.ToUpper(tt.currency))
+			}
+			if len(rolling.Totals) != len(tt.want) {
+				t.Fatalf("totals = %+v, want %d days", rolling.Totals, len(tt.want))
+			}
+			for i, total := range rolling.Totals {
+				if total.Total != tt.want[i] {
+					t.Errorf("day %d = %s, want %s", i, total.Total, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGetCadence(t *testing.T) {
+	tests := []struct {
+		name        string
+		dates       []time.Time
+		from, to    time.Time
+		wantCount   int
+		wantAverage float64
+		wantMin     int
+		wantMax     int
+		// wantGaps is false when there are too few dates for any gap
+		wantGaps bool
+		wantErr  bool
+	}{
+		{name: "no transactions", from: jan(1), to: jan(31)},
+		{name: "one transaction", dates: []time.Time{jan(5)}, from: jan(1), to: jan(31), wantCount: 1},
+		{name: "weekly", dates: []time.Time{jan(1), jan(8), jan(15), jan(22)}, from: jan(1), to: jan(31),
+			wantCount: 4, wantAverage: 7, wantMin: 7, wantMax: 7, wantGaps: true},
+		{name: "irregular", dates: []time.Time{jan(1), jan(2), jan(2), jan(10)}, from: jan(1), to: jan(31),
+			wantCount: 4, wantAverage: 3, wantMin: 0, wantMax: 8, wantGaps: true},
+		{name: "only dates in range", dates: []time.Time{jan(1), jan(3), jan(6), jan(20)}, from: jan(2), to: jan(10),
+			wantCount: 2, wantAverage: 3, wantMin: 3, wantMax: 3, wantGaps: true},
+		{name: "across a month end", dates: []time.Time{jan(30), time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)}, from: jan(1), to: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+			wantCount: 2, wantAverage: 3, wantMin: 3, wantMax: 3, wantGaps: true},
+		{name: "from after to", from: jan(10), to: jan(1), wantErr: true},
+		{name: "longest range", dates: []time.Time{jan(1), jan(1).AddDate(0, 0, maxStatsDays-1)}, from: jan(1), to: jan(1).AddDate(0, 0, maxStatsDays-1),
+			wantCount: 2, wantAverage: maxStatsDays - 1, wantMin: maxStatsDays - 1, wantMax: maxStatsDays - 1, wantGaps: true},
+		{name: "range above the maximum", from: jan(1), to: jan(1).AddDate(0, 0, maxStatsDays), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStatsService(&statsRepo{dates: tt.dates})
+			ctx := auth.WithUserID(context.Background(), uuid.New())
+
+			stats, err := s.GetCadence(ctx, tt.from, tt.to)
+			if tt.wantErr {
+				var appErr *apperror.Error
+				if !errors.As(err, &appErr) || appErr.Code != apperror.CodeInvalidParameter {
+					t.Fatalf("err = %v, want %s", err, apperror.CodeInvalidParameter)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetCadence: %v", err)
+			}
+
+			if stats.Count != tt.wantCount {
+				t.Errorf("count = %d, want %d", stats.Count, tt.wantCount)
+			}
+			if !tt.wantGaps {
+				if stats.AverageGapDays != nil || stats.MinGapDays != nil || stats.MaxGapDays != nil {
+					t.Errorf("gaps = %v, %v, %v, want none", stats.AverageGapDays, stats.MinGapDays, stats.MaxGapDays)
+				}
+				return
+			}
+			if stats.AverageGapDays == nil || stats.MinGapDays == nil || stats.MaxGapDays == nil {
+				t.Fatalf("gaps missing: %+v", stats)
+			}
+			if *stats.AverageGapDays != tt.wantAverage || *stats.MinGapDays != tt.wantMin || *stats.MaxGapDays != tt.wantMax {
+				t.Errorf("average, min, max = %v, %d, %d, want %v, %d, %d",
+					*stats.AverageGapDays, *stats.MinGapDays, *stats.MaxGapDays, tt.wantAverage, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+// slowRepo stands in for aggregate queries that run until their context is
+// done. Like the driver, it then reports its own error rather than ctx.Err().
+type slowRepo struct {
+	Repository
+	// err is returned straight away when set, as a query failing on its own
+	err error
+}
+
+var errQueryCanceled = errors.New("pq: canceling statement due to user request")
+
+func (r *slowRepo) wait(ctx context.Context) error {
+	if r.err != nil {
+		return r.err
+	}
+	<-ctx.Done()
+	return errQueryCanceled
+}
+
+func (r *slowRepo) SumByDay(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]DailySum, error) {
+	return nil, r.wait(ctx)
+}
+
+func (r *slowRepo) ListDates(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]time.Time, error) {
+	return nil, r.wait(ctx)
+}
+
+func (r *slowRepo) AggregateByMonth(ctx context.Context, userID uuid.UUID, year int, month int) ([]AggregateTotal, error) {
+	return nil, r.wait(ctx)
+}
+
+func TestAggregateTimeout(t *testing.T) {
+	aggregates := map[string]func(s *service, ctx context.Context) error{
+		"rolling": func(s *service, ctx context.Context) error {
+			_, err := s.GetRollingSpending(ctx, 7, jan(1), jan(31), "")
+			return err
+		},
+		"cadence": func(s *service, ctx context.Context) error {
+			_, err := s.GetCadence(ctx, jan(1), jan(31))
+			return err
+		},
+		"monthly": func(s *service, ctx context.Context) error {
+			_, err := s.GetMonthlyAggregate(ctx, "2024-01", "")
+			return err
+		},
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		// cancel cancels the caller's context, as a client disconnecting does
+		cancel      bool
+		wantTimeout bool
+	}{
+		{name: "deadline expires mid-query", wantTimeout: true},
+		{name: "query fails on its own", err: errors.New("pq: relation does not exist")},
+		{name: "caller cancels", cancel: true},
+	}
+
+	for aggregate, run := range aggregates {
+		for _, tt := range tests {
+			t.Run(aggregate+"/"+tt.name, func(t *testing.T) {
+				s := newStatsService(&slowRepo{err: tt.err})
+				s.config.AggregateTimeout = 10 * time.Millisecond
+				s.now = func() time.Time { return jan(15) }
+
+				ctx, cancel := context.WithCancel(auth.WithUserID(context.Background(), uuid.New()))
+				defer cancel()
+				if tt.cancel {
+					time.AfterFunc(time.Millisecond, cancel)
+				}
+
+				err := run(s, ctx)
+
+				if got := errors.Is(err, ErrAggregateTimeout); got != tt.wantTimeout {
+					t.Fatalf("err = %v, timeout = %v, want %v", err, got, tt.wantTimeout)
+				}
+				if tt.wantTimeout && apperror.Status(err) != 504 {
+					t.Errorf("status = %d, want 504", apperror.Status(err))
+				}
+				if !tt.wantTimeout && apperror.Status(err) == 504 {
+					t.Errorf("status = 504 for %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestGetCategoryCostRate(t *testing.T) {
+	streaming := []CategorySummary{
+		{Category: "streaming", Currency: "USD", Spending: 12000, Count: 12},
+		{Category: "groceries", Currency: "USD", Spending: 45000, Count: 30},
+	}
+	travel := []CategorySummary{
+		{Category: "travel", Currency: "USD", Spending: 20000, Count: 2},
+		{Category: "travel", Currency: "EUR", Spending: 31000, Count: 3},
+	}
+
+	tests := []struct {
+		name         string
+		categories   []CategorySummary
+		category     string
+		from, to     time.Time
+		currency     string
+		wantCurrency string
+		wantDays     int
+		wantTotal    Money
+		wantPerDay   Money
+		wantPerMonth Money
+		wantCode     string
+	}{
+		{
+			name:       "yearly subscription",
+			categories: streaming, category: "streaming",
+			from: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), to: time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC),
+			wantCurrency: "USD", wantDays: 365, wantTotal: 12000, wantPerDay: 33, wantPerMonth: 1001,
+		},
+		{
+			name:       "one month",
+			categories: []CategorySummary{{Category: "groceries", Currency: "USD", Spending: 3100}}, category: "groceries",
+			from: jan(1), to: jan(31),
+			wantCurrency: "USD", wantDays: 31, wantTotal: 3100, wantPerDay: 100, wantPerMonth: 3044,
+		},
+		{
+			name:       "single day period",
+			categories: []CategorySummary{{Category: "groceries", Currency: "USD", Spending: 500}}, category: " groceries ",
+			from: jan(15), to: jan(15),
+			wantCurrency: "USD", wantDays: 1, wantTotal: 500, wantPerDay: 500, wantPerMonth: 15218,
+		},
+		{
+			name:       "category without spending",
+			categories: streaming, category: "rent",
+			from: jan(1), to: jan(31),
+			wantDays: 31,
+		},
+		{
+			name:       "requested currency",
+			categories: travel, category: "travel", currency: "eur",
+			from: jan(1), to: jan(31),
+			wantCurrency: "EUR", wantDays: 31, wantTotal: 31000, wantPerDay: 1000, wantPerMonth: 30437,
+		},
+		{name: "several currencies", categories: travel, category: "travel", from: jan(1), to: jan(31), wantCode: apperror.CodeCurrencyRequired},
+		{name: "unsupported currency", categories: travel, category: "travel", currency: "XYZ", from: jan(1), to: jan(31), wantCode: apperror.CodeInvalidCurrency},
+		{name: "missing category", categories: streaming, category: " ", from: jan(1), to: jan(31), wantCode: apperror.CodeInvalidParameter},
+		{name: "from after to", categories: streaming, category: "streaming", from: jan(31), to: jan(1), wantCode: apperror.CodeInvalidParameter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &statsRepo{categories: tt.categories}
+			s := newStatsService(repo)
+			ctx := auth.WithUserID(context.Background(), uuid.New())
+
+			rate, err := s.GetCategoryCostRate(ctx, tt.category, tt.from, tt.to, tt.currency)
+			if tt.wantCode != "" {
+				var appErr *apperror.Error
+				if !errors.As(err, &appErr) || appErr.Code != tt.wantCode || appErr.Status != 400 {
+					t.Fatalf("err = %v, want 400 %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetCategoryCostRate: %v", err)
+			}
+
+			// The repository range ends the day after to, which is exclusive
+			if !repo.start.Equal(tt.from) || !repo.end.Equal(tt.to.AddDate(0, 0, 1)) {
+				t.Errorf("queried %s to %s, want %s up to the day after %s", repo.start.Format(dateLayout), repo.end.Format(dateLayout),
+					tt.from.Format(dateLayout), tt.to.Format(dateLayout))
+			}
+			if rate.Currency != tt.wantCurrency || rate.Days != tt.wantDays || rate.Total != tt.wantTotal {
+				t.Errorf("rate = %s %s over %d days, want %s %s over %d days", rate.Total, rate.Currency, rate.Days, tt.wantTotal, tt.wantCurrency, tt.wantDays)
+			}
+			if rate.PerDay != tt.wantPerDay || rate.PerMonth != tt.wantPerMonth {
+				t.Errorf("rates = %s a day, %s a month, want %s a day, %s a month", rate.PerDay, rate.PerMonth, tt.wantPerDay, tt.wantPerMonth)
+			}
+		})
+	}
+}
+
+// forecastRepo serves the currencies a user has and the running balance of
+// each, as of the last transaction the filter allows.
+type forecastRepo struct {
+	Repository
+	lifetime []LifetimeTotal
+	balances map[string]Money
+	// future holds the daily totals of the transactions dated after today
+	future []DailyTotal
+	// filter, sort and limit record the last balance lookup
+	filter ListFilter
+	sort   ListSort
+	limit  int
+}
+
+func (r *forecastRepo) AggregateLifetime(ctx context.Context, userID uuid.UUID) ([]LifetimeTotal, error) {
+	return r.lifetime, nil
+}
+
+func (r *forecastRepo) ListWithBalance(ctx context.Context, userID uuid.UUID, filter ListFilter, sort ListSort, limit, offset int) ([]*Transaction, error) {
+	r.filter, r.sort, r.limit = filter, sort, limit
+	balance, ok := r.balances[filter.Currency]
+	if !ok {
+		return nil, nil
+	}
+	return []*Transaction{{Currency: filter.Currency, RunningBalance: &balance}}, nil
+}
+
+func (r *forecastRepo) AggregateByDay(ctx context.Context, userID uuid.UUID, start, end time.Time) ([]DailyTotal, error) {
+	var totals []DailyTotal
+	for _, d := range r.future {
+		if !d.Date.Before(start) && d.Date.Before(end) {
+			totals = append(totals, d)
+		}
+	}
+	return totals, nil
+}
+
+func TestGetNetWorthForecast(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("loading Asia/Tokyo: %v", err)
+	}
+	// 23:30 UTC on 31 January is already 1 February in Tokyo
+	now := time.Date(2024, 1, 31, 23, 30, 0, 0, time.UTC)
+	day := func(month time.Month, day int) time.Time {
+		return time.Date(2024, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	usdOnly := []LifetimeTotal{{Currency: "USD", Type: TransactionTypeEarning}, {Currency: "USD", Type: TransactionTypeSpending}}
+	twoCurrencies := []LifetimeTotal{{Currency: "USD", Type: TransactionTypeEarning}, {Currency: "EUR", Type: TransactionTypeEarning}}
+	balances := map[string]Money{"USD": 152000, "EUR": -2500}
+	// Rent on the first of each month from February, a salary mid-February,
+	// and a euro payment that never counts towards dollars
+	future := []DailyTotal{
+		{Date: day(time.February, 1), Currency: "USD", Spending: 120000},
+		{Date: day(time.February, 2), Currency: "EUR", Spending: 1000},
+		{Date: day(time.February, 15), Currency: "USD", Income: 300000},
+		{Date: day(time.March, 1), Currency: "USD", Spending: 120000},
+		{Date: day(time.April, 1), Currency: "USD", Spending: 120000},
+	}
+
+	tests := []struct {
+		name         string
+		location     *time.Location
+		lifetime     []LifetimeTotal
+		future       []DailyTotal
+		currency     string
+		horizon      int
+		wantCurrency string
+		wantAsOf     string
+		wantBalance  Money
+		wantMonths   []string
+		wantBalances []Money
+		wantCode     string
+	}{
+		{
+			name: "future transactions move the balance", location: time.UTC, lifetime: usdOnly, future: future, horizon: 3,
+			wantCurrency: "USD", wantAsOf: "2024-01-31", wantBalance: 152000,
+			wantMonths:   []string{"2024-01", "2024-02", "2024-03"},
+			wantBalances: []Money{152000, 332000, 212000},
+		},
+		{
+			name: "no future transactions is flat", location: time.UTC, lifetime: usdOnly, horizon: 3,
+			wantCurrency: "USD", wantAsOf: "2024-01-31", wantBalance: 152000,
+			wantMonths:   []string{"2024-01", "2024-02", "2024-03"},
+			wantBalances: []Money{152000, 152000, 152000},
+		},
+		{
+			// Rent on 1 February is already in the balance as of today
+			name: "today in the application timezone", location: tokyo, lifetime: usdOnly, future: future, horizon: 2,
+			wantCurrency: "USD", wantAsOf: "2024-02-01", wantBalance: 152000,
+			wantMonths:   []string{"2024-02", "2024-03"},
+			wantBalances: []Money{452000, 332000},
+		},
+		{
+			name: "requested currency", location: time.UTC, lifetime: twoCurrencies, future: future, currency: "eur", horizon: 2,
+			wantCurrency: "EUR", wantAsOf: "2024-01-31", wantBalance: -2500,
+			wantMonths:   []string{"2024-01", "2024-02"},
+			wantBalances: []Money{-2500, -3500},
+		},
+		{
+			name: "no transactions", location: time.UTC, horizon: 2,
+			wantAsOf: "2024-01-31", wantMonths: []string{"2024-01", "2024-02"}, wantBalances: []Money{0, 0},
+		},
+		{
+			name: "crosses the year", location: time.UTC, lifetime: usdOnly, future: future, horizon: 13,
+			wantCurrency: "USD", wantAsOf: "2024-01-31", wantBalance: 152000,
+			wantMonths:   []string{"2024-01", "2024-02", "2024-03", "2024-04", "2024-05", "2024-06", "2024-07", "2024-08", "2024-09", "2024-10", "2024-11", "2024-12", "2025-01"},
+			wantBalances: []Money{152000, 332000, 212000, 92000, 92000, 92000, 92000, 92000, 92000, 92000, 92000, 92000, 92000},
+		},
+		{name: "several currencies", location: time.UTC, lifetime: twoCurrencies, horizon: 3, wantCode: apperror.CodeCurrencyRequired},
+		{name: "unsupported currency", location: time.UTC, lifetime: usdOnly, currency: "XYZ", horizon: 3, wantCode: apperror.CodeInvalidCurrency},
+		{name: "zero horizon", location: time.UTC, lifetime: usdOnly, horizon: 0, wantCode: apperror.CodeInvalidParameter},
+		{name: "horizon above the maximum", location: time.UTC, lifetime: usdOnly, horizon: maxForecastMonths + 1, wantCode: apperror.CodeInvalidParameter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &forecastRepo{lifetime: tt.lifetime, balances: balances, future: tt.future}
+			s := newStatsService(repo)
+			s.config.Location = tt.location
+			s.now = func() time.Time { return now }
+			ctx := auth.WithUserID(context.Background(), uuid.New())
+
+			forecast, err := s.GetNetWorthForecast(ctx, tt.horizon, tt.currency)
+			if tt.wantCode != "" {
+				var appErr *apperror.Error
+				if !errors.As(err, &appErr) || appErr.Code != tt.wantCode || appErr.Status != 400 {
+					t.Fatalf("err = %v, want 400 %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetNetWorthForecast: %v", err)
+			}
+
+			// The balance is that of the newest transaction up to today
+			if repo.filter.Currency != tt.wantCurrency || repo.filter.EndDate.Format(dateLayout) != tt.wantAsOf ||
+				repo.sort != (ListSort{}) || repo.limit != 1 {
+				t.Errorf("balance looked up with %+v %+v limit %d, want the newest %s transaction up to %s",
+					repo.filter, repo.sort, repo.limit, tt.wantCurrency, tt.wantAsOf)
+			}
+			if forecast.Currency != tt.wantCurrency || forecast.AsOf != tt.wantAsOf || forecast.Balance != tt.wantBalance {
+				t.Errorf("forecast from %s %s on %s, want %s %s on %s", forecast.Balance, forecast.Currency, forecast.AsOf,
+					tt.wantBalance, tt.wantCurrency, tt.wantAsOf)
+			}
+			if len(forecast.Months) != len(tt.wantMonths) || forecast.HorizonMonths != tt.horizon {
+				t.Fatalf("months = %+v, want %v", forecast.Months, tt.wantMonths)
+			}
+			for i, month := range forecast.Months {
+				if month.Month != tt.wantMonths[i] || month.Balance != tt.wantBalances[i] {
+					t.Errorf("month %d = %s %s, want %s %s", i, month.Month, month.Balance, tt.wantMonths[i], tt.wantBalances[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package financial
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kranti/cashflow/internal/apperror"
+)
+
+const (
+	maxTags      = 20
+	maxTagLength = 50
+)
+
+// normalizeTags lowercases and trims tags, dropping blanks and duplicates
+// while keeping first-seen order. It never returns nil, so transactions
+// without tags serialize as an empty list.
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, apperror.Invalid(apperror.CodeInvalidTags, "tag %q exceeds %d characters", tag, maxTagLength)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	if len(normalized) > maxTags {
+		return nil, apperror.Invalid(apperror.CodeInvalidTags, "at most %d tags are allowed", maxTags)
+	}
+
+	return normalized, nil
+}
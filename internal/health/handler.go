@@ -0,0 +1,69 @@
+package health
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+type StorageChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+type Handler struct {
+	db      Pinger
+	storage StorageChecker
+	timeout time.Duration
+	logger  *slog.Logger
+}
+
+func NewHandler(db Pinger, storage StorageChecker, timeout time.Duration, logger *slog.Logger) *Handler {
+	return &Handler{
+		db:      db,
+		storage: storage,
+		timeout: timeout,
+		logger:  logger,
+	}
+}
+
+// Check reports per-dependency status and returns 503 if any dependency is
+// unreachable.
+func (h *Handler) Check(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+	defer cancel()
+
+	checks := map[string]string{
+		"database": h.check(ctx, "database", h.db.PingContext),
+		"s3":       h.check(ctx, "s3", h.storage.HealthCheck),
+	}
+
+	for _, status := range checks {
+		if status != statusOK {
+			c.JSON(503, gin.H{"status": statusUnavailable, "checks": checks})
+			return
+		}
+	}
+
+	c.JSON(200, gin.H{"status": statusOK, "checks": checks})
+}
+
+func (h *Handler) check(ctx context.Context, name string, fn func(context.Context) error) string {
+	if err := fn(ctx); err != nil {
+		h.logger.Error("health check failed",
+			slog.String("dependency", name),
+			slog.String("error", err.Error()))
+		return statusUnavailable
+	}
+	return statusOK
+}
@@ -0,0 +1,217 @@
+package importer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrNotOFX is returned for input that has no <OFX> element.
+var ErrNotOFX = errors.New("not an OFX file")
+
+// ErrTooManyEntries is returned as soon as a statement is found to hold more
+// transactions than the limit given to ParseOFX.
+var ErrTooManyEntries = errors.New("too many transactions")
+
+// ofxDateLayout is the date part of an OFX datetime such as
+// 20240131120000.000[-5:EST]. The time and zone are dropped, since the date
+// the bank reports is the one the user sees on their statement.
+const ofxDateLayout = "20060102"
+
+// Statement holds the transactions read from an OFX or QFX file.
+type Statement struct {
+	Entries []Entry
+}
+
+// Entry is one STMTTRN element of a statement. Err is set when the entry could
+// not be read, in which case the other fields may be incomplete.
+type Entry struct {
+	// FITID is the bank's identifier for the transaction
+	FITID string
+	// Type is the OFX transaction type, such as DEBIT, CREDIT or POS
+	Type string
+	Date time.Time
+	// Amount is the signed decimal amount as written in the file, with a
+	// decimal comma replaced by a point. Debits are negative.
+	Amount string
+	// Currency is the CURDEF of the enclosing statement
+	Currency string
+	Name     string
+	Memo     string
+	Err      error
+}
+
+// ParseOFX reads the transactions of every bank and credit card statement in
+// an OFX or QFX file. Both the SGML form of OFX 1.x, where leaf elements have
+// no closing tag, and the XML form of OFX 2.x are accepted. Text that is not
+// valid UTF-8 is read as Latin-1, the usual charset of 1.x files.
+//
+// The file is read as it is parsed. When maxEntries is positive, parsing stops
+// with ErrTooManyEntries once a statement holds more entries than that.
+func ParseOFX(r io.Reader, maxEntries int) (*Statement, error) {
+	// 1.x files open with colon-separated header lines and 2.x files with
+	// processing instructions; everything before <OFX> is skipped
+	tokens := &tokenizer{r: bufio.NewReader(r)}
+	statement := &Statement{}
+	var currency string
+	var entry *Entry
+	inOFX := false
+
+	for {
+		token, err := tokens.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading OFX file: %w", err)
+		}
+
+		switch {
+		case !inOFX:
+			inOFX = token.name == "OFX" && !token.closing
+		case token.name == "STMTTRN" && !token.closing:
+			if maxEntries > 0 && len(statement.Entries) >= maxEntries {
+				return nil, ErrTooManyEntries
+			}
+			entry = &Entry{Currency: currency}
+		case token.name == "STMTTRN":
+			if entry != nil {
+				statement.Entries = append(statement.Entries, finishEntry(*entry))
+				entry = nil
+			}
+		case token.closing:
+		case token.name == "CURDEF":
+			currency = token.value
+		case entry != nil:
+			entry.set(token.name, token.value)
+		}
+	}
+
+	if !inOFX {
+		return nil, ErrNotOFX
+	}
+
+	// A truncated file can end inside a transaction
+	if entry != nil {
+		statement.Entries = append(statement.Entries, finishEntry(*entry))
+	}
+
+	return statement, nil
+}
+
+// set records a leaf element of a transaction. Only the first problem found
+// with an entry is kept.
+func (e *Entry) set(name, value string) {
+	switch name {
+	case "FITID":
+		e.FITID = value
+	case "TRNTYPE":
+		e.Type = value
+	case "DTPOSTED":
+		e.Date = parseOFXDate(value)
+		if e.Date.IsZero() && e.Err == nil {
+			e.Err = fmt.Errorf("invalid DTPOSTED %q", value)
+		}
+	case "TRNAMT":
+		if !strings.Contains(value, ".") {
+			value = strings.Replace(value, ",", ".", 1)
+		}
+		e.Amount = value
+	case "NAME":
+		e.Name = value
+	case "MEMO":
+		e.Memo = value
+	}
+}
+
+func finishEntry(e Entry) Entry {
+	if e.Err != nil {
+		return e
+	}
+	switch {
+	case e.Date.IsZero():
+		e.Err = errors.New("missing DTPOSTED")
+	case e.Amount == "":
+		e.Err = errors.New("missing TRNAMT")
+	}
+	return e
+}
+
+// parseOFXDate returns the midnight UTC date of an OFX datetime, or the zero
+// time if it is malformed.
+func parseOFXDate(value string) time.Time {
+	if len(value) < len(ofxDateLayout) {
+		return time.Time{}
+	}
+	date, err := time.Parse(ofxDateLayout, value[:len(ofxDateLayout)])
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
+
+type token struct {
+	name    string
+	closing bool
+	// value is the text following an opening tag, which for a leaf element
+	// is its content
+	value string
+}
+
+// tokenizer splits an OFX document into its tags as it reads it. It does not
+// check that tags are balanced, which SGML files never are.
+type tokenizer struct {
+	r *bufio.Reader
+}
+
+// next returns the next tag, or io.EOF once no complete tag is left.
+func (t *tokenizer) next() (token, error) {
+	for {
+		if _, err := t.r.ReadString('<'); err != nil {
+			return token{}, err
+		}
+		tag, err := t.r.ReadString('>')
+		if err != nil {
+			return token{}, err
+		}
+		tag = tag[:len(tag)-1]
+
+		// Skip processing instructions and comments
+		if strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!") {
+			continue
+		}
+
+		// The text runs up to the next tag, whose '<' is left to be read
+		text, err := t.r.ReadString('<')
+		switch {
+		case err == nil:
+			text = text[:len(text)-1]
+			_ = t.r.UnreadByte()
+		case !errors.Is(err, io.EOF):
+			return token{}, err
+		}
+		if !utf8.ValidString(text) {
+			text = latin1ToUTF8(text)
+		}
+
+		closing := strings.HasPrefix(tag, "/")
+		return token{
+			name:    strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(tag, "/"))),
+			closing: closing,
+			value:   html.UnescapeString(strings.TrimSpace(text)),
+		}, nil
+	}
+}
+
+func latin1ToUTF8(text string) string {
+	runes := make([]rune, len(text))
+	for i := 0; i < len(text); i++ {
+		runes[i] = rune(text[i])
+	}
+	return string(runes)
+}
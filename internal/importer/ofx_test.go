@@ -0,0 +1,188 @@
+package importer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sgmlHeader = "OFXHEADER:100\nDATA:OFXSGML\nVERSION:102\nENCODING:USASCII\nCHARSET:1252\n\n"
+
+// sgmlStatement wraps transactions in an OFX 1.x bank statement, whose leaf
+// elements have no closing tags.
+func sgmlStatement(transactions ...string) string {
+	return sgmlHeader + "<OFX>\n<BANKMSGSRSV1><STMTTRNRS><STMTRS>\n<CURDEF>EUR\n<BANKTRANLIST>\n" +
+		strings.Join(transactions, "\n") +
+		"\n</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1>\n</OFX>\n"
+}
+
+func sgmlTransaction(fitid, amount, name string) string {
+	return "<STMTTRN>\n<TRNTYPE>DEBIT\n<DTPOSTED>20240131120000.000[-5:EST]\n<TRNAMT>" + amount +
+		"\n<FITID>" + fitid + "\n<NAME>" + name + "\n</STMTTRN>"
+}
+
+func TestParseOFX(t *testing.T) {
+	date := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		input string
+		want  []Entry
+	}{
+		{
+			name:  "SGML leaf tags",
+			input: sgmlStatement(sgmlTransaction("1", "-12.50", "Bakery")),
+			want:  []Entry{{FITID: "1", Type: "DEBIT", Date: date, Amount: "-12.50", Currency: "EUR", Name: "Bakery"}},
+		},
+		{
+			name: "XML with processing instructions",
+			input: `<?xml version="1.0" encoding="UTF-8"?><?OFX OFXHEADER="200" VERSION="220"?>` +
+				`<OFX><CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS><CURDEF>USD</CURDEF><BANKTRANLIST>` +
+				`<STMTTRN><TRNTYPE>CREDIT</TRNTYPE><DTPOSTED>20240131</DTPOSTED><TRNAMT>100.00</TRNAMT>` +
+				`<FITID>2</FITID><NAME>Refund &amp; Co</NAME><MEMO>Order 7</MEMO></STMTTRN>` +
+				`</BANKTRANLIST></CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1></OFX>`,
+			want: []Entry{{FITID: "2", Type: "CREDIT", Date: date, Amount: "100.00", Currency: "USD", Name: "Refund & Co", Memo: "Order 7"}},
+		},
+		{
+			name:  "lowercase tags",
+			input: "<ofx><stmtrs><curdef>GBP<stmttrn><trntype>POS<dtposted>20240131<trnamt>-3.00<fitid>3<name>Cafe</stmttrn></stmtrs></ofx>",
+			want:  []Entry{{FITID: "3", Type: "POS", Date: date, Amount: "-3.00", Currency: "GBP", Name: "Cafe"}},
+		},
+		{
+			name:  "decimal comma",
+			input: sgmlStatement(sgmlTransaction("4", "-7,25", "Kiosk")),
+			want:  []Entry{{FITID: "4", Type: "DEBIT", Date: date, Amount: "-7.25", Currency: "EUR", Name: "Kiosk"}},
+		},
+		{
+			name:  "Latin-1 text",
+			input: sgmlStatement(sgmlTransaction("5", "-9.99", "\xc9picerie Z\xfcrich")),
+			want:  []Entry{{FITID: "5", Type: "DEBIT", Date: date, Amount: "-9.99", Currency: "EUR", Name: "Épicerie Zürich"}},
+		},
+		{
+			name:  "UTF-8 text is kept",
+			input: sgmlStatement(sgmlTransaction("6", "-1.00", "Żabka")),
+			want:  []Entry{{FITID: "6", Type: "DEBIT", Date: date, Amount: "-1.00", Currency: "EUR", Name: "Żabka"}},
+		},
+		{
+			name:  "truncated inside a transaction",
+			input: sgmlHeader + "<OFX><CURDEF>EUR<STMTTRN><DTPOSTED>20240131<TRNAMT>-2.00<FITID>7",
+			want:  []Entry{{FITID: "7", Date: date, Amount: "-2.00", Currency: "EUR"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statement, err := ParseOFX(strings.NewReader(tt.input), 0)
+			if err != nil {
+				t.Fatalf("ParseOFX: %v", err)
+			}
+			if len(statement.Entries) != len(tt.want) {
+				t.Fatalf("entries = %+v, want %+v", statement.Entries, tt.want)
+			}
+			for i, got := range statement.Entries {
+				if got != tt.want[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseOFXEntryErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   string
+		wantErr string
+	}{
+		{name: "missing date", entry: "<STMTTRN><TRNAMT>-1.00</STMTTRN>", wantErr: "missing DTPOSTED"},
+		{name: "invalid date", entry: "<STMTTRN><DTPOSTED>2024-01-31<TRNAMT>-1.00</STMTTRN>", wantErr: "invalid DTPOSTED"},
+		{name: "missing amount", entry: "<STMTTRN><DTPOSTED>20240131</STMTTRN>", wantErr: "missing TRNAMT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statement, err := ParseOFX(strings.NewReader(sgmlStatement(tt.entry)), 0)
+			if err != nil {
+				t.Fatalf("ParseOFX: %v", err)
+			}
+			if len(statement.Entries) != 1 {
+				t.Fatalf("entries = %d, want 1", len(statement.Entries))
+			}
+			if err := statement.Entries[0].Err; err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("entry error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseOFXLimit(t *testing.T) {
+	const limit = 3
+	transactions := func(n int) []string {
+		entries := make([]string, n)
+		for i := range entries {
+			entries[i] = sgmlTransaction("id", "-1.00", "Shop")
+		}
+		return entries
+	}
+
+	tests := []struct {
+		name       string
+		entries    int
+		maxEntries int
+		wantErr    error
+	}{
+		{name: "at the limit", entries: limit, maxEntries: limit},
+		{name: "one over the limit", entries: limit + 1, maxEntries: limit, wantErr: ErrTooManyEntries},
+		{name: "no limit", entries: limit + 1, maxEntries: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statement, err := ParseOFX(strings.NewReader(sgmlStatement(transactions(tt.entries)...)), tt.maxEntries)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseOFX: %v", err)
+			}
+			if len(statement.Entries) != tt.entries {
+				t.Errorf("entries = %d, want %d", len(statement.Entries), tt.entries)
+			}
+		})
+	}
+}
+
+// failingReader returns data and then err, standing in for a body that is cut
+// off, such as by the request size limit.
+type failingReader struct {
+	data string
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestParseOFXReadErrors(t *testing.T) {
+	if _, err := ParseOFX(strings.NewReader("OFXHEADER:100\n<HTML><BODY>not a statement</BODY></HTML>"), 0); !errors.Is(err, ErrNotOFX) {
+		t.Errorf("err = %v, want ErrNotOFX", err)
+	}
+	if _, err := ParseOFX(strings.NewReader(""), 0); !errors.Is(err, ErrNotOFX) {
+		t.Errorf("empty input: err = %v, want ErrNotOFX", err)
+	}
+
+	readErr := errors.New("body too large")
+	_, err := ParseOFX(&failingReader{data: sgmlHeader + "<OFX><STMTTRN><TRNAMT>-1.00", err: readErr}, 0)
+	if !errors.Is(err, readErr) {
+		t.Errorf("err = %v, want the read error", err)
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kranti/cashflow/internal/apperror"
+)
+
+// BodyLimit caps request bodies at n bytes. Requests that declare a larger
+// Content-Length are rejected with 413 up front; other bodies fail on read
+// past the limit, which handlers report as 413 via apperror.InvalidBody.
+func BodyLimit(n int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > n {
+			c.AbortWithStatusJSON(413, apperror.Body(c, apperror.CodeBodyTooLarge, fmt.Sprintf("request body exceeds %d bytes", n)))
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, n)
+		c.Next()
+	}
+}
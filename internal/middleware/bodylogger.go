@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kranti/cashflow/internal/apperror"
+)
+
+// maxLoggedBody caps how much of each request and response body is logged.
+const maxLoggedBody = 4 << 10
+
+const redacted = "[REDACTED]"
+
+// credentialWords mark a header as carrying a credential when its name
+// contains one of them, such as Authorization, Cookie, X-Api-Key or
+// X-Upload-Event-Secret. Such headers are logged with their values replaced.
+var credentialWords = []string{"auth", "cookie", "secret", "token", "password", "signature", "api-key"}
+
+// imageBase64Field matches the image_base64 JSON field, including a value cut
+// short by maxLoggedBody.
+var imageBase64Field = regexp.MustCompile(`("image_base64"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+
+// BodyLogger logs the headers and JSON bodies of each request and its response
+// at debug level, truncated to maxLoggedBody. Credential headers and
+// image_base64 fields are redacted. When the logger is not enabled for debug
+// the middleware does nothing.
+func BodyLogger(logger *slog.Logger) gin.HandlerFunc {
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		// The handler reads the body as usual; whatever it consumes is copied
+		// into reqBody up to the cap
+		reqBody := &cappedBuffer{limit: maxLoggedBody}
+		if c.Request.Body != nil {
+			c.Request.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(c.Request.Body, reqBody), c.Request.Body}
+		}
+
+		writer := &bodyLogWriter{ResponseWriter: c.Writer, body: &cappedBuffer{limit: maxLoggedBody}}
+		c.Writer = writer
+
+		c.Next()
+
+		requestID := c.GetString(apperror.RequestIDKey)
+
+		logger.Debug("request body",
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("request_id", requestID),
+			slog.Any("headers", redactHeaders(c.Request.Header)),
+			slog.String("body", loggedBody(c.Request.Header.Get("Content-Type"), reqBody)))
+
+		logger.Debug("response body",
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("request_id", requestID),
+			slog.Int("status", writer.Status()),
+			slog.String("body", loggedBody(writer.Header().Get("Content-Type"), writer.body)))
+	}
+}
+
+// bodyLogWriter copies the response body into body as it is written.
+type bodyLogWriter struct {
+	gin.ResponseWriter
+	body *cappedBuffer
+}
+
+func (w *bodyLogWriter) Write(data []byte) (int, error) {
+	_, _ = w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyLogWriter) WriteString(s string) (int, error) {
+	_, _ = w.body.Write([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// cappedBuffer keeps the first limit bytes written to it and discards the
+// rest, recording that it did.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(data []byte) (int, error) {
+	if remaining := b.limit - b.buf.Len(); remaining < len(data) {
+		b.truncated = true
+		data = data[:max(remaining, 0)]
+	}
+	b.buf.Write(data)
+	return len(data), nil
+}
+
+// loggedBody returns the captured body for logging. Only JSON bodies are
+// logged; anything else, such as multipart uploads or CSV exports, is omitted.
+func loggedBody(contentType string, body *cappedBuffer) string {
+	if body.buf.Len() == 0 {
+		return ""
+	}
+	if !strings.Contains(contentType, "json") {
+		return "[omitted " + contentType + "]"
+	}
+
+	logged := imageBase64Field.ReplaceAllString(body.buf.String(), `$1"`+redacted+`"`)
+	if body.truncated {
+		logged += "...[truncated]"
+	}
+	return logged
+}
+
+func redactHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name := range header {
+		if credentialHeader(name) {
+			headers[name] = redacted
+		} else {
+			headers[name] = header.Get(name)
+		}
+	}
+	return headers
+}
+
+// credentialHeader reports whether name contains one of credentialWords.
+func credentialHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range credentialWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/kranti/cashflow/internal/upload"
+)
+
+func TestRedactHeaders(t *testing.T) {
+	tests := []struct {
+		name         string
+		header       string
+		wantRedacted bool
+	}{
+		{name: "bearer token", header: "Authorization", wantRedacted: true},
+		{name: "proxy credentials", header: "Proxy-Authorization", wantRedacted: true},
+		{name: "cookie", header: "Cookie", wantRedacted: true},
+		{name: "storage event secret", header: upload.EventSecretHeader, wantRedacted: true},
+		{name: "API key", header: "X-Api-Key", wantRedacted: true},
+		{name: "CSRF token", header: "X-Csrf-Token", wantRedacted: true},
+		{name: "webhook signature", header: "X-Hub-Signature-256", wantRedacted: true},
+		{name: "content type", header: "Content-Type"},
+		{name: "idempotency key", header: "Idempotency-Key"},
+		{name: "request ID", header: "X-Request-Id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(tt.header, "value")
+
+			got := redactHeaders(header)[http.CanonicalHeaderKey(tt.header)]
+
+			want := "value"
+			if tt.wantRedacted {
+				want = redacted
+			}
+			if got != want {
+				t.Errorf("%s logged as %q, want %q", tt.header, got, want)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
 )
 
 func StructuredLogger(logger *slog.Logger) gin.HandlerFunc {
@@ -15,14 +16,14 @@ func StructuredLogger(logger *slog.Logger) gin.HandlerFunc {
 			slog.String("path", c.Request.URL.Path),
 			slog.String("ip", c.ClientIP()),
 			slog.Any("panic", recovered))
-		c.AbortWithStatusJSON(500, gin.H{"error": "Internal server error"})
+		c.AbortWithStatusJSON(500, apperror.Body(c, apperror.CodeInternal, "Internal server error"))
 	})
 }
 
 func RequestID() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		requestID := uuid.New().String()
-		c.Set("request_id", requestID)
+		c.Set(apperror.RequestIDKey, requestID)
 		c.Header("X-Request-ID", requestID)
 		c.Next()
 	}
@@ -38,7 +39,7 @@ func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
 		method := c.Request.Method
 		path := c.Request.URL.Path
 		statusCode := c.Writer.Status()
-		requestID, _ := c.Get("request_id")
+		requestID := c.GetString(apperror.RequestIDKey)
 
 		logger.Info("request completed",
 			slog.String("method", method),
@@ -46,6 +47,6 @@ func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
 			slog.String("ip", clientIP),
 			slog.Int("status", statusCode),
 			slog.Duration("latency", latency),
-			slog.Any("request_id", requestID))
+			slog.String("request_id", requestID))
 	})
 }
\ No newline at end of file
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cashflow_http_requests_total",
+		Help: "HTTP requests handled, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cashflow_http_request_duration_seconds",
+		Help:    "HTTP request latency, by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	httpRequestErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cashflow_http_request_errors_total",
+		Help: "HTTP requests answered with a 4xx or 5xx status, by method, route and status.",
+	}, []string{"method", "route", "status"})
+)
+
+// Metrics records request count, latency and errors for every request. Routes
+// are labeled by their pattern (e.g. /api/transactions/:id) so IDs don't
+// create a series per request; unmatched paths share the "unmatched" label.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		status := strconv.Itoa(c.Writer.Status())
+
+		httpRequestsTotal.WithLabelValues(method, route, status).Inc()
+		httpRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		if c.Writer.Status() >= 400 {
+			httpRequestErrorsTotal.WithLabelValues(method, route, status).Inc()
+		}
+	}
+}
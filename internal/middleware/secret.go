@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kranti/cashflow/internal/apperror"
+)
+
+// SharedSecret rejects requests whose header does not carry secret. It guards
+// machine-to-machine endpoints, such as storage event notifications, that
+// have no API key of their own.
+func SharedSecret(header, secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if secret == "" || subtle.ConstantTimeCompare([]byte(c.GetHeader(header)), []byte(secret)) != 1 {
+			c.AbortWithStatusJSON(401, apperror.Body(c, apperror.CodeUnauthorized, "Invalid or missing "+header+" header"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// BearerSecret rejects requests whose Authorization header does not carry
+// secret as a bearer token. It guards endpoints scraped by other services,
+// such as metrics, which can send a fixed bearer token but no API key.
+func BearerSecret(secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok || secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(401, apperror.Body(c, apperror.CodeUnauthorized, "Invalid or missing bearer token"))
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,49 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kranti/cashflow/internal/middleware"
+)
+
+func TestBearerSecret(t *testing.T) {
+	tests := []struct {
+		name          string
+		secret        string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "matching token", secret: "s3cret", authorization: "Bearer s3cret", wantStatus: http.StatusOK},
+		{name: "wrong token", secret: "s3cret", authorization: "Bearer guess", wantStatus: http.StatusUnauthorized},
+		{name: "token without scheme", secret: "s3cret", authorization: "s3cret", wantStatus: http.StatusUnauthorized},
+		{name: "missing header", secret: "s3cret", wantStatus: http.StatusUnauthorized},
+		{name: "no secret configured", secret: "", authorization: "Bearer ", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/metrics", middleware.BearerSecret(tt.secret), func(c *gin.Context) {
+				c.String(http.StatusOK, "metrics")
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
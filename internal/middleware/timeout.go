@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kranti/cashflow/internal/apperror"
+)
+
+// Timeout gives each request a context deadline of d, so DB queries and S3
+// calls made with the request context are cancelled when it passes. A request
+// whose deadline expires before a response is written gets a 504 in place of
+// whatever the handler was about to send.
+//
+// Routes in exempt, given by their full path such as
+// "/api/transactions/:id/image", get no deadline. They stream bodies that can
+// take longer than d to send, and cancelling the context would cut them off;
+// StreamDeadline bounds them instead.
+func Timeout(d time.Duration, exempt ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		skip[path] = true
+	}
+
+	return func(c *gin.Context) {
+		if skip[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		body, _ := json.Marshal(apperror.Body(c, apperror.CodeRequestTimeout, "Request timed out"))
+		c.Writer = &timeoutWriter{ResponseWriter: c.Writer, ctx: ctx, body: body}
+
+		c.Next()
+
+		if !c.Writer.Written() && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			c.AbortWithStatusJSON(504, apperror.Body(c, apperror.CodeRequestTimeout, "Request timed out"))
+		}
+	}
+}
+
+// StreamDeadline moves the connection's write deadline to d from now for the
+// given routes, which are exempt from Timeout. The server's write timeout
+// is sized for ordinary responses and would otherwise cut a large export or a
+// slow client off mid-body. It must run before middleware that wraps the
+// writer without an Unwrap method.
+func StreamDeadline(d time.Duration, routes ...string) gin.HandlerFunc {
+	streaming := make(map[string]bool, len(routes))
+	for _, path := range routes {
+		streaming[path] = true
+	}
+
+	return func(c *gin.Context) {
+		if streaming[c.FullPath()] {
+			// Writers that can't set a deadline, such as test recorders,
+			// have no server write timeout to lift either
+			_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(d))
+		}
+		c.Next()
+	}
+}
+
+// timeoutWriter swaps the first write after the deadline for a 504 and drops
+// the handler's output. Responses already started are left alone.
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx      context.Context
+	body     []byte
+	timedOut bool
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	if w.checkTimeout() {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	if w.checkTimeout() {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	if w.checkTimeout() {
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *timeoutWriter) checkTimeout() bool {
+	if w.timedOut {
+		return true
+	}
+	if w.ResponseWriter.Written() || !errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		return false
+	}
+
+	w.timedOut = true
+	w.ResponseWriter.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.ResponseWriter.WriteHeader(504)
+	_, _ = w.ResponseWriter.Write(w.body)
+	return true
+}
@@ -0,0 +1,55 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kranti/cashflow/internal/middleware"
+)
+
+func TestTimeoutExemptRoutes(t *testing.T) {
+	const timeout = 10 * time.Millisecond
+
+	tests := []struct {
+		name         string
+		path         string
+		wantStatus   int
+		wantDeadline bool
+	}{
+		{name: "exempt route outlives the timeout", path: "/api/transactions/42/image", wantStatus: http.StatusOK},
+		{name: "other routes time out", path: "/api/transactions/42", wantStatus: http.StatusGatewayTimeout, wantDeadline: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(middleware.Timeout(timeout, "/api/transactions/:id/image"))
+
+			var hasDeadline bool
+			slow := func(c *gin.Context) {
+				_, hasDeadline = c.Request.Context().Deadline()
+				select {
+				case <-c.Request.Context().Done():
+				case <-time.After(5 * timeout):
+				}
+				c.String(http.StatusOK, "image bytes")
+			}
+			router.GET("/api/transactions/:id", slow)
+			router.GET("/api/transactions/:id/image", slow)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if hasDeadline != tt.wantDeadline {
+				t.Errorf("context deadline set = %v, want %v", hasDeadline, tt.wantDeadline)
+			}
+		})
+	}
+}
@@ -2,17 +2,41 @@ package s3
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 type Config struct {
-	Region          string
-	BucketName      string
+	Region     string
+	BucketName string
+	// AccessKeyID and SecretAccessKey are static credentials. When they are
+	// empty, credentials come from the default AWS chain instead.
 	AccessKeyID     string
 	SecretAccessKey string
 	URLExpiration   time.Duration
 	MaxImageSize    int64
+	MaxRetries      int
+	// StagingPrefix holds presigned uploads until they are linked to a
+	// transaction; TransactionsPrefix holds linked images. Both end in "/".
+	StagingPrefix      string
+	TransactionsPrefix string
+	// ImageTypes maps each allowed image content type to the file extension
+	// its objects are stored with.
+	ImageTypes map[string]string
+	// EndpointURL points the client at an S3-compatible store such as MinIO,
+	// LocalStack or R2 instead of AWS. Most of these need UsePathStyle.
+	EndpointURL  string
+	UsePathStyle bool
+	// ServerSideEncryption is set on every object the server writes and on
+	// presigned uploads; empty leaves it to the bucket default. SSEKMSKeyID
+	// picks the KMS key for the KMS modes.
+	ServerSideEncryption types.ServerSideEncryption
+	SSEKMSKeyID          string
 }
 
 func NewConfig() (*Config, error) {
@@ -26,14 +50,15 @@ func NewConfig() (*Config, error) {
 		return nil, fmt.Errorf("S3_BUCKET_NAME environment variable is required")
 	}
 
+	// Without static keys the default credential chain is used, so instance
+	// and task roles and IRSA work
 	accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
-	if accessKeyID == "" {
-		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID environment variable is required")
-	}
-
 	secretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
-	if secretAccessKey == "" {
-		return nil, fmt.Errorf("AWS_SECRET_ACCESS_KEY environment variable is required")
+	if accessKeyID != "" && secretAccessKey == "" {
+		return nil, fmt.Errorf("AWS_SECRET_ACCESS_KEY environment variable is required when AWS_ACCESS_KEY_ID is set")
+	}
+	if accessKeyID == "" && secretAccessKey != "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID environment variable is required when AWS_SECRET_ACCESS_KEY is set")
 	}
 
 	urlExpiration := 24 * time.Hour
@@ -53,6 +78,52 @@ func NewConfig() (*Config, error) {
 		}
 	}
 
+	maxRetries := 3
+	if retriesStr := os.Getenv("S3_MAX_RETRIES"); retriesStr != "" {
+		var retries int
+		_, err := fmt.Sscanf(retriesStr, "%d", &retries)
+		if err == nil && retries > 0 {
+			maxRetries = retries
+		}
+	}
+
+	stagingPrefix := keyPrefix(os.Getenv("S3_STAGING_PREFIX"), "staging/")
+	transactionsPrefix := keyPrefix(os.Getenv("S3_TRANSACTIONS_PREFIX"), "transactions/")
+	if strings.HasPrefix(stagingPrefix, transactionsPrefix) || strings.HasPrefix(transactionsPrefix, stagingPrefix) {
+		return nil, fmt.Errorf("S3_STAGING_PREFIX %q and S3_TRANSACTIONS_PREFIX %q must not overlap", stagingPrefix, transactionsPrefix)
+	}
+
+	allowedTypes := os.Getenv("ALLOWED_IMAGE_TYPES")
+	if allowedTypes == "" {
+		allowedTypes = defaultImageTypes
+	}
+	imageTypes, err := parseImageTypes(allowedTypes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ALLOWED_IMAGE_TYPES: %w", err)
+	}
+
+	endpointURL := os.Getenv("S3_ENDPOINT_URL")
+	if endpointURL != "" {
+		parsed, err := url.Parse(endpointURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid S3_ENDPOINT_URL %q: must be an http or https URL", endpointURL)
+		}
+	}
+
+	usePathStyle := false
+	if v := os.Getenv("S3_USE_PATH_STYLE"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err == nil {
+			usePathStyle = enabled
+		}
+	}
+
+	sseKMSKeyID := strings.TrimSpace(os.Getenv("S3_SSE_KMS_KEY_ID"))
+	serverSideEncryption, err := parseSSE(strings.TrimSpace(os.Getenv("S3_SSE")), sseKMSKeyID)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
 		Region:          region,
 		BucketName:      bucketName,
@@ -60,5 +131,26 @@ func NewConfig() (*Config, error) {
 		SecretAccessKey: secretAccessKey,
 		URLExpiration:   urlExpiration,
 		MaxImageSize:    maxImageSize,
+		MaxRetries:      maxRetries,
+
+		StagingPrefix:      stagingPrefix,
+		TransactionsPrefix: transactionsPrefix,
+		ImageTypes:         imageTypes,
+
+		EndpointURL:  endpointURL,
+		UsePathStyle: usePathStyle,
+
+		ServerSideEncryption: serverSideEncryption,
+		SSEKMSKeyID:          sseKMSKeyID,
 	}, nil
-}
\ No newline at end of file
+}
+
+// keyPrefix normalizes an S3 key prefix to have no leading slash and exactly
+// one trailing slash, falling back to def when value is empty.
+func keyPrefix(value, def string) string {
+	value = strings.Trim(strings.TrimSpace(value), "/")
+	if value == "" {
+		return def
+	}
+	return value + "/"
+}
@@ -0,0 +1,46 @@
+package s3
+
+import "fmt"
+
+// maxDeleteBatch is the most keys a single DeleteObjects call accepts.
+const maxDeleteBatch = 1000
+
+// DeleteFailure is a key a batch delete could not remove.
+type DeleteFailure struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+// DeleteError reports the keys DeleteImages failed to delete. Keys not listed
+// were deleted.
+type DeleteError struct {
+	Failures []DeleteFailure
+}
+
+func (e *DeleteError) Error() string {
+	first := e.Failures[0]
+	return fmt.Sprintf("deleting from S3: %d keys failed, first %s: %s",
+		len(e.Failures), first.Key, first.Message)
+}
+
+// chunkKeys splits keys into consecutive chunks of at most size keys, skipping
+// empty keys.
+func chunkKeys(keys []string, size int) [][]string {
+	var chunks [][]string
+	var chunk []string
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		chunk = append(chunk, key)
+		if len(chunk) == size {
+			chunks = append(chunks, chunk)
+			chunk = nil
+		}
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
@@ -0,0 +1,194 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// newTestService returns a service whose client talks to handler instead of
+// S3, with path-style addressing so every request arrives at /bucket/...
+func newTestService(t *testing.T, handler http.Handler) *service {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+	})
+	return &service{
+		client:        client,
+		presignClient: s3.NewPresignClient(client),
+		config:        &Config{BucketName: "bucket", MaxRetries: 3, MaxImageSize: 10 << 20},
+	}
+}
+
+// fakeDeleteObjects serves DeleteObjects, recording the size of each batch.
+// Keys in failKeys are reported as per-key errors, and the first failCalls
+// requests fail as a whole with a retryable 503.
+type fakeDeleteObjects struct {
+	mu        sync.Mutex
+	batches   []int
+	failKeys  map[string]bool
+	failCalls int
+	calls     int
+}
+
+func (f *fakeDeleteObjects) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if f.calls <= f.failCalls {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `<Error><Code>ServiceUnavailable</Code><Message>try again</Message></Error>`)
+		return
+	}
+
+	var req struct {
+		Objects []struct {
+			Key string `xml:"Key"`
+		} `xml:"Object"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.batches = append(f.batches, len(req.Objects))
+
+	fmt.Fprint(w, `<DeleteResult>`)
+	for _, object := range req.Objects {
+		if f.failKeys[object.Key] {
+			fmt.Fprintf(w, `<Error><Key>%s</Key><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`, object.Key)
+		}
+	}
+	fmt.Fprint(w, `</DeleteResult>`)
+}
+
+func testKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("transactions/2024/01/%04d.jpg", i)
+	}
+	return keys
+}
+
+func TestDeleteImagesChunking(t *testing.T) {
+	tests := []struct {
+		keys        int
+		wantBatches []int
+	}{
+		{keys: 0, wantBatches: nil},
+		{keys: 999, wantBatches: []int{999}},
+		{keys: 1000, wantBatches: []int{1000}},
+		{keys: 1001, wantBatches: []int{1000, 1}},
+		{keys: 2500, wantBatches: []int{1000, 1000, 500}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d keys", tt.keys), func(t *testing.T) {
+			fake := &fakeDeleteObjects{}
+			s := newTestService(t, fake)
+
+			if err := s.DeleteImages(context.Background(), testKeys(tt.keys)); err != nil {
+				t.Fatalf("DeleteImages: %v", err)
+			}
+			if fmt.Sprint(fake.batches) != fmt.Sprint(tt.wantBatches) {
+				t.Errorf("batches = %v, want %v", fake.batches, tt.wantBatches)
+			}
+		})
+	}
+}
+
+func TestDeleteImagesFailures(t *testing.T) {
+	keys := testKeys(1001)
+
+	tests := []struct {
+		name         string
+		failKeys     []string
+		failCalls    int
+		wantFailures []string
+	}{
+		{
+			name:         "per-key errors",
+			failKeys:     []string{keys[3], keys[1000]},
+			wantFailures: []string{keys[3], keys[1000]},
+		},
+		{
+			name:      "transient failure is retried",
+			failCalls: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeDeleteObjects{failCalls: tt.failCalls, failKeys: map[string]bool{}}
+			for _, key := range tt.failKeys {
+				fake.failKeys[key] = true
+			}
+			s := newTestService(t, fake)
+
+			err := s.DeleteImages(context.Background(), keys)
+
+			if len(tt.wantFailures) == 0 {
+				if err != nil {
+					t.Fatalf("DeleteImages: %v", err)
+				}
+				return
+			}
+
+			var deleteErr *DeleteError
+			if !errors.As(err, &deleteErr) {
+				t.Fatalf("err = %v, want *DeleteError", err)
+			}
+			var got []string
+			for _, failure := range deleteErr.Failures {
+				got = append(got, failure.Key)
+				if failure.Code != "AccessDenied" {
+					t.Errorf("failure %s code = %q, want AccessDenied", failure.Key, failure.Code)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantFailures) {
+				t.Errorf("failed keys = %v, want %v", got, tt.wantFailures)
+			}
+		})
+	}
+}
+
+func TestDeleteImagesChunkFailsEveryAttempt(t *testing.T) {
+	fake := &fakeDeleteObjects{failCalls: 3}
+	s := newTestService(t, fake)
+
+	err := s.DeleteImages(context.Background(), testKeys(1001))
+
+	var deleteErr *DeleteError
+	if !errors.As(err, &deleteErr) {
+		t.Fatalf("err = %v, want *DeleteError", err)
+	}
+	// The first chunk used up all three attempts; the second went through
+	if len(deleteErr.Failures) != 1000 {
+		t.Errorf("failures = %d, want 1000", len(deleteErr.Failures))
+	}
+	if fake.calls != 4 {
+		t.Errorf("DeleteObjects calls = %d, want 4", fake.calls)
+	}
+}
+
+func TestChunkKeysSkipsEmpty(t *testing.T) {
+	chunks := chunkKeys([]string{"a", "", "b", "c", ""}, 2)
+	if fmt.Sprint(chunks) != "[[a b] [c]]" {
+		t.Errorf("chunks = %v, want [[a b] [c]]", chunks)
+	}
+}
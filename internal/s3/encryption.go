@@ -0,0 +1,49 @@
+package s3
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// sseModes are the S3_SSE values accepted; aws:fsx only applies to FSx
+// access points and is left out.
+var sseModes = []types.ServerSideEncryption{
+	types.ServerSideEncryptionAes256,
+	types.ServerSideEncryptionAwsKms,
+	types.ServerSideEncryptionAwsKmsDsse,
+}
+
+// parseSSE validates the server-side encryption settings. A KMS key ID is
+// only accepted with one of the KMS modes; without one S3 uses the account's
+// AWS managed key.
+func parseSSE(mode, kmsKeyID string) (types.ServerSideEncryption, error) {
+	if mode == "" {
+		if kmsKeyID != "" {
+			return "", fmt.Errorf("S3_SSE_KMS_KEY_ID requires S3_SSE=aws:kms or aws:kms:dsse")
+		}
+		return "", nil
+	}
+
+	for _, valid := range sseModes {
+		if strings.EqualFold(mode, string(valid)) {
+			if kmsKeyID != "" && valid == types.ServerSideEncryptionAes256 {
+				return "", fmt.Errorf("S3_SSE_KMS_KEY_ID requires S3_SSE=aws:kms or aws:kms:dsse")
+			}
+			return valid, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid S3_SSE %q: must be AES256, aws:kms or aws:kms:dsse", mode)
+}
+
+// sseKMSKeyID returns the configured KMS key ID for a request input, or nil
+// to leave the header unset.
+func (s *service) sseKMSKeyID() *string {
+	if s.config.SSEKMSKeyID == "" {
+		return nil
+	}
+	return aws.String(s.config.SSEKMSKeyID)
+}
@@ -0,0 +1,45 @@
+package s3
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultImageTypes is the allowlist used when ALLOWED_IMAGE_TYPES is unset.
+const defaultImageTypes = "image/jpeg,image/jpg,image/png,image/webp"
+
+// imageExtensions lists types whose file extension is not their subtype.
+var imageExtensions = map[string]string{
+	"image/jpeg":    ".jpg",
+	"image/jpg":     ".jpg",
+	"image/svg+xml": ".svg",
+	"image/x-icon":  ".ico",
+}
+
+// parseImageTypes reads a comma-separated list of image MIME types into a map
+// from each type to the file extension its objects are stored with.
+func parseImageTypes(value string) (map[string]string, error) {
+	types := make(map[string]string)
+	for _, contentType := range strings.Split(value, ",") {
+		contentType = strings.ToLower(strings.TrimSpace(contentType))
+		if contentType == "" {
+			continue
+		}
+
+		subtype, ok := strings.CutPrefix(contentType, "image/")
+		if !ok || subtype == "" {
+			return nil, fmt.Errorf("%q is not an image type", contentType)
+		}
+
+		ext, ok := imageExtensions[contentType]
+		if !ok {
+			ext = "." + subtype
+		}
+		types[contentType] = ext
+	}
+
+	if len(types) == 0 {
+		return nil, fmt.Errorf("no image types given")
+	}
+	return types, nil
+}
@@ -0,0 +1,11 @@
+package s3
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var operationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "cashflow_s3_errors_total",
+	Help: "Failed S3 operations, by operation.",
+}, []string{"operation"})
@@ -0,0 +1,84 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	retryBaseDelay = 100 * time.Millisecond
+	retryMaxDelay  = 2 * time.Second
+)
+
+// retryableCodes are S3 error codes for throttling and transient server faults.
+var retryableCodes = map[string]bool{
+	"SlowDown":            true,
+	"Throttling":          true,
+	"ThrottlingException": true,
+	"RequestTimeout":      true,
+	"InternalError":       true,
+	"ServiceUnavailable":  true,
+}
+
+// withRetry runs fn up to MaxRetries times, sleeping with exponential backoff
+// and full jitter between attempts. Only throttling and 5xx errors are retried;
+// the last error is returned once attempts run out or ctx is done.
+func (s *service) withRetry(ctx context.Context, fn func(ctx context.Context) error) error {
+	var err error
+	for attempt := 0; attempt < s.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(backoff(attempt))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return errors.Join(err, ctx.Err())
+			case <-timer.C:
+			}
+		}
+
+		if err = fn(ctx); err == nil || !isRetryable(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// noSDKRetry disables the SDK's own retryer for calls wrapped in withRetry so
+// attempts don't multiply.
+func noSDKRetry(o *s3.Options) {
+	o.RetryMaxAttempts = 1
+}
+
+func backoff(attempt int) time.Duration {
+	delay := retryBaseDelay << (attempt - 1)
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return rand.N(delay) + 1
+}
+
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && retryableCodes[apiErr.ErrorCode()] {
+		return true
+	}
+
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		status := respErr.HTTPStatusCode()
+		return status == 429 || status >= 500
+	}
+
+	return false
+}
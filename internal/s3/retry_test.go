@@ -0,0 +1,138 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/smithy-go"
+)
+
+var (
+	errSlowDown  = &smithy.GenericAPIError{Code: "SlowDown", Message: "reduce your request rate"}
+	errNoSuchKey = &smithy.GenericAPIError{Code: "NoSuchKey", Message: "the key does not exist"}
+)
+
+// fakeCall stands in for an S3 client call, returning errs in turn and nil
+// once they run out.
+type fakeCall struct {
+	errs  []error
+	calls int
+	// onCall runs before each call returns, with the 1-based call number
+	onCall func(call int)
+}
+
+func (f *fakeCall) do(ctx context.Context) error {
+	f.calls++
+	if f.onCall != nil {
+		f.onCall(f.calls)
+	}
+	if f.calls <= len(f.errs) {
+		return f.errs[f.calls-1]
+	}
+	return nil
+}
+
+func TestWithRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRetries int
+		errs       []error
+		// cancelOnCall cancels the context during the given call, so the
+		// backoff that follows it is interrupted
+		cancelOnCall int
+		wantCalls    int
+		wantErr      error
+		wantCanceled bool
+	}{
+		{
+			name:       "succeeds first time",
+			maxRetries: 3,
+			wantCalls:  1,
+		},
+		{
+			name:       "fails twice then succeeds",
+			maxRetries: 3,
+			errs:       []error{errSlowDown, errSlowDown},
+			wantCalls:  3,
+		},
+		{
+			name:       "non-retryable error is returned at once",
+			maxRetries: 3,
+			errs:       []error{errNoSuchKey},
+			wantCalls:  1,
+			wantErr:    errNoSuchKey,
+		},
+		{
+			name:       "runs out of attempts",
+			maxRetries: 3,
+			errs:       []error{errSlowDown, errSlowDown, errSlowDown, errSlowDown},
+			wantCalls:  3,
+			wantErr:    errSlowDown,
+		},
+		{
+			name:         "context cancelled during backoff",
+			maxRetries:   3,
+			errs:         []error{errSlowDown, errSlowDown},
+			cancelOnCall: 1,
+			wantCalls:    1,
+			wantErr:      errSlowDown,
+			wantCanceled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			call := &fakeCall{errs: tt.errs}
+			if tt.cancelOnCall > 0 {
+				call.onCall = func(n int) {
+					if n == tt.cancelOnCall {
+						cancel()
+					}
+				}
+			}
+
+			s := &service{config: &Config{MaxRetries: tt.maxRetries}}
+			err := s.withRetry(ctx, call.do)
+
+			if call.calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", call.calls, tt.wantCalls)
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("err = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got := errors.Is(err, context.Canceled); got != tt.wantCanceled {
+				t.Errorf("errors.Is(err, context.Canceled) = %v, want %v", got, tt.wantCanceled)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"throttling code", errSlowDown, true},
+		{"internal error code", &smithy.GenericAPIError{Code: "InternalError"}, true},
+		{"missing key", errNoSuchKey, false},
+		{"context cancelled", context.Canceled, false},
+		{"deadline exceeded", context.DeadlineExceeded, false},
+		{"plain error", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
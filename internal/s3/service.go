@@ -3,7 +3,9 @@ package s3
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
@@ -11,16 +13,35 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
 )
 
+// ErrObjectNotFound is returned by GetObject for a key with no object.
+var ErrObjectNotFound = errors.New("S3 object not found")
+
 type Service interface {
 	UploadImage(ctx context.Context, imageData []byte, contentType string) (url string, key string, err error)
 	DeleteImage(ctx context.Context, key string) error
+	DeleteImages(ctx context.Context, keys []string) error
 	GetPresignedURL(ctx context.Context, key string) (string, error)
-	GeneratePresignedPutURL(ctx context.Context, key string, contentType string, expires time.Duration) (string, error)
+	URLExpiration() time.Duration
+	GeneratePresignedPutURL(ctx context.Context, key string, contentType string, contentLength int64, expires time.Duration) (*PresignedPut, error)
 	ObjectExists(ctx context.Context, key string) (bool, error)
+	ObjectSize(ctx context.Context, key string) (int64, error)
+	MaxImageSize() int64
+	StagingPrefix() string
+	TransactionsPrefix() string
+	AllowedImageType(contentType string) bool
+	ImageExtension(contentType string) string
 	CopyObject(ctx context.Context, sourceKey string, destKey string) error
+	GetObject(ctx context.Context, key string) (*Object, error)
+	ReadObject(ctx context.Context, key string) ([]byte, string, error)
+	GetObjectPrefix(ctx context.Context, key string, n int64) ([]byte, error)
+	PutObject(ctx context.Context, key string, data []byte, contentType string) error
+	HealthCheck(ctx context.Context) error
 }
 
 type service struct {
@@ -30,19 +51,26 @@ type service struct {
 }
 
 func NewService(cfg *Config) (Service, error) {
-	awsConfig, err := config.LoadDefaultConfig(context.Background(),
-		config.WithRegion(cfg.Region),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+	opts := []func(*config.LoadOptions) error{config.WithRegion(cfg.Region)}
+	if cfg.AccessKeyID != "" {
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
 			cfg.AccessKeyID,
 			cfg.SecretAccessKey,
 			"",
-		)),
-	)
+		)))
+	}
+
+	awsConfig, err := config.LoadDefaultConfig(context.Background(), opts...)
 	if err != nil {
 		return nil, fmt.Errorf("loading AWS config: %w", err)
 	}
 
-	client := s3.NewFromConfig(awsConfig)
+	client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		if cfg.EndpointURL != "" {
+			o.BaseEndpoint = aws.String(cfg.EndpointURL)
+		}
+		o.UsePathStyle = cfg.UsePathStyle
+	})
 	presignClient := s3.NewPresignClient(client)
 
 	return &service{
@@ -54,29 +82,35 @@ func NewService(cfg *Config) (Service, error) {
 
 func (s *service) UploadImage(ctx context.Context, imageData []byte, contentType string) (string, string, error) {
 	if int64(len(imageData)) > s.config.MaxImageSize {
-		return "", "", fmt.Errorf("image size exceeds maximum allowed size of %d bytes", s.config.MaxImageSize)
+		return "", "", apperror.Invalid(apperror.CodeFileTooLarge, "image size exceeds maximum allowed size of %d bytes", s.config.MaxImageSize)
 	}
 
-	if !isValidContentType(contentType) {
-		return "", "", fmt.Errorf("invalid content type: %s", contentType)
+	if !s.AllowedImageType(contentType) {
+		return "", "", apperror.Invalid(apperror.CodeInvalidContentType, "invalid content type: %s", contentType)
 	}
 
 	now := time.Now()
-	key := fmt.Sprintf("transactions/%d/%02d/%s_%d.jpg",
+	key := fmt.Sprintf("%s%d/%02d/%s_%d.jpg",
+		s.config.TransactionsPrefix,
 		now.Year(),
 		now.Month(),
 		uuid.New().String(),
 		now.Unix(),
 	)
 
-	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:      aws.String(s.config.BucketName),
-		Key:         aws.String(key),
-		Body:        bytes.NewReader(imageData),
-		ContentType: aws.String(contentType),
-		Metadata: map[string]string{
-			"upload-time": now.Format(time.RFC3339),
-		},
+	err := s.withRetry(ctx, func(ctx context.Context) error {
+		_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(s.config.BucketName),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(imageData),
+			ContentType: aws.String(contentType),
+			Metadata: map[string]string{
+				"upload-time": now.Format(time.RFC3339),
+			},
+			ServerSideEncryption: s.config.ServerSideEncryption,
+			SSEKMSKeyId:          s.sseKMSKeyID(),
+		}, noSDKRetry)
+		return err
 	})
 	if err != nil {
 		return "", "", fmt.Errorf("uploading to S3: %w", err)
@@ -106,11 +140,54 @@ func (s *service) DeleteImage(ctx context.Context, key string) error {
 	return nil
 }
 
+// DeleteImages deletes keys with the DeleteObjects batch API, in chunks of up
+// to maxDeleteBatch keys. Every chunk is attempted, each with retries; if any
+// key could not be deleted the returned error is a *DeleteError listing them.
+func (s *service) DeleteImages(ctx context.Context, keys []string) error {
+	var failures []DeleteFailure
+	for _, chunk := range chunkKeys(keys, maxDeleteBatch) {
+		objects := make([]types.ObjectIdentifier, len(chunk))
+		for i, key := range chunk {
+			objects[i] = types.ObjectIdentifier{Key: aws.String(key)}
+		}
+
+		var output *s3.DeleteObjectsOutput
+		err := s.withRetry(ctx, func(ctx context.Context) error {
+			var err error
+			output, err = s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+				Bucket: aws.String(s.config.BucketName),
+				Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+			}, noSDKRetry)
+			return err
+		})
+		if err != nil {
+			for _, key := range chunk {
+				failures = append(failures, DeleteFailure{Key: key, Message: err.Error()})
+			}
+			continue
+		}
+
+		for _, e := range output.Errors {
+			failures = append(failures, DeleteFailure{
+				Key:     aws.ToString(e.Key),
+				Code:    aws.ToString(e.Code),
+				Message: aws.ToString(e.Message),
+			})
+		}
+	}
+
+	if len(failures) > 0 {
+		return &DeleteError{Failures: failures}
+	}
+	return nil
+}
+
 func (s *service) GetPresignedURL(ctx context.Context, key string) (string, error) {
 	if key == "" {
 		return "", nil
 	}
 
+	// Presigning only signs locally, so there is nothing to retry
 	request, err := s.presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.config.BucketName),
 		Key:    aws.String(key),
@@ -118,25 +195,48 @@ func (s *service) GetPresignedURL(ctx context.Context, key string) (string, erro
 		opts.Expires = s.config.URLExpiration
 	})
 	if err != nil {
+		operationErrors.WithLabelValues("presign_get").Inc()
 		return "", fmt.Errorf("creating presigned URL: %w", err)
 	}
 
 	return request.URL, nil
 }
 
-func (s *service) GeneratePresignedPutURL(ctx context.Context, key string, contentType string, expires time.Duration) (string, error) {
+// PresignedPut is a presigned PUT request. Headers are part of the signature,
+// so the upload must send them with exactly these values.
+type PresignedPut struct {
+	URL     string
+	Headers map[string]string
+}
+
+// GeneratePresignedPutURL presigns a PUT of key with the content type and
+// length signed in, so S3 itself rejects a body of another size or type.
+func (s *service) GeneratePresignedPutURL(ctx context.Context, key string, contentType string, contentLength int64, expires time.Duration) (*PresignedPut, error) {
 	request, err := s.presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
-		Bucket:      aws.String(s.config.BucketName),
-		Key:         aws.String(key),
-		ContentType: aws.String(contentType),
+		Bucket:        aws.String(s.config.BucketName),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(contentLength),
+		// Encryption headers stay signed headers rather than query
+		// parameters, so they reach the client through Headers
+		ServerSideEncryption: s.config.ServerSideEncryption,
+		SSEKMSKeyId:          s.sseKMSKeyID(),
 	}, func(opts *s3.PresignOptions) {
 		opts.Expires = expires
 	})
 	if err != nil {
-		return "", fmt.Errorf("generating presigned PUT URL: %w", err)
+		return nil, fmt.Errorf("generating presigned PUT URL: %w", err)
 	}
 
-	return request.URL, nil
+	// Host is set by every HTTP client from the URL
+	headers := make(map[string]string, len(request.SignedHeader))
+	for name := range request.SignedHeader {
+		if !strings.EqualFold(name, "Host") {
+			headers[name] = request.SignedHeader.Get(name)
+		}
+	}
+
+	return &PresignedPut{URL: request.URL, Headers: headers}, nil
 }
 
 func (s *service) ObjectExists(ctx context.Context, key string) (bool, error) {
@@ -146,8 +246,7 @@ func (s *service) ObjectExists(ctx context.Context, key string) (bool, error) {
 	})
 
 	if err != nil {
-		// Check if the error is because the object doesn't exist
-		if strings.Contains(err.Error(), "NotFound") {
+		if isNotFound(err) {
 			return false, nil
 		}
 		return false, fmt.Errorf("checking object existence: %w", err)
@@ -156,13 +255,52 @@ func (s *service) ObjectExists(ctx context.Context, key string) (bool, error) {
 	return true, nil
 }
 
+// ObjectSize returns the stored size of an object in bytes.
+func (s *service) ObjectSize(ctx context.Context, key string) (int64, error) {
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.config.BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("getting object size: %w", err)
+	}
+
+	return aws.ToInt64(output.ContentLength), nil
+}
+
+// URLExpiration is how long URLs from GetPresignedURL stay valid.
+func (s *service) URLExpiration() time.Duration {
+	return s.config.URLExpiration
+}
+
+// MaxImageSize is the largest image, in bytes, the service accepts.
+func (s *service) MaxImageSize() int64 {
+	return s.config.MaxImageSize
+}
+
+// StagingPrefix is the key prefix presigned uploads are written under.
+func (s *service) StagingPrefix() string {
+	return s.config.StagingPrefix
+}
+
+// TransactionsPrefix is the key prefix for images linked to transactions.
+func (s *service) TransactionsPrefix() string {
+	return s.config.TransactionsPrefix
+}
+
 func (s *service) CopyObject(ctx context.Context, sourceKey string, destKey string) error {
 	copySource := fmt.Sprintf("%s/%s", s.config.BucketName, sourceKey)
 
-	_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
-		Bucket:     aws.String(s.config.BucketName),
-		CopySource: aws.String(copySource),
-		Key:        aws.String(destKey),
+	err := s.withRetry(ctx, func(ctx context.Context) error {
+		_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(s.config.BucketName),
+			CopySource: aws.String(copySource),
+			Key:        aws.String(destKey),
+			// A copy is encrypted as requested here, not as its source was
+			ServerSideEncryption: s.config.ServerSideEncryption,
+			SSEKMSKeyId:          s.sseKMSKeyID(),
+		}, noSDKRetry)
+		return err
 	})
 
 	if err != nil {
@@ -172,13 +310,141 @@ func (s *service) CopyObject(ctx context.Context, sourceKey string, destKey stri
 	return nil
 }
 
-func isValidContentType(contentType string) bool {
-	validTypes := map[string]bool{
-		"image/jpeg": true,
-		"image/jpg":  true,
-		"image/png":  true,
-		"image/webp": true,
+// Object is an object opened for reading. The caller must close Body.
+// ContentLength is -1 when S3 didn't report it.
+type Object struct {
+	Body          io.ReadCloser
+	ContentType   string
+	ContentLength int64
+}
+
+// GetObject opens an object for reading. The caller must close its body. A
+// missing object returns ErrObjectNotFound.
+func (s *service) GetObject(ctx context.Context, key string) (*Object, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.config.BucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("getting S3 object: %w", err)
+	}
+
+	contentLength := int64(-1)
+	if output.ContentLength != nil {
+		contentLength = *output.ContentLength
+	}
+
+	return &Object{
+		Body:          output.Body,
+		ContentType:   aws.ToString(output.ContentType),
+		ContentLength: contentLength,
+	}, nil
+}
+
+// ReadObject downloads a whole object, returning its body and content type.
+// Bodies larger than MaxImageSize are rejected.
+func (s *service) ReadObject(ctx context.Context, key string) ([]byte, string, error) {
+	object, err := s.GetObject(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	defer object.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(object.Body, s.config.MaxImageSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("reading S3 object: %w", err)
+	}
+	if int64(len(data)) > s.config.MaxImageSize {
+		return nil, "", fmt.Errorf("object exceeds maximum size of %d bytes", s.config.MaxImageSize)
+	}
+
+	return data, object.ContentType, nil
+}
+
+// GetObjectPrefix downloads at most the first n bytes of an object.
+func (s *service) GetObjectPrefix(ctx context.Context, key string, n int64) ([]byte, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.config.BucketName),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", n-1)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting S3 object range: %w", err)
+	}
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(output.Body, n))
+	if err != nil {
+		return nil, fmt.Errorf("reading S3 object range: %w", err)
+	}
+
+	return data, nil
+}
+
+// PutObject writes data to key, retrying transient failures.
+func (s *service) PutObject(ctx context.Context, key string, data []byte, contentType string) error {
+	err := s.withRetry(ctx, func(ctx context.Context) error {
+		_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:               aws.String(s.config.BucketName),
+			Key:                  aws.String(key),
+			Body:                 bytes.NewReader(data),
+			ContentType:          aws.String(contentType),
+			ServerSideEncryption: s.config.ServerSideEncryption,
+			SSEKMSKeyId:          s.sseKMSKeyID(),
+		}, noSDKRetry)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("putting S3 object: %w", err)
+	}
+
+	return nil
+}
+
+// HealthCheck verifies the bucket is reachable with the configured credentials.
+func (s *service) HealthCheck(ctx context.Context) error {
+	_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.config.BucketName),
+	})
+	if err != nil {
+		return fmt.Errorf("checking bucket: %w", err)
+	}
+
+	return nil
+}
+
+// isNotFound reports whether err means the object doesn't exist. HeadObject
+// returns *types.NotFound; other operations use the NoSuchKey code.
+func isNotFound(err error) bool {
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NotFound", "NoSuchKey":
+			return true
+		}
 	}
-	return validTypes[contentType]
+
+	return false
+}
+
+// AllowedImageType reports whether contentType is in the configured image
+// allowlist.
+func (s *service) AllowedImageType(contentType string) bool {
+	_, ok := s.config.ImageTypes[contentType]
+	return ok
+}
+
+// ImageExtension returns the file extension, with its dot, that objects of an
+// allowed content type are stored with, or "" for any other type.
+func (s *service) ImageExtension(contentType string) string {
+	return s.config.ImageTypes[contentType]
 }
 
@@ -0,0 +1,128 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestIsNotFound(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "HeadObject not found", err: &types.NotFound{}, want: true},
+		{name: "NoSuchKey code", err: &smithy.GenericAPIError{Code: "NoSuchKey"}, want: true},
+		{name: "NotFound code", err: &smithy.GenericAPIError{Code: "NotFound"}, want: true},
+		{name: "typed NoSuchKey", err: &types.NoSuchKey{}, want: true},
+		{name: "wrapped", err: fmt.Errorf("operation error S3: GetObject: %w", &smithy.GenericAPIError{Code: "NoSuchKey"}), want: true},
+		{name: "wrapped typed", err: fmt.Errorf("checking: %w", &types.NotFound{}), want: true},
+		{name: "access denied", err: &smithy.GenericAPIError{Code: "AccessDenied"}, want: false},
+		{name: "unrelated", err: errors.New("connection reset by peer"), want: false},
+		{name: "nil", err: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isNotFound(tt.err); got != tt.want {
+				t.Errorf("isNotFound(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestObjectExistsNotFound checks isNotFound against the errors the SDK
+// actually builds from S3 responses, not just hand-made ones.
+func TestObjectExistsNotFound(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		want    bool
+		wantErr bool
+	}{
+		{name: "exists", status: http.StatusOK, want: true},
+		{name: "missing", status: http.StatusNotFound, want: false},
+		{name: "forbidden", status: http.StatusForbidden, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// HEAD responses carry no body, so the SDK only has the status
+				w.WriteHeader(tt.status)
+			}))
+
+			got, err := s.ObjectExists(context.Background(), "staging/a.jpg")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ObjectExists = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetObject(t *testing.T) {
+	tests := []struct {
+		name              string
+		chunked           bool
+		status            int
+		wantContentLength int64
+		wantErr           error
+	}{
+		{name: "length from S3", status: http.StatusOK, wantContentLength: 11},
+		{name: "length unknown", status: http.StatusOK, chunked: true, wantContentLength: -1},
+		{name: "missing", status: http.StatusNotFound, wantErr: ErrObjectNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.status != http.StatusOK {
+					w.WriteHeader(tt.status)
+					fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+					return
+				}
+				w.Header().Set("Content-Type", "image/jpeg")
+				if !tt.chunked {
+					w.Header().Set("Content-Length", "11")
+				}
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprint(w, "image bytes")
+				if tt.chunked {
+					w.(http.Flusher).Flush()
+				}
+			}))
+
+			object, err := s.GetObject(context.Background(), "transactions/a.jpg")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetObject: %v", err)
+			}
+			defer object.Body.Close()
+
+			if object.ContentLength != tt.wantContentLength {
+				t.Errorf("ContentLength = %d, want %d", object.ContentLength, tt.wantContentLength)
+			}
+			if object.ContentType != "image/jpeg" {
+				t.Errorf("ContentType = %q, want image/jpeg", object.ContentType)
+			}
+			if body, _ := io.ReadAll(object.Body); string(body) != "image bytes" {
+				t.Errorf("body = %q, want image bytes", body)
+			}
+		})
+	}
+}
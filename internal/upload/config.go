@@ -0,0 +1,87 @@
+package upload
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// maxURLExpiration caps UPLOAD_URL_EXPIRATION so a leaked upload URL cannot
+// stay usable for long.
+const maxURLExpiration = time.Hour
+
+type Config struct {
+	CleanupInterval    time.Duration
+	CleanupBatchSize   int
+	CleanupConcurrency int
+	// NormalizeImages re-encodes non-JPEG uploads as JPEG when they are linked.
+	NormalizeImages bool
+	// StripEXIF re-encodes JPEG and PNG uploads carrying EXIF metadata when
+	// they are linked, so photo locations aren't stored.
+	StripEXIF bool
+	// URLExpiration is how long presigned upload URLs stay valid.
+	URLExpiration time.Duration
+	// EventSecret authenticates S3 event notifications. When it is set,
+	// uploads are completed by events instead of by polling S3.
+	EventSecret string
+}
+
+func NewConfig() (*Config, error) {
+	cleanupInterval := time.Hour
+	if v := os.Getenv("UPLOAD_CLEANUP_INTERVAL"); v != "" {
+		duration, err := time.ParseDuration(v)
+		if err == nil && duration > 0 {
+			cleanupInterval = duration
+		}
+	}
+
+	batchSize := 100
+	if v := os.Getenv("UPLOAD_CLEANUP_BATCH_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err == nil && size > 0 {
+			batchSize = size
+		}
+	}
+
+	concurrency := 5
+	if v := os.Getenv("UPLOAD_CLEANUP_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			concurrency = n
+		}
+	}
+
+	normalizeImages := false
+	if v := os.Getenv("NORMALIZE_IMAGES"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err == nil {
+			normalizeImages = enabled
+		}
+	}
+
+	stripEXIF := true
+	if v := os.Getenv("STRIP_EXIF"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err == nil {
+			stripEXIF = enabled
+		}
+	}
+
+	urlExpiration := 15 * time.Minute
+	if v := os.Getenv("UPLOAD_URL_EXPIRATION"); v != "" {
+		duration, err := time.ParseDuration(v)
+		if err == nil && duration > 0 {
+			urlExpiration = min(duration, maxURLExpiration)
+		}
+	}
+
+	return &Config{
+		CleanupInterval:    cleanupInterval,
+		CleanupBatchSize:   batchSize,
+		CleanupConcurrency: concurrency,
+		NormalizeImages:    normalizeImages,
+		StripEXIF:          stripEXIF,
+		URLExpiration:      urlExpiration,
+		EventSecret:        os.Getenv("UPLOAD_EVENT_SECRET"),
+	}, nil
+}
@@ -0,0 +1,72 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// EventSecretHeader carries the shared secret that authenticates S3 event
+// notifications.
+const EventSecretHeader = "X-Upload-Event-Secret"
+
+// S3Event is an S3 event notification, as delivered to SQS, Lambda or
+// forwarded by them. S3's test event has no records.
+type S3Event struct {
+	Records []S3EventRecord `json:"Records"`
+}
+
+type S3EventRecord struct {
+	EventName string `json:"eventName"`
+	S3        struct {
+		Bucket struct {
+			Name string `json:"name"`
+		} `json:"bucket"`
+		Object struct {
+			// Key is URL-encoded, with spaces as '+'
+			Key  string `json:"key"`
+			Size int64  `json:"size"`
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+// HandleS3Event marks the pending uploads whose staging objects the event
+// reports as created completed, and returns how many it marked. Other event
+// types, other prefixes and keys with no pending upload are ignored, so S3 can
+// redeliver an event safely.
+func (s *service) HandleS3Event(ctx context.Context, event S3Event) (int, error) {
+	completed := 0
+	for _, record := range event.Records {
+		if !strings.HasPrefix(record.EventName, "ObjectCreated:") {
+			continue
+		}
+
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			s.logger.Warn("ignoring S3 event with malformed key",
+				slog.String("key", record.S3.Object.Key))
+			continue
+		}
+		if !strings.HasPrefix(key, s.s3Service.StagingPrefix()) {
+			continue
+		}
+
+		uploadID, err := s.repo.CompletePendingByS3Key(ctx, key)
+		if err != nil {
+			return completed, fmt.Errorf("completing upload for %s: %w", key, err)
+		}
+		if uploadID == "" {
+			continue
+		}
+
+		completed++
+		s.logger.Info("upload completed by S3 event",
+			slog.String("upload_id", uploadID),
+			slog.String("s3_key", key),
+			slog.Int64("size", record.S3.Object.Size))
+	}
+
+	return completed, nil
+}
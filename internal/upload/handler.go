@@ -2,9 +2,12 @@ package upload
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kranti/cashflow/internal/apperror"
 )
 
 type Handler struct {
@@ -15,6 +18,12 @@ type Handler struct {
 type Service interface {
 	RequestUpload(ctx context.Context, req UploadRequest) (*UploadResponse, error)
 	GetUploadStatus(ctx context.Context, uploadID string) (*UploadStatusResponse, error)
+	GetUploadStatusByKey(ctx context.Context, key string) (*UploadStatusResponse, error)
+	CancelUpload(ctx context.Context, uploadID string) error
+	MarkFailed(ctx context.Context, uploadID string) error
+	HandleS3Event(ctx context.Context, event S3Event) (int, error)
+	CleanupOrphanedUploads(ctx context.Context, dryRun bool) (*CleanupResult, error)
+	ReconcileUpload(ctx context.Context, uploadID string) (*UploadStatusResponse, error)
 }
 
 func NewHandler(service Service, logger *slog.Logger) *Handler {
@@ -28,8 +37,9 @@ func (h *Handler) RequestUpload(c *gin.Context) {
 	var req UploadRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.logger.Error("failed to bind upload request",
-			slog.String("error", err.Error()))
-		c.JSON(400, gin.H{"error": "Invalid request body", "details": err.Error()})
+			slog.String("error", err.Error()),
+			slog.String("request_id", c.GetString(apperror.RequestIDKey)))
+		apperror.Respond(c, bindError(err), "")
 		return
 	}
 
@@ -38,8 +48,9 @@ func (h *Handler) RequestUpload(c *gin.Context) {
 		h.logger.Error("failed to create upload request",
 			slog.String("error", err.Error()),
 			slog.String("content_type", req.ContentType),
-			slog.Int64("file_size", req.FileSize))
-		c.JSON(400, gin.H{"error": err.Error()})
+			slog.Int64("file_size", req.FileSize),
+			slog.String("request_id", c.GetString(apperror.RequestIDKey)))
+		apperror.Respond(c, err, "Failed to create upload request")
 		return
 	}
 
@@ -49,18 +60,156 @@ func (h *Handler) RequestUpload(c *gin.Context) {
 func (h *Handler) GetUploadStatus(c *gin.Context) {
 	uploadID := c.Param("id")
 	if uploadID == "" {
-		c.JSON(400, gin.H{"error": "upload ID is required"})
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "upload ID is required"), "")
 		return
 	}
 
 	status, err := h.service.GetUploadStatus(c.Request.Context(), uploadID)
 	if err != nil {
-		h.logger.Error("failed to get upload status",
+		if !errors.Is(err, ErrUploadNotFound) {
+			h.logger.Error("failed to get upload status",
+				slog.String("error", err.Error()),
+				slog.String("upload_id", uploadID),
+				slog.String("request_id", c.GetString(apperror.RequestIDKey)))
+		}
+		apperror.Respond(c, err, "Failed to get upload status")
+		return
+	}
+
+	c.JSON(200, status)
+}
+
+// GetUploadStatusByKey serves reconciliation jobs that know an object's S3
+// key but not its upload ID.
+func (h *Handler) GetUploadStatusByKey(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "key is required"), "")
+		return
+	}
+
+	status, err := h.service.GetUploadStatusByKey(c.Request.Context(), key)
+	if err != nil {
+		if apperror.Status(err) >= 500 {
+			h.logger.Error("failed to get upload status by key",
+				slog.String("error", err.Error()),
+				slog.String("key", key),
+				slog.String("request_id", c.GetString(apperror.RequestIDKey)))
+		}
+		apperror.Respond(c, err, "Failed to get upload status")
+		return
+	}
+
+	c.JSON(200, status)
+}
+
+func (h *Handler) CancelUpload(c *gin.Context) {
+	uploadID := c.Param("id")
+	if uploadID == "" {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "upload ID is required"), "")
+		return
+	}
+
+	if err := h.service.CancelUpload(c.Request.Context(), uploadID); err != nil {
+		if apperror.Status(err) >= 500 {
+			h.logger.Error("failed to cancel upload",
+				slog.String("error", err.Error()),
+				slog.String("upload_id", uploadID),
+				slog.String("request_id", c.GetString(apperror.RequestIDKey)))
+		}
+		apperror.Respond(c, err, "Failed to cancel upload")
+		return
+	}
+
+	c.Status(204)
+}
+
+// MarkFailed lets a client report that its upload to S3 failed.
+func (h *Handler) MarkFailed(c *gin.Context) {
+	uploadID := c.Param("id")
+	if uploadID == "" {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "upload ID is required"), "")
+		return
+	}
+
+	if err := h.service.MarkFailed(c.Request.Context(), uploadID); err != nil {
+		if apperror.Status(err) >= 500 {
+			h.logger.Error("failed to mark upload failed",
+				slog.String("error", err.Error()),
+				slog.String("upload_id", uploadID),
+				slog.String("request_id", c.GetString(apperror.RequestIDKey)))
+		}
+		apperror.Respond(c, err, "Failed to mark upload failed")
+		return
+	}
+
+	c.Status(204)
+}
+
+// HandleS3Event receives S3 object-created notifications for the staging
+// prefix. The route is authenticated by EventSecretHeader, not an API key.
+func (h *Handler) HandleS3Event(c *gin.Context) {
+	var event S3Event
+	if err := c.ShouldBindJSON(&event); err != nil {
+		apperror.Respond(c, apperror.InvalidBody(err), "")
+		return
+	}
+
+	completed, err := h.service.HandleS3Event(c.Request.Context(), event)
+	if err != nil {
+		h.logger.Error("failed to handle S3 event",
+			slog.String("error", err.Error()),
+			slog.Int("records", len(event.Records)),
+			slog.String("request_id", c.GetString(apperror.RequestIDKey)))
+		apperror.Respond(c, err, "Failed to handle S3 event")
+		return
+	}
+
+	c.JSON(200, gin.H{"completed": completed})
+}
+
+// CleanupOrphanedUploads runs one batch of the orphan cleanup on demand. With
+// dry_run=true it only reports what the scheduled job would clean up.
+func (h *Handler) CleanupOrphanedUploads(c *gin.Context) {
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "dry_run must be true or false"), "")
+		return
+	}
+
+	result, err := h.service.CleanupOrphanedUploads(c.Request.Context(), dryRun)
+	if err != nil {
+		h.logger.Error("failed to clean up orphaned uploads",
 			slog.String("error", err.Error()),
-			slog.String("upload_id", uploadID))
-		c.JSON(404, gin.H{"error": "Upload not found"})
+			slog.Bool("dry_run", dryRun),
+			slog.String("request_id", c.GetString(apperror.RequestIDKey)))
+		apperror.Respond(c, err, "Failed to clean up orphaned uploads")
+		return
+	}
+
+	c.JSON(200, result)
+}
+
+// ReconcileUpload lets support fix a single upload whose status disagrees
+// with S3, such as one left pending after its file arrived.
+func (h *Handler) ReconcileUpload(c *gin.Context) {
+	uploadID := c.Param("id")
+	if uploadID == "" {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "upload ID is required"), "")
+		return
+	}
+
+	status, err := h.service.ReconcileUpload(c.Request.Context(), uploadID)
+	if err != nil {
+		if apperror.Status(err) >= 500 {
+			h.logger.Error("failed to reconcile upload",
+				slog.String("error", err.Error()),
+				slog.String("upload_id", uploadID),
+				slog.String("request_id", c.GetString(apperror.RequestIDKey)))
+		}
+		apperror.Respond(c, err, "Failed to reconcile upload")
 		return
 	}
 
 	c.JSON(200, status)
-}
\ No newline at end of file
+}
@@ -0,0 +1,39 @@
+package upload
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// pendingCountTimeout bounds the query run on each metrics scrape.
+const pendingCountTimeout = 2 * time.Second
+
+var orphansCleaned = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "cashflow_upload_orphans_cleaned_total",
+	Help: "Orphaned uploads deleted from S3 and marked expired by the cleanup worker.",
+})
+
+// NewPendingUploadsGauge returns a gauge that counts pending uploads in the
+// database at scrape time. A failed count is reported as NaN.
+func NewPendingUploadsGauge(repo Repository, logger *slog.Logger) prometheus.GaugeFunc {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "cashflow_uploads_pending",
+		Help: "Upload requests still waiting for their file.",
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), pendingCountTimeout)
+		defer cancel()
+
+		count, err := repo.CountByStatus(ctx, UploadStatusPending)
+		if err != nil {
+			logger.Warn("failed to count pending uploads",
+				slog.String("error", err.Error()))
+			return math.NaN()
+		}
+		return float64(count)
+	})
+}
@@ -15,9 +15,12 @@ const (
 	UploadStatusExpired   UploadStatus = "expired"
 )
 
+// UploadRequest carries no binding tags; it is checked by
+// validateUploadRequest, which reports every failing field at once.
 type UploadRequest struct {
-	ContentType string `json:"content_type" binding:"required"`
-	FileSize    int64  `json:"file_size" binding:"required,min=1,max=10485760"` // Max 10MB
+	ContentType string `json:"content_type"`
+	// FileSize is checked against the configured maximum image size
+	FileSize int64 `json:"file_size"`
 }
 
 type UploadResponse struct {
@@ -31,6 +34,7 @@ type UploadResponse struct {
 
 type UploadRecord struct {
 	ID                     uuid.UUID     `json:"id"`
+	UserID                 uuid.UUID     `json:"-"`
 	UploadID               string        `json:"upload_id"`
 	S3Key                  string        `json:"s3_key"`
 	ContentType            string        `json:"content_type"`
@@ -42,6 +46,14 @@ type UploadRecord struct {
 	TransactionID          *uuid.UUID    `json:"transaction_id,omitempty"`
 }
 
+// LinkedUpload describes an upload moved to permanent storage, ready to be
+// linked to a transaction.
+type LinkedUpload struct {
+	Key          string
+	ThumbnailKey string
+	ContentType  string
+}
+
 type UploadStatusResponse struct {
 	UploadID    string       `json:"upload_id"`
 	Status      UploadStatus `json:"status"`
@@ -50,4 +62,12 @@ type UploadStatusResponse struct {
 	FileSize    int64        `json:"file_size"`
 	CreatedAt   time.Time    `json:"created_at"`
 	CompletedAt *time.Time   `json:"completed_at,omitempty"`
-}
\ No newline at end of file
+}
+
+// CleanupResult lists the orphaned uploads a cleanup run expired, or would
+// have expired in a dry run.
+type CleanupResult struct {
+	DryRun  bool            `json:"dry_run"`
+	Count   int             `json:"count"`
+	Uploads []*UploadRecord `json:"uploads"`
+}
@@ -0,0 +1,67 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"log/slog"
+	"path"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+// jpegQuality is the encoder quality used when normalizing images.
+const jpegQuality = 90
+
+func isJPEG(contentType string) bool {
+	return contentType == "image/jpeg" || contentType == "image/jpg"
+}
+
+// normalizeToJPEG downloads the staged object, re-encodes it as JPEG and writes
+// it next to permanentKey with a .jpg extension. It reports false, leaving the
+// original to be copied as-is, when any step fails.
+func (s *service) normalizeToJPEG(ctx context.Context, record *UploadRecord, permanentKey string) (string, bool) {
+	data, _, err := s.s3Service.ReadObject(ctx, record.S3Key)
+	if err != nil {
+		s.logger.Warn("failed to download image for normalization",
+			slog.String("error", err.Error()),
+			slog.String("key", record.S3Key))
+		return permanentKey, false
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		s.logger.Warn("failed to decode image, keeping original",
+			slog.String("error", err.Error()),
+			slog.String("upload_id", record.UploadID),
+			slog.String("content_type", record.ContentType))
+		return permanentKey, false
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, applyOrientation(img, exifOrientation(data, format)), &jpeg.Options{Quality: jpegQuality}); err != nil {
+		s.logger.Warn("failed to encode JPEG, keeping original",
+			slog.String("error", err.Error()),
+			slog.String("upload_id", record.UploadID))
+		return permanentKey, false
+	}
+
+	jpegKey := strings.TrimSuffix(permanentKey, path.Ext(permanentKey)) + ".jpg"
+	if err := s.s3Service.PutObject(ctx, jpegKey, buf.Bytes(), "image/jpeg"); err != nil {
+		s.logger.Warn("failed to store normalized image, keeping original",
+			slog.String("error", err.Error()),
+			slog.String("key", jpegKey))
+		return permanentKey, false
+	}
+
+	s.logger.Info("normalized image to JPEG",
+		slog.String("upload_id", record.UploadID),
+		slog.String("from_format", format),
+		slog.Int("original_size", len(data)),
+		slog.Int("normalized_size", buf.Len()))
+
+	return jpegKey, true
+}
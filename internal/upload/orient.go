@@ -0,0 +1,156 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// exifOrientationTag is the TIFF tag holding how a camera was held, from 1,
+// upright, to 8. Re-encoding drops it, so it must be applied to the pixels.
+const exifOrientationTag = 0x0112
+
+// exifOrientation returns the EXIF orientation of a JPEG or PNG image, or 1
+// when there is none or the EXIF can't be read.
+func exifOrientation(data []byte, format string) int {
+	var tiff []byte
+	switch format {
+	case "jpeg":
+		tiff = jpegEXIF(data)
+	case "png":
+		tiff = pngEXIF(data)
+	}
+
+	orientation := tiffOrientation(tiff)
+	if orientation < 1 || orientation > 8 {
+		return 1
+	}
+	return orientation
+}
+
+// jpegEXIF returns the TIFF payload of the APP1 EXIF segment of a JPEG. Only
+// the segments before the image data are searched.
+func jpegEXIF(data []byte) []byte {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return nil
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, exifMarkers["jpeg"]) {
+			return segment[len(exifMarkers["jpeg"]):]
+		}
+		i += 2 + length
+	}
+	return nil
+}
+
+// pngEXIF returns the payload of the eXIf chunk of a PNG, which is TIFF.
+func pngEXIF(data []byte) []byte {
+	const signatureLen = 8
+	for i := signatureLen; i+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		chunkType := data[i+4 : i+8]
+		if length < 0 || i+8+length > len(data) {
+			return nil
+		}
+		if bytes.Equal(chunkType, exifMarkers["png"]) {
+			return data[i+8 : i+8+length]
+		}
+		if string(chunkType) == "IDAT" {
+			return nil
+		}
+		// Skip the length, type, data and CRC
+		i += 12 + length
+	}
+	return nil
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of TIFF data,
+// returning 0 when it is absent.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == exifOrientationTag {
+			// A SHORT value sits in the first two bytes of the value field
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// applyOrientation rotates and flips img so it displays upright without its
+// EXIF orientation. Orientations 5 to 8 swap width and height.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// sx, sy is the source pixel shown at x, y
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
@@ -3,19 +3,31 @@ package upload
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
 )
 
 type Repository interface {
 	Create(ctx context.Context, record *UploadRecord) error
-	GetByUploadID(ctx context.Context, uploadID string) (*UploadRecord, error)
+	GetByUploadID(ctx context.Context, userID uuid.UUID, uploadID string) (*UploadRecord, error)
+	GetByS3Key(ctx context.Context, userID uuid.UUID, key string) (*UploadRecord, error)
+	GetAnyByUploadID(ctx context.Context, uploadID string) (*UploadRecord, error)
+	ListByTransactionID(ctx context.Context, userID uuid.UUID, transactionID uuid.UUID) ([]*UploadRecord, error)
 	UpdateStatus(ctx context.Context, uploadID string, status UploadStatus) error
+	TransitionStatus(ctx context.Context, uploadID string, from, to UploadStatus) (bool, error)
+	CompletePendingByS3Key(ctx context.Context, key string) (string, error)
 	LinkToTransaction(ctx context.Context, uploadID string, transactionID uuid.UUID) error
-	GetOrphanedUploads(ctx context.Context, olderThan int) ([]*UploadRecord, error)
+	UpdateContentType(ctx context.Context, uploadID string, contentType string) error
+	GetOrphanedUploads(ctx context.Context, olderThan int, limit int) ([]*UploadRecord, error)
+	CountByStatus(ctx context.Context, status UploadStatus) (int64, error)
 }
 
+// ErrUploadNotFound is returned when no upload matches the given ID.
+var ErrUploadNotFound = apperror.New(404, apperror.CodeUploadNotFound, "upload not found")
+
 type repository struct {
 	db *sql.DB
 }
@@ -27,13 +39,14 @@ func NewRepository(db *sql.DB) Repository {
 func (r *repository) Create(ctx context.Context, record *UploadRecord) error {
 	query := `
 		INSERT INTO upload_requests (
-			id, upload_id, s3_key, content_type, file_size,
+			id, user_id, upload_id, s3_key, content_type, file_size,
 			status, presigned_url_expires_at, created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
 
 	_, err := r.db.ExecContext(ctx, query,
 		record.ID,
+		record.UserID,
 		record.UploadID,
 		record.S3Key,
 		record.ContentType,
@@ -50,7 +63,44 @@ func (r *repository) Create(ctx context.Context, record *UploadRecord) error {
 	return nil
 }
 
-func (r *repository) GetByUploadID(ctx context.Context, uploadID string) (*UploadRecord, error) {
+// GetByUploadID returns the upload only when it belongs to userID, so other
+// users' uploads are reported as not found.
+func (r *repository) GetByUploadID(ctx context.Context, userID uuid.UUID, uploadID string) (*UploadRecord, error) {
+	query := `
+		SELECT
+			id, upload_id, s3_key, content_type, file_size,
+			status, presigned_url_expires_at, created_at,
+			completed_at, transaction_id
+		FROM upload_requests
+		WHERE upload_id = $1 AND user_id = $2
+	`
+
+	var record UploadRecord
+	err := r.db.QueryRowContext(ctx, query, uploadID, userID).Scan(
+		&record.ID,
+		&record.UploadID,
+		&record.S3Key,
+		&record.ContentType,
+		&record.FileSize,
+		&record.Status,
+		&record.PresignedURLExpiresAt,
+		&record.CreatedAt,
+		&record.CompletedAt,
+		&record.TransactionID,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("getting upload record: %w", err)
+	}
+
+	return &record, nil
+}
+
+// GetAnyByUploadID returns the upload whoever it belongs to, for admin tools.
+func (r *repository) GetAnyByUploadID(ctx context.Context, uploadID string) (*UploadRecord, error) {
 	query := `
 		SELECT
 			id, upload_id, s3_key, content_type, file_size,
@@ -75,8 +125,8 @@ func (r *repository) GetByUploadID(ctx context.Context, uploadID string) (*Uploa
 	)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("upload not found")
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUploadNotFound
 		}
 		return nil, fmt.Errorf("getting upload record: %w", err)
 	}
@@ -84,6 +134,89 @@ func (r *repository) GetByUploadID(ctx context.Context, uploadID string) (*Uploa
 	return &record, nil
 }
 
+// GetByS3Key returns the upload recorded with the staging key when it belongs
+// to userID.
+func (r *repository) GetByS3Key(ctx context.Context, userID uuid.UUID, key string) (*UploadRecord, error) {
+	query := `
+		SELECT
+			id, upload_id, s3_key, content_type, file_size,
+			status, presigned_url_expires_at, created_at,
+			completed_at, transaction_id
+		FROM upload_requests
+		WHERE s3_key = $1 AND user_id = $2
+	`
+
+	var record UploadRecord
+	err := r.db.QueryRowContext(ctx, query, key, userID).Scan(
+		&record.ID,
+		&record.UploadID,
+		&record.S3Key,
+		&record.ContentType,
+		&record.FileSize,
+		&record.Status,
+		&record.PresignedURLExpiresAt,
+		&record.CreatedAt,
+		&record.CompletedAt,
+		&record.TransactionID,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("getting upload record by key: %w", err)
+	}
+
+	return &record, nil
+}
+
+// ListByTransactionID returns the uploads linked to a transaction owned by
+// userID, oldest first.
+func (r *repository) ListByTransactionID(ctx context.Context, userID uuid.UUID, transactionID uuid.UUID) ([]*UploadRecord, error) {
+	query := `
+		SELECT
+			id, upload_id, s3_key, content_type, file_size,
+			status, presigned_url_expires_at, created_at,
+			completed_at, transaction_id
+		FROM upload_requests
+		WHERE transaction_id = $1 AND user_id = $2
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, transactionID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("listing upload records by transaction: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*UploadRecord
+	for rows.Next() {
+		var record UploadRecord
+		err := rows.Scan(
+			&record.ID,
+			&record.UploadID,
+			&record.S3Key,
+			&record.ContentType,
+			&record.FileSize,
+			&record.Status,
+			&record.PresignedURLExpiresAt,
+			&record.CreatedAt,
+			&record.CompletedAt,
+			&record.TransactionID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scanning upload record: %w", err)
+		}
+		records = append(records, &record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating upload records: %w", err)
+	}
+
+	return records, nil
+}
+
 func (r *repository) UpdateStatus(ctx context.Context, uploadID string, status UploadStatus) error {
 	var query string
 	var args []interface{}
@@ -115,12 +248,66 @@ func (r *repository) UpdateStatus(ctx context.Context, uploadID string, status U
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("upload not found")
+		return ErrUploadNotFound
 	}
 
 	return nil
 }
 
+// TransitionStatus moves an unlinked upload from one status to another and
+// reports whether it did. It does nothing if the upload has since changed
+// status or been linked, so concurrent updates can't overwrite each other.
+func (r *repository) TransitionStatus(ctx context.Context, uploadID string, from, to UploadStatus) (bool, error) {
+	completedAt := ""
+	if to == UploadStatusCompleted {
+		completedAt = ", completed_at = NOW()"
+	}
+
+	query := `
+		UPDATE upload_requests
+		SET status = $1` + completedAt + `
+		WHERE upload_id = $2
+		AND status = $3
+		AND transaction_id IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, to, uploadID, from)
+	if err != nil {
+		return false, fmt.Errorf("updating upload status: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("getting rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// CompletePendingByS3Key marks the pending, unlinked upload stored at key
+// completed and returns its upload ID, or "" if there is no such upload.
+func (r *repository) CompletePendingByS3Key(ctx context.Context, key string) (string, error) {
+	query := `
+		UPDATE upload_requests
+		SET status = $1, completed_at = NOW()
+		WHERE s3_key = $2
+		AND status = $3
+		AND transaction_id IS NULL
+		RETURNING upload_id
+	`
+
+	var uploadID string
+	err := r.db.QueryRowContext(ctx, query, UploadStatusCompleted, key, UploadStatusPending).Scan(&uploadID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("completing upload by key: %w", err)
+	}
+
+	return uploadID, nil
+}
+
 func (r *repository) LinkToTransaction(ctx context.Context, uploadID string, transactionID uuid.UUID) error {
 	query := `
 		UPDATE upload_requests
@@ -139,13 +326,37 @@ func (r *repository) LinkToTransaction(ctx context.Context, uploadID string, tra
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("upload not found")
+		return ErrUploadNotFound
 	}
 
 	return nil
 }
 
-func (r *repository) GetOrphanedUploads(ctx context.Context, hoursOld int) ([]*UploadRecord, error) {
+func (r *repository) UpdateContentType(ctx context.Context, uploadID string, contentType string) error {
+	query := `
+		UPDATE upload_requests
+		SET content_type = $1
+		WHERE upload_id = $2
+	`
+
+	result, err := r.db.ExecContext(ctx, query, contentType, uploadID)
+	if err != nil {
+		return fmt.Errorf("updating upload content type: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrUploadNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) GetOrphanedUploads(ctx context.Context, hoursOld int, limit int) ([]*UploadRecord, error) {
 	query := `
 		SELECT
 			id, upload_id, s3_key, content_type, file_size,
@@ -154,10 +365,12 @@ func (r *repository) GetOrphanedUploads(ctx context.Context, hoursOld int) ([]*U
 		FROM upload_requests
 		WHERE status = $1
 		AND transaction_id IS NULL
-		AND created_at < NOW() - INTERVAL '%d hours'
+		AND created_at < NOW() - make_interval(hours => $2)
+		ORDER BY created_at
+		LIMIT $3
 	`
 
-	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(query, hoursOld), UploadStatusPending)
+	rows, err := r.db.QueryContext(ctx, query, UploadStatusPending, hoursOld, limit)
 	if err != nil {
 		return nil, fmt.Errorf("getting orphaned uploads: %w", err)
 	}
@@ -189,4 +402,15 @@ func (r *repository) GetOrphanedUploads(ctx context.Context, hoursOld int) ([]*U
 	}
 
 	return records, nil
-}
\ No newline at end of file
+}
+
+func (r *repository) CountByStatus(ctx context.Context, status UploadStatus) (int64, error) {
+	query := `SELECT COUNT(*) FROM upload_requests WHERE status = $1`
+
+	var count int64
+	if err := r.db.QueryRowContext(ctx, query, status).Scan(&count); err != nil {
+		return 0, fmt.Errorf("counting uploads by status: %w", err)
+	}
+
+	return count, nil
+}
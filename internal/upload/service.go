@@ -2,47 +2,62 @@ package upload
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
+	"github.com/kranti/cashflow/internal/auth"
 	"github.com/kranti/cashflow/internal/s3"
 )
 
+// ErrUploadAlreadyLinked is returned when an upload is already attached to a
+// transaction.
+var ErrUploadAlreadyLinked = apperror.New(409, apperror.CodeUploadAlreadyLinked, "upload already linked to another transaction")
+
+// ErrUploadNotPending is returned when an upload can only change from pending
+// but has already completed, failed or expired.
+var ErrUploadNotPending = apperror.New(409, apperror.CodeUploadNotPending, "upload is no longer pending")
+
 type service struct {
 	repo      Repository
 	s3Service s3.Service
+	config    *Config
 	logger    *slog.Logger
 }
 
-func NewService(repo Repository, s3Service s3.Service, logger *slog.Logger) *service {
+func NewService(repo Repository, s3Service s3.Service, config *Config, logger *slog.Logger) *service {
 	return &service{
 		repo:      repo,
 		s3Service: s3Service,
+		config:    config,
 		logger:    logger,
 	}
 }
 
 func (s *service) RequestUpload(ctx context.Context, req UploadRequest) (*UploadResponse, error) {
-	// Validate content type
-	if !isValidContentType(req.ContentType) {
-		return nil, fmt.Errorf("invalid content type: %s", req.ContentType)
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	// Validate file size
-	if req.FileSize > 10*1024*1024 { // 10MB
-		return nil, fmt.Errorf("file size exceeds maximum of 10MB")
+	if err := s.validateUploadRequest(req); err != nil {
+		return nil, err
 	}
 
 	// Generate unique upload ID
 	uploadID := uuid.New().String()
 
 	// Generate S3 key in staging area
-	ext := getExtensionFromContentType(req.ContentType)
+	ext := s.s3Service.ImageExtension(req.ContentType)
 	now := time.Now()
-	s3Key := fmt.Sprintf("staging/%d/%02d/%s_%d%s",
+	s3Key := fmt.Sprintf("%s%d/%02d/%s_%d%s",
+		s.s3Service.StagingPrefix(),
 		now.Year(),
 		now.Month(),
 		uploadID,
@@ -51,8 +66,8 @@ func (s *service) RequestUpload(ctx context.Context, req UploadRequest) (*Upload
 	)
 
 	// Generate presigned URL for PUT
-	expiresIn := 15 * time.Minute
-	presignedURL, err := s.s3Service.GeneratePresignedPutURL(ctx, s3Key, req.ContentType, expiresIn)
+	expiresIn := s.config.URLExpiration
+	presigned, err := s.s3Service.GeneratePresignedPutURL(ctx, s3Key, req.ContentType, req.FileSize, expiresIn)
 	if err != nil {
 		s.logger.Error("failed to generate presigned URL",
 			slog.String("error", err.Error()),
@@ -63,13 +78,14 @@ func (s *service) RequestUpload(ctx context.Context, req UploadRequest) (*Upload
 	// Create upload record
 	record := &UploadRecord{
 		ID:                    uuid.New(),
+		UserID:                userID,
 		UploadID:              uploadID,
 		S3Key:                 s3Key,
 		ContentType:           req.ContentType,
 		FileSize:              req.FileSize,
 		Status:                UploadStatusPending,
-		PresignedURLExpiresAt: time.Now().Add(expiresIn),
-		CreatedAt:             time.Now(),
+		PresignedURLExpiresAt: now.Add(expiresIn),
+		CreatedAt:             now,
 	}
 
 	if err := s.repo.Create(ctx, record); err != nil {
@@ -86,41 +102,78 @@ func (s *service) RequestUpload(ctx context.Context, req UploadRequest) (*Upload
 
 	return &UploadResponse{
 		UploadID:     uploadID,
-		PresignedURL: presignedURL,
+		PresignedURL: presigned.URL,
 		Method:       "PUT",
-		Headers: map[string]string{
-			"Content-Type": req.ContentType,
-		},
-		Key:       s3Key,
-		ExpiresAt: record.PresignedURLExpiresAt,
+		Headers:      presigned.Headers,
+		Key:          s3Key,
+		ExpiresAt:    record.PresignedURLExpiresAt,
 	}, nil
 }
 
 func (s *service) GetUploadStatus(ctx context.Context, uploadID string) (*UploadStatusResponse, error) {
-	record, err := s.repo.GetByUploadID(ctx, uploadID)
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := s.repo.GetByUploadID(ctx, userID, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("getting upload record: %w", err)
+	}
+
+	return s.statusResponse(ctx, record), nil
+}
+
+// GetUploadStatusByKey looks an upload up by its S3 key. Keys under the
+// transactions prefix are mapped back to the staging key the upload was
+// recorded with; a permanent key whose extension changed when the image was
+// normalized to JPEG is not found. Keys under neither prefix are rejected.
+func (s *service) GetUploadStatusByKey(ctx context.Context, key string) (*UploadStatusResponse, error) {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stagingKey, err := s.stagingKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := s.repo.GetByS3Key(ctx, userID, stagingKey)
 	if err != nil {
 		return nil, fmt.Errorf("getting upload record: %w", err)
 	}
 
+	return s.statusResponse(ctx, record), nil
+}
+
+// statusResponse reports the status of record. Unless S3 events complete
+// uploads, a pending upload is first marked completed if its object has since
+// arrived in S3.
+func (s *service) statusResponse(ctx context.Context, record *UploadRecord) *UploadStatusResponse {
 	// Check if upload actually exists in S3 if status is pending
-	if record.Status == UploadStatusPending {
+	if record.Status == UploadStatusPending && s.config.EventSecret == "" {
 		exists, err := s.s3Service.ObjectExists(ctx, record.S3Key)
 		if err != nil {
 			s.logger.Error("failed to check S3 object",
 				slog.String("error", err.Error()),
-				slog.String("upload_id", uploadID))
+				slog.String("upload_id", record.UploadID))
 		} else if exists {
 			// Update status to completed if object exists
-			if err := s.repo.UpdateStatus(ctx, uploadID, UploadStatusCompleted); err != nil {
+			if err := s.repo.UpdateStatus(ctx, record.UploadID, UploadStatusCompleted); err != nil {
 				s.logger.Error("failed to update upload status",
 					slog.String("error", err.Error()),
-					slog.String("upload_id", uploadID))
+					slog.String("upload_id", record.UploadID))
 			} else {
 				record.Status = UploadStatusCompleted
 			}
 		}
 	}
 
+	return newStatusResponse(record)
+}
+
+func newStatusResponse(record *UploadRecord) *UploadStatusResponse {
 	return &UploadStatusResponse{
 		UploadID:    record.UploadID,
 		Status:      record.Status,
@@ -129,44 +182,91 @@ func (s *service) GetUploadStatus(ctx context.Context, uploadID string) (*Upload
 		FileSize:    record.FileSize,
 		CreatedAt:   record.CreatedAt,
 		CompletedAt: record.CompletedAt,
-	}, nil
+	}
 }
 
-func (s *service) VerifyAndLinkUpload(ctx context.Context, uploadID string, transactionID uuid.UUID) (string, error) {
+// VerifyUpload checks a completed upload and moves it to permanent storage.
+// It doesn't link the upload; call LinkUpload once the transaction holding it
+// is stored, so a failed insert never leaves the upload linked.
+func (s *service) VerifyUpload(ctx context.Context, uploadID string) (*LinkedUpload, error) {
 	if uploadID == "" {
-		return "", nil // No upload to verify
+		return nil, nil // No upload to verify
+	}
+
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get upload record
-	record, err := s.repo.GetByUploadID(ctx, uploadID)
+	// Get upload record owned by the caller
+	record, err := s.repo.GetByUploadID(ctx, userID, uploadID)
 	if err != nil {
-		return "", fmt.Errorf("getting upload record: %w", err)
+		return nil, fmt.Errorf("getting upload record: %w", err)
 	}
 
 	// Check if already linked
 	if record.TransactionID != nil {
-		return "", fmt.Errorf("upload already linked to another transaction")
+		return nil, ErrUploadAlreadyLinked
 	}
 
 	// Verify object exists in S3
 	exists, err := s.s3Service.ObjectExists(ctx, record.S3Key)
 	if err != nil {
-		return "", fmt.Errorf("verifying S3 object: %w", err)
+		return nil, fmt.Errorf("verifying S3 object: %w", err)
 	}
 	if !exists {
-		return "", fmt.Errorf("uploaded file not found in S3")
+		return nil, apperror.Invalid(apperror.CodeUploadNotReceived, "uploaded file not found in S3")
 	}
 
-	// Move from staging to permanent location
-	permanentKey := strings.Replace(record.S3Key, "staging/", "transactions/", 1)
-	if err := s.s3Service.CopyObject(ctx, record.S3Key, permanentKey); err != nil {
-		s.logger.Error("failed to copy S3 object",
+	// The presigned PUT signs the declared size, so this is defence in depth
+	// for objects written another way, such as those reported by S3 events
+	size, err := s.s3Service.ObjectSize(ctx, record.S3Key)
+	if err != nil {
+		return nil, fmt.Errorf("checking uploaded file size: %w", err)
+	}
+	if maxSize := s.s3Service.MaxImageSize(); size > maxSize {
+		s.rejectOversized(ctx, record, size)
+		return nil, apperror.Invalid(apperror.CodeFileTooLarge, "uploaded file is %d bytes, exceeding the maximum of %d bytes", size, maxSize)
+	}
+
+	// Check the bytes actually uploaded, not the declared type. A mismatched
+	// object stays in staging for the cleanup worker.
+	if err := s.verifyContentType(ctx, record); err != nil {
+		s.logger.Warn("rejected upload with mismatched content",
 			slog.String("error", err.Error()),
-			slog.String("from", record.S3Key),
-			slog.String("to", permanentKey))
-		return "", fmt.Errorf("moving file to permanent storage: %w", err)
+			slog.String("upload_id", uploadID))
+		return nil, err
 	}
 
+	// Move from staging to permanent location, re-encoding as JPEG if enabled.
+	// Re-encoding drops EXIF too; otherwise it is stripped when enabled.
+	permanentKey, err := s.permanentKey(record.S3Key)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := false
+	if s.config.NormalizeImages && !isJPEG(record.ContentType) {
+		permanentKey, normalized = s.normalizeToJPEG(ctx, record, permanentKey)
+	}
+
+	stripped := false
+	if !normalized && s.config.StripEXIF {
+		stripped = s.stripMetadata(ctx, record, permanentKey)
+	}
+
+	if !normalized && !stripped {
+		if err := s.s3Service.CopyObject(ctx, record.S3Key, permanentKey); err != nil {
+			s.logger.Error("failed to copy S3 object",
+				slog.String("error", err.Error()),
+				slog.String("from", record.S3Key),
+				slog.String("to", permanentKey))
+			return nil, fmt.Errorf("moving file to permanent storage: %w", err)
+		}
+	}
+
+	thumbnailKey := s.generateThumbnail(ctx, uploadID, permanentKey)
+
 	// Delete staging object
 	if err := s.s3Service.DeleteImage(ctx, record.S3Key); err != nil {
 		s.logger.Warn("failed to delete staging object",
@@ -175,76 +275,381 @@ func (s *service) VerifyAndLinkUpload(ctx context.Context, uploadID string, tran
 		// Continue anyway - lifecycle rule will clean it up
 	}
 
-	// Link upload to transaction
+	if normalized {
+		if err := s.repo.UpdateContentType(ctx, uploadID, "image/jpeg"); err != nil {
+			s.logger.Warn("failed to update upload content type",
+				slog.String("error", err.Error()),
+				slog.String("upload_id", uploadID))
+		}
+	}
+
+	s.logger.Info("upload verified",
+		slog.String("upload_id", uploadID),
+		slog.String("s3_key", permanentKey),
+		slog.Bool("thumbnail", thumbnailKey != ""))
+
+	contentType := record.ContentType
+	if normalized {
+		contentType = "image/jpeg"
+	}
+
+	return &LinkedUpload{
+		Key:          permanentKey,
+		ThumbnailKey: thumbnailKey,
+		ContentType:  contentType,
+	}, nil
+}
+
+// LinkUpload marks a verified upload as completed and attached to
+// transactionID.
+func (s *service) LinkUpload(ctx context.Context, uploadID string, transactionID uuid.UUID) error {
 	if err := s.repo.LinkToTransaction(ctx, uploadID, transactionID); err != nil {
-		return "", fmt.Errorf("linking upload to transaction: %w", err)
+		return fmt.Errorf("linking upload to transaction: %w", err)
 	}
 
-	s.logger.Info("upload verified and linked",
+	s.logger.Info("upload linked",
 		slog.String("upload_id", uploadID),
-		slog.String("transaction_id", transactionID.String()),
-		slog.String("s3_key", permanentKey))
+		slog.String("transaction_id", transactionID.String()))
 
-	return permanentKey, nil
+	return nil
 }
 
-func (s *service) CleanupOrphanedUploads(ctx context.Context) error {
-	// Get uploads older than 24 hours without transactions
-	orphans, err := s.repo.GetOrphanedUploads(ctx, 24)
+// ReleaseTransactionUploads tidies the uploads linked to a deleted
+// transaction: a staging object left behind by a failed move is deleted and a
+// still-pending record is expired, so none lingers as pending. Permanent
+// images are kept so a restored transaction keeps its receipts.
+func (s *service) ReleaseTransactionUploads(ctx context.Context, transactionID uuid.UUID) error {
+	userID, err := auth.UserID(ctx)
 	if err != nil {
-		return fmt.Errorf("getting orphaned uploads: %w", err)
+		return err
 	}
 
-	for _, orphan := range orphans {
-		// Delete from S3
-		if err := s.s3Service.DeleteImage(ctx, orphan.S3Key); err != nil {
-			s.logger.Warn("failed to delete orphaned S3 object",
-				slog.String("error", err.Error()),
-				slog.String("key", orphan.S3Key))
+	records, err := s.repo.ListByTransactionID(ctx, userID, transactionID)
+	if err != nil {
+		return fmt.Errorf("listing upload records: %w", err)
+	}
+
+	for _, record := range records {
+		if err := s.releaseUpload(ctx, record); err != nil {
+			return fmt.Errorf("releasing upload %s: %w", record.UploadID, err)
 		}
+	}
 
-		// Update status to expired
-		if err := s.repo.UpdateStatus(ctx, orphan.UploadID, UploadStatusExpired); err != nil {
-			s.logger.Warn("failed to update orphan status",
-				slog.String("error", err.Error()),
-				slog.String("upload_id", orphan.UploadID))
+	return nil
+}
+
+func (s *service) releaseUpload(ctx context.Context, record *UploadRecord) error {
+	exists, err := s.s3Service.ObjectExists(ctx, record.S3Key)
+	if err != nil {
+		return fmt.Errorf("checking staging object: %w", err)
+	}
+	if exists {
+		if err := s.s3Service.DeleteImage(ctx, record.S3Key); err != nil {
+			return fmt.Errorf("deleting staging object: %w", err)
 		}
 	}
 
-	s.logger.Info("cleaned up orphaned uploads",
-		slog.Int("count", len(orphans)))
+	if record.Status == UploadStatusPending {
+		if err := s.repo.UpdateStatus(ctx, record.UploadID, UploadStatusExpired); err != nil {
+			return fmt.Errorf("expiring upload: %w", err)
+		}
+	}
+
+	s.logger.Info("released upload of deleted transaction",
+		slog.String("upload_id", record.UploadID),
+		slog.String("transaction_id", record.TransactionID.String()),
+		slog.Bool("staging_deleted", exists))
+
+	return nil
+}
+
+// CancelUpload abandons an upload that hasn't been linked yet: its staging
+// object is deleted, if it was ever uploaded, and the record is expired.
+func (s *service) CancelUpload(ctx context.Context, uploadID string) error {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return err
+	}
+
+	record, err := s.repo.GetByUploadID(ctx, userID, uploadID)
+	if err != nil {
+		return fmt.Errorf("getting upload record: %w", err)
+	}
+
+	if record.TransactionID != nil {
+		return ErrUploadAlreadyLinked
+	}
+
+	exists, err := s.s3Service.ObjectExists(ctx, record.S3Key)
+	if err != nil {
+		return fmt.Errorf("checking staging object: %w", err)
+	}
+	if exists {
+		if err := s.s3Service.DeleteImage(ctx, record.S3Key); err != nil {
+			return fmt.Errorf("deleting staging object: %w", err)
+		}
+	}
+
+	if err := s.repo.UpdateStatus(ctx, uploadID, UploadStatusExpired); err != nil {
+		return fmt.Errorf("expiring upload: %w", err)
+	}
+
+	s.logger.Info("upload cancelled",
+		slog.String("upload_id", uploadID),
+		slog.Bool("staging_deleted", exists))
 
 	return nil
 }
 
-func isValidContentType(contentType string) bool {
-	validTypes := map[string]bool{
-		"image/jpeg": true,
-		"image/jpg":  true,
-		"image/png":  true,
-		"image/webp": true,
+// MarkFailed records that the client's PUT to S3 failed, so the upload shows
+// as failed rather than pending until the orphan cleanup expires it. Only
+// pending uploads can be marked failed.
+func (s *service) MarkFailed(ctx context.Context, uploadID string) error {
+	userID, err := auth.UserID(ctx)
+	if err != nil {
+		return err
+	}
+
+	record, err := s.repo.GetByUploadID(ctx, userID, uploadID)
+	if err != nil {
+		return fmt.Errorf("getting upload record: %w", err)
+	}
+
+	if record.TransactionID != nil {
+		return ErrUploadAlreadyLinked
+	}
+
+	updated, err := s.repo.TransitionStatus(ctx, uploadID, UploadStatusPending, UploadStatusFailed)
+	if err != nil {
+		return fmt.Errorf("marking upload failed: %w", err)
 	}
-	return validTypes[contentType]
+	if !updated {
+		return ErrUploadNotPending
+	}
+
+	s.logger.Info("upload marked failed",
+		slog.String("upload_id", uploadID))
+
+	return nil
 }
 
-func getExtensionFromContentType(contentType string) string {
-	extensions := map[string]string{
-		"image/jpeg": ".jpg",
-		"image/jpg":  ".jpg",
-		"image/png":  ".png",
-		"image/webp": ".webp",
+// ReconcileUpload fixes the status of any user's unlinked upload from what is
+// in S3: a staged object means completed, and a missing one means pending
+// while the upload URL is valid and failed after. Linked uploads, whose
+// objects have left staging, are returned unchanged.
+func (s *service) ReconcileUpload(ctx context.Context, uploadID string) (*UploadStatusResponse, error) {
+	record, err := s.repo.GetAnyByUploadID(ctx, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("getting upload record: %w", err)
 	}
 
-	if ext, ok := extensions[contentType]; ok {
-		return ext
+	if record.TransactionID == nil {
+		exists, err := s.s3Service.ObjectExists(ctx, record.S3Key)
+		if err != nil {
+			return nil, fmt.Errorf("checking staging object: %w", err)
+		}
+
+		status := UploadStatusCompleted
+		if !exists {
+			status = UploadStatusFailed
+			if time.Now().Before(record.PresignedURLExpiresAt) {
+				status = UploadStatusPending
+			}
+		}
+
+		if status != record.Status {
+			if err := s.repo.UpdateStatus(ctx, uploadID, status); err != nil {
+				return nil, fmt.Errorf("updating upload status: %w", err)
+			}
+
+			s.logger.Info("upload reconciled",
+				slog.String("upload_id", uploadID),
+				slog.String("from", string(record.Status)),
+				slog.String("to", string(status)),
+				slog.Bool("object_exists", exists))
+
+			record.Status = status
+			if status == UploadStatusCompleted {
+				now := time.Now()
+				record.CompletedAt = &now
+			}
+		}
 	}
 
-	// Fallback to parsing content type
-	parts := strings.Split(contentType, "/")
-	if len(parts) == 2 {
-		return "." + parts[1]
+	return newStatusResponse(record), nil
+}
+
+// CleanupOrphanedUploads deletes the staged objects of one batch of uploads
+// left pending for over 24 hours and expires them. With dryRun it only logs
+// and returns the uploads it would clean up.
+func (s *service) CleanupOrphanedUploads(ctx context.Context, dryRun bool) (*CleanupResult, error) {
+	// Get one batch of uploads older than 24 hours without transactions;
+	// larger backlogs drain over subsequent runs
+	orphans, err := s.repo.GetOrphanedUploads(ctx, 24, s.config.CleanupBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("getting orphaned uploads: %w", err)
 	}
 
-	return ".jpg" // Default
+	result := &CleanupResult{DryRun: dryRun, Count: len(orphans), Uploads: orphans}
+	if result.Uploads == nil {
+		result.Uploads = []*UploadRecord{}
+	}
+
+	if dryRun {
+		for _, orphan := range orphans {
+			s.logger.Info("would clean up orphaned upload",
+				slog.String("upload_id", orphan.UploadID),
+				slog.String("s3_key", orphan.S3Key),
+				slog.Time("created_at", orphan.CreatedAt))
+		}
+		s.logger.Info("orphaned upload cleanup dry run",
+			slog.Int("count", len(orphans)),
+			slog.Int("batch_size", s.config.CleanupBatchSize))
+		return result, nil
+	}
+
+	// Delete the staged objects in as few S3 calls as possible; the uploads
+	// are expired either way, as before, and failed keys are only logged
+	keys := make([]string, len(orphans))
+	for i, orphan := range orphans {
+		keys[i] = orphan.S3Key
+	}
+	failed := make(map[string]bool)
+	if err := s.s3Service.DeleteImages(ctx, keys); err != nil {
+		var deleteErr *s3.DeleteError
+		if !errors.As(err, &deleteErr) {
+			return nil, fmt.Errorf("deleting orphaned uploads: %w", err)
+		}
+		for _, failure := range deleteErr.Failures {
+			failed[failure.Key] = true
+			s.logger.Warn("failed to delete orphaned S3 object",
+				slog.String("error", failure.Message),
+				slog.String("code", failure.Code),
+				slog.String("key", failure.Key))
+		}
+	}
+
+	// Bound concurrent status updates so a large batch doesn't exhaust the
+	// connection pool
+	sem := make(chan struct{}, s.config.CleanupConcurrency)
+	var wg sync.WaitGroup
+	for _, orphan := range orphans {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.expireOrphan(ctx, orphan, !failed[orphan.S3Key])
+		}()
+	}
+	wg.Wait()
+
+	s.logger.Info("cleaned up orphaned uploads",
+		slog.Int("count", len(orphans)),
+		slog.Int("batch_size", s.config.CleanupBatchSize))
+
+	return result, nil
+}
+
+// expireOrphan marks an orphan expired. It counts as cleaned only when its
+// staged object was deleted too.
+func (s *service) expireOrphan(ctx context.Context, orphan *UploadRecord, deleted bool) {
+	if err := s.repo.UpdateStatus(ctx, orphan.UploadID, UploadStatusExpired); err != nil {
+		s.logger.Warn("failed to update orphan status",
+			slog.String("error", err.Error()),
+			slog.String("upload_id", orphan.UploadID))
+		return
+	}
+
+	if deleted {
+		orphansCleaned.Inc()
+	}
+}
+
+// rejectOversized deletes an oversized staged object and marks its upload
+// failed, so it can't be linked or linger until cleanup.
+func (s *service) rejectOversized(ctx context.Context, record *UploadRecord, size int64) {
+	s.logger.Warn("rejected oversized upload",
+		slog.String("upload_id", record.UploadID),
+		slog.Int64("size", size),
+		slog.Int64("declared_size", record.FileSize))
+
+	if err := s.s3Service.DeleteImage(ctx, record.S3Key); err != nil {
+		s.logger.Warn("failed to delete oversized staging object",
+			slog.String("error", err.Error()),
+			slog.String("key", record.S3Key))
+	}
+
+	if err := s.repo.UpdateStatus(ctx, record.UploadID, UploadStatusFailed); err != nil {
+		s.logger.Warn("failed to mark oversized upload failed",
+			slog.String("error", err.Error()),
+			slog.String("upload_id", record.UploadID))
+	}
+}
+
+// permanentKey maps a staged object's key to its key under the transactions
+// prefix. Only the leading staging prefix is replaced, so the rest of the key
+// is kept verbatim.
+func (s *service) permanentKey(stagingKey string) (string, error) {
+	rest, ok := strings.CutPrefix(stagingKey, s.s3Service.StagingPrefix())
+	if !ok {
+		return "", fmt.Errorf("upload key %q is not under staging prefix %q", stagingKey, s.s3Service.StagingPrefix())
+	}
+	return s.s3Service.TransactionsPrefix() + rest, nil
+}
+
+// stagingKey maps a staging or permanent upload key to its staging key.
+func (s *service) stagingKey(key string) (string, error) {
+	if strings.HasPrefix(key, s.s3Service.StagingPrefix()) {
+		return key, nil
+	}
+	if rest, ok := strings.CutPrefix(key, s.s3Service.TransactionsPrefix()); ok {
+		return s.s3Service.StagingPrefix() + rest, nil
+	}
+	return "", apperror.Invalid(apperror.CodeInvalidParameter, "key must be under %q or %q",
+		s.s3Service.StagingPrefix(), s.s3Service.TransactionsPrefix())
+}
+
+// sniffLength is how many bytes http.DetectContentType considers.
+const sniffLength = 512
+
+// sniffableTypes are the image types http.DetectContentType recognizes.
+var sniffableTypes = map[string]bool{
+	"image/bmp":    true,
+	"image/gif":    true,
+	"image/jpeg":   true,
+	"image/png":    true,
+	"image/webp":   true,
+	"image/x-icon": true,
+}
+
+// verifyContentType sniffs the staged object and requires it to be an allowed
+// image of the type declared when the upload was requested.
+func (s *service) verifyContentType(ctx context.Context, record *UploadRecord) error {
+	head, err := s.s3Service.GetObjectPrefix(ctx, record.S3Key, sniffLength)
+	if err != nil {
+		return fmt.Errorf("reading uploaded file: %w", err)
+	}
+
+	declared := record.ContentType
+	if declared == "image/jpg" {
+		declared = "image/jpeg"
+	}
+
+	// Types such as image/heic can be allowed but are not recognized by
+	// sniffing, so they are taken on trust
+	detected := http.DetectContentType(head)
+	if !sniffableTypes[declared] && detected == "application/octet-stream" {
+		return nil
+	}
+
+	if !s.s3Service.AllowedImageType(detected) {
+		return apperror.Invalid(apperror.CodeUploadContentMismatch, "uploaded file is %s, not an allowed image type", detected)
+	}
+	if detected != declared {
+		return apperror.Invalid(apperror.CodeUploadContentMismatch, "uploaded file is %s but was declared as %s", detected, record.ContentType)
+	}
+
+	return nil
 }
 
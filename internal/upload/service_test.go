@@ -0,0 +1,297 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kranti/cashflow/internal/s3"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// cleanupRepo serves a fixed set of orphans and records which are expired.
+// Each status update takes delay, so overlapping updates can be counted.
+type cleanupRepo struct {
+	Repository
+	orphans []*UploadRecord
+	delay   time.Duration
+
+	mu          sync.Mutex
+	limit       int
+	expired     []string
+	inFlight    int
+	maxInFlight int
+}
+
+func (r *cleanupRepo) GetOrphanedUploads(ctx context.Context, olderThan int, limit int) ([]*UploadRecord, error) {
+	r.limit = limit
+	return r.orphans[:min(limit, len(r.orphans))], nil
+}
+
+func (r *cleanupRepo) UpdateStatus(ctx context.Context, uploadID string, status UploadStatus) error {
+	r.mu.Lock()
+	r.inFlight++
+	r.maxInFlight = max(r.maxInFlight, r.inFlight)
+	r.mu.Unlock()
+
+	time.Sleep(r.delay)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inFlight--
+	r.expired = append(r.expired, uploadID)
+	return nil
+}
+
+// cleanupS3 reports the keys in failKeys as failed deletions and records the
+// keys it was asked to delete.
+type cleanupS3 struct {
+	s3.Service
+	failKeys map[string]bool
+	deleted  []string
+}
+
+func (f *cleanupS3) DeleteImages(ctx context.Context, keys []string) error {
+	f.deleted = append(f.deleted, keys...)
+	var failures []s3.DeleteFailure
+	for _, key := range keys {
+		if f.failKeys[key] {
+			failures = append(failures, s3.DeleteFailure{Key: key, Code: "AccessDenied", Message: "Access Denied"})
+		}
+	}
+	if failures != nil {
+		return &s3.DeleteError{Failures: failures}
+	}
+	return nil
+}
+
+func testOrphans(n int) []*UploadRecord {
+	orphans := make([]*UploadRecord, n)
+	for i := range orphans {
+		orphans[i] = &UploadRecord{
+			UploadID: fmt.Sprintf("upload-%d", i),
+			S3Key:    fmt.Sprintf("staging/upload-%d.jpg", i),
+			Status:   UploadStatusPending,
+		}
+	}
+	return orphans
+}
+
+func orphansCleanedTotal(t *testing.T) float64 {
+	t.Helper()
+	var metric dto.Metric
+	if err := orphansCleaned.Write(&metric); err != nil {
+		t.Fatalf("reading orphansCleaned: %v", err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
+func TestCleanupOrphanedUploadsCountsDeletedOnly(t *testing.T) {
+	tests := []struct {
+		name        string
+		orphans     int
+		failKeys    []string
+		wantCleaned float64
+	}{
+		{name: "all deleted", orphans: 3, wantCleaned: 3},
+		{name: "some deletions fail", orphans: 4, failKeys: []string{"staging/upload-1.jpg", "staging/upload-3.jpg"}, wantCleaned: 2},
+		{name: "every deletion fails", orphans: 2, failKeys: []string{"staging/upload-0.jpg", "staging/upload-1.jpg"}, wantCleaned: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &cleanupRepo{orphans: testOrphans(tt.orphans)}
+			fake := &cleanupS3{failKeys: map[string]bool{}}
+			for _, key := range tt.failKeys {
+				fake.failKeys[key] = true
+			}
+			s := NewService(repo, fake, &Config{CleanupBatchSize: 100, CleanupConcurrency: 2}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			before := orphansCleanedTotal(t)
+			if _, err := s.CleanupOrphanedUploads(context.Background(), false); err != nil {
+				t.Fatalf("CleanupOrphanedUploads: %v", err)
+			}
+
+			if got := orphansCleanedTotal(t) - before; got != tt.wantCleaned {
+				t.Errorf("orphans cleaned = %v, want %v", got, tt.wantCleaned)
+			}
+			// Orphans whose object survived are still expired, as before
+			if len(repo.expired) != tt.orphans {
+				t.Errorf("expired %d uploads, want %d", len(repo.expired), tt.orphans)
+			}
+		})
+	}
+}
+
+func TestCleanupOrphanedUploadsBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		orphans     int
+		batchSize   int
+		concurrency int
+		dryRun      bool
+		wantCount   int
+	}{
+		{name: "backlog larger than a batch", orphans: 25, batchSize: 10, concurrency: 3, wantCount: 10},
+		{name: "backlog smaller than a batch", orphans: 4, batchSize: 10, concurrency: 3, wantCount: 4},
+		{name: "one update at a time", orphans: 6, batchSize: 10, concurrency: 1, wantCount: 6},
+		{name: "no orphans", orphans: 0, batchSize: 10, concurrency: 3, wantCount: 0},
+		{name: "dry run changes nothing", orphans: 25, batchSize: 10, concurrency: 3, dryRun: true, wantCount: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &cleanupRepo{orphans: testOrphans(tt.orphans), delay: 5 * time.Millisecond}
+			fake := &cleanupS3{}
+			config := &Config{CleanupBatchSize: tt.batchSize, CleanupConcurrency: tt.concurrency}
+			s := NewService(repo, fake, config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			result, err := s.CleanupOrphanedUploads(context.Background(), tt.dryRun)
+			if err != nil {
+				t.Fatalf("CleanupOrphanedUploads: %v", err)
+			}
+
+			if repo.limit != tt.batchSize {
+				t.Errorf("queried %d orphans, want the batch size %d", repo.limit, tt.batchSize)
+			}
+			if result.Count != tt.wantCount || len(result.Uploads) != tt.wantCount {
+				t.Errorf("result count = %d with %d uploads, want %d", result.Count, len(result.Uploads), tt.wantCount)
+			}
+			if result.DryRun != tt.dryRun {
+				t.Errorf("result dry run = %v, want %v", result.DryRun, tt.dryRun)
+			}
+
+			wantChanged := tt.wantCount
+			if tt.dryRun {
+				wantChanged = 0
+			}
+			if len(fake.deleted) != wantChanged {
+				t.Errorf("deleted %d objects, want %d", len(fake.deleted), wantChanged)
+			}
+			if len(repo.expired) != wantChanged {
+				t.Errorf("expired %d uploads, want %d", len(repo.expired), wantChanged)
+			}
+
+			if repo.maxInFlight > tt.concurrency {
+				t.Errorf("%d status updates ran at once, want at most %d", repo.maxInFlight, tt.concurrency)
+			}
+			if wantChanged >= tt.concurrency && tt.concurrency > 1 && repo.maxInFlight < 2 {
+				t.Errorf("status updates ran one at a time, want up to %d at once", tt.concurrency)
+			}
+		})
+	}
+}
+
+// objectS3 serves and stores whole objects in memory.
+type objectS3 struct {
+	s3.Service
+	objects map[string][]byte
+}
+
+func (f *objectS3) ReadObject(ctx context.Context, key string) ([]byte, string, error) {
+	data, ok := f.objects[key]
+	if !ok {
+		return nil, "", fmt.Errorf("no object %s", key)
+	}
+	return data, "image/jpeg", nil
+}
+
+func (f *objectS3) PutObject(ctx context.Context, key string, data []byte, contentType string) error {
+	f.objects[key] = data
+	return nil
+}
+
+// portraitJPEG is a landscape JPEG, red on the left and blue on the right,
+// tagged with EXIF orientation 6: a phone held upright, whose sensor stored
+// the photo turned 90° anticlockwise.
+func portraitJPEG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= 8 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("encoding JPEG: %v", err)
+	}
+
+	// Big-endian TIFF with one IFD entry: orientation, SHORT, count 1, 6
+	tiff := []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8,
+		0, 1,
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, 6, 0, 0,
+		0, 0, 0, 0,
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+
+	data := buf.Bytes()
+	tagged := append([]byte{}, data[:2]...)
+	tagged = append(tagged, app1...)
+	tagged = append(tagged, payload...)
+	return append(tagged, data[2:]...)
+}
+
+// checkUpright fails unless data decodes to the portrait photo upright: red
+// on top and blue below.
+func checkUpright(t *testing.T, data []byte, width, height int) {
+	t.Helper()
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != width || b.Dy() != height {
+		t.Fatalf("size = %dx%d, want %dx%d", b.Dx(), b.Dy(), width, height)
+	}
+	top, _, _, _ := img.At(width/2, height/4).RGBA()
+	_, _, bottom, _ := img.At(width/2, height*3/4).RGBA()
+	if top < 0xC000 || bottom < 0xC000 {
+		t.Errorf("top = %v, bottom = %v, want red over blue", img.At(width/2, height/4), img.At(width/2, height*3/4))
+	}
+}
+
+func TestStripMetadataAppliesOrientation(t *testing.T) {
+	original := portraitJPEG(t)
+	if got := exifOrientation(original, "jpeg"); got != 6 {
+		t.Fatalf("orientation = %d, want 6", got)
+	}
+
+	fake := &objectS3{objects: map[string][]byte{"staging/receipt.jpg": original}}
+	s := NewService(nil, fake, &Config{StripEXIF: true}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	record := &UploadRecord{UploadID: "receipt", S3Key: "staging/receipt.jpg", ContentType: "image/jpeg"}
+
+	if !s.stripMetadata(context.Background(), record, "receipts/receipt.jpg") {
+		t.Fatal("stripMetadata reported the image unstripped")
+	}
+
+	stripped := fake.objects["receipts/receipt.jpg"]
+	if bytes.Contains(stripped, []byte("Exif\x00\x00")) {
+		t.Error("stripped image still carries EXIF")
+	}
+	checkUpright(t, stripped, 8, 16)
+}
+
+func TestGenerateThumbnailAppliesOrientation(t *testing.T) {
+	fake := &objectS3{objects: map[string][]byte{"receipts/receipt.jpg": portraitJPEG(t)}}
+	s := NewService(nil, fake, &Config{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	key := s.generateThumbnail(context.Background(), "receipt", "receipts/receipt.jpg")
+	if key != "receipts/thumb_receipt.jpg" {
+		t.Fatalf("thumbnail key = %q", key)
+	}
+	checkUpright(t, fake.objects[key], 8, 16)
+}
@@ -0,0 +1,98 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+)
+
+// metadataEncoders re-encode images in their own format. The standard
+// encoders write pixels only, so the output carries no EXIF. Formats without
+// an encoder, such as WebP, can't be stripped without changing format.
+var metadataEncoders = map[string]func(io.Writer, image.Image) error{
+	"jpeg": func(w io.Writer, img image.Image) error {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	},
+	"png": png.Encode,
+}
+
+// exifMarkers identify embedded EXIF: the APP1 header in JPEG and the eXIf
+// chunk type in PNG.
+var exifMarkers = map[string][]byte{
+	"jpeg": []byte("Exif\x00\x00"),
+	"png":  []byte("eXIf"),
+}
+
+// stripMetadata writes the staged image to permanentKey re-encoded without
+// EXIF metadata, such as the GPS position of a phone photo. The EXIF
+// orientation is applied to the pixels first, so portrait photos stay
+// upright. It reports false, leaving the original to be copied as-is, when
+// the image has no EXIF, can't be decoded or re-encoded in its format, or any
+// step fails.
+func (s *service) stripMetadata(ctx context.Context, record *UploadRecord, permanentKey string) bool {
+	data, _, err := s.s3Service.ReadObject(ctx, record.S3Key)
+	if err != nil {
+		s.logger.Warn("failed to download image for metadata stripping",
+			slog.String("error", err.Error()),
+			slog.String("key", record.S3Key))
+		return false
+	}
+
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		s.logger.Info("skipping metadata stripping for undecodable image",
+			slog.String("error", err.Error()),
+			slog.String("upload_id", record.UploadID))
+		return false
+	}
+
+	if marker, ok := exifMarkers[format]; ok && !bytes.Contains(data, marker) {
+		return false
+	}
+
+	encode, ok := metadataEncoders[format]
+	if !ok {
+		s.logger.Info("cannot strip metadata from image format, keeping original",
+			slog.String("format", format),
+			slog.String("upload_id", record.UploadID))
+		return false
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		s.logger.Info("skipping metadata stripping for undecodable image",
+			slog.String("error", err.Error()),
+			slog.String("upload_id", record.UploadID))
+		return false
+	}
+
+	// The re-encoded image has no orientation tag, so turn the pixels upright
+	img = applyOrientation(img, exifOrientation(data, format))
+
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		s.logger.Warn("failed to re-encode image, keeping original",
+			slog.String("error", err.Error()),
+			slog.String("upload_id", record.UploadID))
+		return false
+	}
+
+	if err := s.s3Service.PutObject(ctx, permanentKey, buf.Bytes(), record.ContentType); err != nil {
+		s.logger.Warn("failed to store stripped image, keeping original",
+			slog.String("error", err.Error()),
+			slog.String("key", permanentKey))
+		return false
+	}
+
+	s.logger.Info("stripped image metadata",
+		slog.String("upload_id", record.UploadID),
+		slog.String("format", format),
+		slog.Int("original_size", len(data)),
+		slog.Int("stripped_size", buf.Len()))
+
+	return true
+}
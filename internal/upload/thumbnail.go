@@ -0,0 +1,82 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"log/slog"
+	"path"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// thumbnailMaxSize bounds the longer side of generated thumbnails, in pixels.
+const thumbnailMaxSize = 256
+
+// generateThumbnail stores a JPEG thumbnail of the image at key alongside it as
+// thumb_<name>.jpg and returns the thumbnail key. Thumbnails are best effort:
+// an image that can't be fetched, decoded or stored yields "".
+func (s *service) generateThumbnail(ctx context.Context, uploadID string, key string) string {
+	data, _, err := s.s3Service.ReadObject(ctx, key)
+	if err != nil {
+		s.logger.Warn("failed to download image for thumbnail",
+			slog.String("error", err.Error()),
+			slog.String("key", key))
+		return ""
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		s.logger.Info("skipping thumbnail for undecodable image",
+			slog.String("error", err.Error()),
+			slog.String("upload_id", uploadID))
+		return ""
+	}
+
+	// Thumbnails carry no EXIF, so an original that kept its orientation tag
+	// is turned upright here. Resizing first keeps the rotation cheap.
+	thumbnail := applyOrientation(resizeToFit(src, thumbnailMaxSize), exifOrientation(data, format))
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		s.logger.Warn("failed to encode thumbnail",
+			slog.String("error", err.Error()),
+			slog.String("upload_id", uploadID))
+		return ""
+	}
+
+	dir, file := path.Split(key)
+	thumbnailKey := dir + "thumb_" + strings.TrimSuffix(file, path.Ext(file)) + ".jpg"
+	if err := s.s3Service.PutObject(ctx, thumbnailKey, buf.Bytes(), "image/jpeg"); err != nil {
+		s.logger.Warn("failed to store thumbnail",
+			slog.String("error", err.Error()),
+			slog.String("key", thumbnailKey))
+		return ""
+	}
+
+	return thumbnailKey
+}
+
+// resizeToFit scales src down so neither side exceeds maxSize, keeping its
+// aspect ratio. Images already small enough are returned unchanged.
+func resizeToFit(src image.Image, maxSize int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		return src
+	}
+
+	if width >= height {
+		height = max(1, height*maxSize/width)
+		width = maxSize
+	} else {
+		width = max(1, width*maxSize/height)
+		height = maxSize
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
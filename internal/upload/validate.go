@@ -0,0 +1,75 @@
+package upload
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/kranti/cashflow/internal/apperror"
+)
+
+// validateUploadRequest checks every field of req and returns a 422 listing
+// each one that fails, or nil. The size limit is the configured maximum image
+// size, the same one enforced when the upload is confirmed.
+func (s *service) validateUploadRequest(req UploadRequest) error {
+	fields := make(map[string]apperror.FieldError)
+
+	switch {
+	case req.ContentType == "":
+		fields["content_type"] = apperror.FieldError{Rule: "required", Message: "content_type is required"}
+	case !s.s3Service.AllowedImageType(req.ContentType):
+		fields["content_type"] = apperror.FieldError{Rule: "allowed", Message: fmt.Sprintf("content type %s is not allowed", req.ContentType)}
+	}
+
+	maxSize := s.s3Service.MaxImageSize()
+	switch {
+	case req.FileSize == 0:
+		fields["file_size"] = apperror.FieldError{Rule: "required", Message: "file_size is required"}
+	case req.FileSize < 0:
+		fields["file_size"] = apperror.FieldError{Rule: "min", Message: "file_size must be at least 1 byte"}
+	case req.FileSize > maxSize:
+		fields["file_size"] = apperror.FieldError{Rule: "max", Message: fmt.Sprintf("file_size must be at most %d bytes", maxSize)}
+	}
+
+	if len(fields) > 0 {
+		return apperror.ValidationFailed(fields)
+	}
+	return nil
+}
+
+// bindError maps a request decoding error to a response error. A value of the
+// wrong JSON type is reported against its field like any other validation
+// failure; anything else, such as malformed JSON, is an invalid body.
+func bindError(err error) *apperror.Error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		field := typeErr.Field
+		if i := strings.LastIndexByte(field, '.'); i >= 0 {
+			field = field[i+1:]
+		}
+		return apperror.ValidationFailed(map[string]apperror.FieldError{
+			field: {Rule: "type", Message: fmt.Sprintf("%s must be a %s", field, jsonTypeName(typeErr.Type.Kind()))},
+		})
+	}
+	return apperror.InvalidBody(err)
+}
+
+// jsonTypeName returns the JSON name of the type a Go kind decodes from.
+func jsonTypeName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return "string"
+	}
+}
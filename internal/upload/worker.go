@@ -0,0 +1,44 @@
+package upload
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type OrphanCleaner interface {
+	CleanupOrphanedUploads(ctx context.Context, dryRun bool) (*CleanupResult, error)
+}
+
+// RunCleanupWorker calls CleanupOrphanedUploads every interval until ctx is
+// cancelled. Failures are logged and never stop the worker. A run that is in
+// progress when ctx is cancelled is allowed to finish so S3 deletes and status
+// updates are not abandoned halfway through a batch.
+func RunCleanupWorker(ctx context.Context, cleaner OrphanCleaner, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger.Info("upload cleanup worker started", slog.Duration("interval", interval))
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("upload cleanup worker stopped")
+			return
+		case <-ticker.C:
+			runCleanup(context.WithoutCancel(ctx), cleaner, logger)
+		}
+	}
+}
+
+func runCleanup(ctx context.Context, cleaner OrphanCleaner, logger *slog.Logger) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logger.Error("upload cleanup panicked", slog.Any("panic", recovered))
+		}
+	}()
+
+	if _, err := cleaner.CleanupOrphanedUploads(ctx, false); err != nil {
+		logger.Error("failed to clean up orphaned uploads", slog.String("error", err.Error()))
+	}
+}
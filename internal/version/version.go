@@ -0,0 +1,32 @@
+// Package version holds build information injected at compile time, e.g.
+//
+//	go build -ldflags "-X github.com/kranti/cashflow/internal/version.Version=v1.2.0"
+package version
+
+import "github.com/gin-gonic/gin"
+
+// Set with -ldflags -X. Builds without them report the defaults.
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+}
+
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+	}
+}
+
+// Handler serves the build information as JSON.
+func Handler(c *gin.Context) {
+	c.JSON(200, Get())
+}
@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+type Config struct {
+	// URL receives a POST for each event; webhooks are disabled when empty.
+	URL string
+	// Secret keys the HMAC-SHA256 signature sent in the signature header.
+	Secret     string
+	Timeout    time.Duration
+	MaxRetries int
+	// DeadLetter keeps deliveries that fail after every retry in the
+	// webhook_failures table for replay, instead of only logging them.
+	DeadLetter bool
+}
+
+func NewConfig() (*Config, error) {
+	webhookURL := os.Getenv("TRANSACTION_WEBHOOK_URL")
+	secret := os.Getenv("TRANSACTION_WEBHOOK_SECRET")
+
+	if webhookURL != "" {
+		u, err := url.Parse(webhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("TRANSACTION_WEBHOOK_URL %q is not an http(s) URL", webhookURL)
+		}
+		if secret == "" {
+			return nil, fmt.Errorf("TRANSACTION_WEBHOOK_SECRET is required when TRANSACTION_WEBHOOK_URL is set")
+		}
+	}
+
+	timeout := 5 * time.Second
+	if v := os.Getenv("TRANSACTION_WEBHOOK_TIMEOUT"); v != "" {
+		duration, err := time.ParseDuration(v)
+		if err == nil && duration > 0 {
+			timeout = duration
+		}
+	}
+
+	maxRetries := 3
+	if v := os.Getenv("TRANSACTION_WEBHOOK_MAX_RETRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			maxRetries = n
+		}
+	}
+
+	deadLetter := true
+	if v := os.Getenv("TRANSACTION_WEBHOOK_DEAD_LETTER"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err == nil {
+			deadLetter = enabled
+		}
+	}
+
+	return &Config{
+		URL:        webhookURL,
+		Secret:     secret,
+		Timeout:    timeout,
+		MaxRetries: maxRetries,
+		DeadLetter: deadLetter,
+	}, nil
+}
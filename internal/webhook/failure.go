@@ -0,0 +1,22 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Failure is a delivery that still failed after every retry, kept in the
+// dead-letter log so it can be inspected and replayed.
+type Failure struct {
+	ID         uuid.UUID       `json:"id"`
+	Event      string          `json:"event"`
+	DeliveryID string          `json:"delivery_id"`
+	Payload    json.RawMessage `json:"payload"`
+	LastError  string          `json:"last_error"`
+	// Attempts counts every delivery attempt, replays included
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
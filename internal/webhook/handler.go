@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
+)
+
+const (
+	defaultFailureLimit = 50
+	maxFailureLimit     = 500
+)
+
+// Handler serves the admin endpoints of the dead-letter log.
+type Handler struct {
+	service Service
+	logger  *slog.Logger
+}
+
+type Service interface {
+	ListFailures(ctx context.Context, limit int) ([]*Failure, error)
+	Replay(ctx context.Context, id uuid.UUID) error
+}
+
+func NewHandler(service Service, logger *slog.Logger) *Handler {
+	return &Handler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// ListFailures lists deliveries that failed after every retry, oldest first.
+func (h *Handler) ListFailures(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultFailureLimit)))
+	if err != nil || limit < 1 || limit > maxFailureLimit {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "limit must be between 1 and %d", maxFailureLimit), "")
+		return
+	}
+
+	failures, err := h.service.ListFailures(c.Request.Context(), limit)
+	if err != nil {
+		h.respondWithError(c, err, "Failed to list webhook failures")
+		return
+	}
+
+	c.JSON(200, gin.H{"failures": failures})
+}
+
+// RetryFailure replays one failed delivery. It responds 204 once delivered
+// and 502 when the endpoint fails again.
+func (h *Handler) RetryFailure(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apperror.Respond(c, apperror.Invalid(apperror.CodeInvalidParameter, "invalid webhook failure ID"), "")
+		return
+	}
+
+	if err := h.service.Replay(c.Request.Context(), id); err != nil {
+		h.respondWithError(c, err, "Failed to replay webhook")
+		return
+	}
+
+	c.Status(204)
+}
+
+// respondWithError writes err as a structured error body. Errors that carry no
+// code are logged and reported as a 500 with the fallback message.
+func (h *Handler) respondWithError(c *gin.Context, err error, fallback string) {
+	if apperror.Status(err) >= 500 {
+		h.logger.Error("request failed",
+			slog.String("error", err.Error()),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("request_id", c.GetString(apperror.RequestIDKey)))
+	}
+	apperror.Respond(c, err, fallback)
+}
@@ -0,0 +1,252 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
+)
+
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body.
+	SignatureHeader = "X-Cashflow-Signature"
+	EventHeader     = "X-Cashflow-Event"
+	DeliveryHeader  = "X-Cashflow-Delivery"
+
+	retryBaseDelay = 500 * time.Millisecond
+
+	// deadLetterTimeout bounds recording a failed delivery, which happens
+	// outside any request.
+	deadLetterTimeout = 5 * time.Second
+)
+
+// ErrWebhooksDisabled is returned when replaying a failure while no webhook
+// URL is configured.
+var ErrWebhooksDisabled = apperror.New(409, apperror.CodeWebhooksDisabled, "webhooks are not configured")
+
+type Notifier struct {
+	config *Config
+	client *http.Client
+	// ctx and wg tie background deliveries to the server's lifetime:
+	// cancelling ctx interrupts them and wg waits for them to be recorded
+	ctx context.Context
+	wg  *sync.WaitGroup
+	// failures is the dead-letter log of deliveries that exhausted their
+	// retries
+	failures Repository
+	// retryDelay is the delay before the first retry; tests shorten it
+	retryDelay time.Duration
+	logger     *slog.Logger
+}
+
+// NewNotifier returns a Notifier whose deliveries are registered with wg and
+// stop retrying once ctx is cancelled.
+func NewNotifier(ctx context.Context, wg *sync.WaitGroup, config *Config, failures Repository, logger *slog.Logger) *Notifier {
+	return &Notifier{
+		config:     config,
+		client:     &http.Client{Timeout: config.Timeout},
+		ctx:        ctx,
+		wg:         wg,
+		failures:   failures,
+		retryDelay: retryBaseDelay,
+		logger:     logger,
+	}
+}
+
+// Notify posts payload as JSON to the configured URL in the background. It
+// returns immediately; delivery failures are retried and then logged and kept
+// in the dead-letter log, as are deliveries interrupted by shutdown.
+// Notify is a no-op when no URL is configured.
+func (n *Notifier) Notify(event string, payload any) {
+	if n.config.URL == "" {
+		return
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		n.logger.Error("failed to encode webhook payload",
+			slog.String("error", err.Error()),
+			slog.String("event", event))
+		return
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.deliver(event, uuid.New().String(), body)
+	}()
+}
+
+// deliver sends body with retries. A delivery that still fails, or is cut
+// short by shutdown, is logged and, when the dead-letter log is on, kept there
+// for replay.
+func (n *Notifier) deliver(event, deliveryID string, body []byte) {
+	attempts, err := n.attempt(n.ctx, event, deliveryID, body)
+	if err == nil {
+		return
+	}
+
+	n.logger.Warn("webhook delivery failed",
+		slog.String("error", err.Error()),
+		slog.String("event", event),
+		slog.String("delivery_id", deliveryID))
+
+	if n.config.DeadLetter {
+		n.deadLetter(event, deliveryID, body, attempts, err)
+	}
+}
+
+// attempt sends body up to MaxRetries times, doubling the delay between
+// attempts, and returns how many it made. Only network errors, 429s and 5xx
+// responses are retried. It gives up early when ctx is done.
+func (n *Notifier) attempt(ctx context.Context, event, deliveryID string, body []byte) (int, error) {
+	var err error
+	attempts := 0
+	for attempts < n.config.MaxRetries {
+		if attempts > 0 {
+			timer := time.NewTimer(n.retryDelay << (attempts - 1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return attempts, fmt.Errorf("%w (retry interrupted: %w)", err, ctx.Err())
+			case <-timer.C:
+			}
+		}
+		attempts++
+
+		var retryable bool
+		if retryable, err = n.send(ctx, event, deliveryID, body); err == nil {
+			n.logger.Debug("webhook delivered",
+				slog.String("event", event),
+				slog.String("delivery_id", deliveryID),
+				slog.Int("attempt", attempts))
+			return attempts, nil
+		}
+		if !retryable {
+			break
+		}
+	}
+
+	return attempts, err
+}
+
+// deadLetter records a delivery that exhausted its retries. A failure to
+// record it is only logged, like the delivery failure itself.
+func (n *Notifier) deadLetter(event, deliveryID string, body []byte, attempts int, deliveryErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), deadLetterTimeout)
+	defer cancel()
+
+	now := time.Now()
+	failure := &Failure{
+		ID:         uuid.New(),
+		Event:      event,
+		DeliveryID: deliveryID,
+		Payload:    body,
+		LastError:  deliveryErr.Error(),
+		Attempts:   attempts,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := n.failures.Create(ctx, failure); err != nil {
+		n.logger.Error("failed to record webhook failure",
+			slog.String("error", err.Error()),
+			slog.String("event", event),
+			slog.String("delivery_id", deliveryID))
+	}
+}
+
+// ListFailures returns up to limit deliveries from the dead-letter log,
+// oldest first.
+func (n *Notifier) ListFailures(ctx context.Context, limit int) ([]*Failure, error) {
+	failures, err := n.failures.List(ctx, limit)
+	if err != nil {
+		return nil, fmt.Errorf("listing webhook failures: %w", err)
+	}
+	return failures, nil
+}
+
+// Replay delivers a dead-lettered event again, with its original delivery ID
+// so receivers can tell it apart from a new event. A delivered event leaves
+// the log; one that fails again keeps its place with the new attempts and
+// error, and the failure is returned as a 502.
+func (n *Notifier) Replay(ctx context.Context, id uuid.UUID) error {
+	if n.config.URL == "" {
+		return ErrWebhooksDisabled
+	}
+
+	failure, err := n.failures.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("getting webhook failure: %w", err)
+	}
+
+	attempts, deliveryErr := n.attempt(ctx, failure.Event, failure.DeliveryID, failure.Payload)
+	if deliveryErr != nil {
+		if err := n.failures.RecordAttempts(ctx, id, failure.Attempts+attempts, deliveryErr.Error()); err != nil {
+			return fmt.Errorf("recording webhook replay: %w", err)
+		}
+		return apperror.New(502, apperror.CodeWebhookDeliveryFailed, "webhook endpoint still failing")
+	}
+
+	// A concurrent replay may have removed it first; the event was delivered
+	// either way
+	if err := n.failures.Delete(ctx, id); err != nil && !errors.Is(err, ErrFailureNotFound) {
+		return fmt.Errorf("removing replayed webhook failure: %w", err)
+	}
+
+	n.logger.Info("webhook failure replayed",
+		slog.String("id", id.String()),
+		slog.String("event", failure.Event),
+		slog.String("delivery_id", failure.DeliveryID))
+
+	return nil
+}
+
+// send makes one delivery attempt and reports whether a failure is worth
+// retrying.
+func (n *Notifier) send(ctx context.Context, event, deliveryID string, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, n.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("creating webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(n.config.Secret, body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("sending webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retryable, fmt.Errorf("webhook endpoint returned %d", resp.StatusCode)
+}
+
+// Sign returns the hex HMAC-SHA256 of body keyed by secret, as receivers
+// should compute it to verify SignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,292 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
+)
+
+// memoryFailures is a dead-letter log kept in memory.
+type memoryFailures struct {
+	mu       sync.Mutex
+	failures map[uuid.UUID]*Failure
+}
+
+func newMemoryFailures() *memoryFailures {
+	return &memoryFailures{failures: make(map[uuid.UUID]*Failure)}
+}
+
+func (m *memoryFailures) Create(ctx context.Context, failure *Failure) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *failure
+	m.failures[failure.ID] = &stored
+	return nil
+}
+
+func (m *memoryFailures) List(ctx context.Context, limit int) ([]*Failure, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	failures := []*Failure{}
+	for _, f := range m.failures {
+		stored := *f
+		failures = append(failures, &stored)
+	}
+	return failures, nil
+}
+
+func (m *memoryFailures) GetByID(ctx context.Context, id uuid.UUID) (*Failure, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.failures[id]
+	if !ok {
+		return nil, ErrFailureNotFound
+	}
+	stored := *f
+	return &stored, nil
+}
+
+func (m *memoryFailures) RecordAttempts(ctx context.Context, id uuid.UUID, attempts int, lastError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.failures[id]
+	if !ok {
+		return ErrFailureNotFound
+	}
+	f.Attempts, f.LastError = attempts, lastError
+	return nil
+}
+
+func (m *memoryFailures) Delete(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.failures[id]; !ok {
+		return ErrFailureNotFound
+	}
+	delete(m.failures, id)
+	return nil
+}
+
+// endpoint is a webhook receiver answering every delivery with status and
+// recording what it received.
+type endpoint struct {
+	mu          sync.Mutex
+	status      int
+	requests    int
+	deliveryIDs []string
+	bodies      []string
+	signatures  []string
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	e.requests++
+	e.deliveryIDs = append(e.deliveryIDs, r.Header.Get(DeliveryHeader))
+	e.bodies = append(e.bodies, string(body))
+	e.signatures = append(e.signatures, r.Header.Get(SignatureHeader))
+	w.WriteHeader(e.status)
+}
+
+func (e *endpoint) setStatus(status int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.status = status
+}
+
+func newTestNotifier(t *testing.T, receiver *endpoint, failures Repository, deadLetter bool) *Notifier {
+	t.Helper()
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	config := &Config{URL: server.URL, Secret: "secret", Timeout: time.Second, MaxRetries: 3, DeadLetter: deadLetter}
+	n := NewNotifier(context.Background(), &sync.WaitGroup{}, config, failures, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	n.retryDelay = time.Millisecond
+	return n
+}
+
+func TestDeliverDeadLetter(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		deadLetter   bool
+		wantRequests int
+		// wantError is the last error of the dead-lettered delivery, empty
+		// when nothing is dead-lettered
+		wantError string
+	}{
+		{name: "delivered", status: http.StatusOK, deadLetter: true, wantRequests: 1},
+		{name: "exhausted retries", status: http.StatusServiceUnavailable, deadLetter: true, wantRequests: 3, wantError: "webhook endpoint returned 503"},
+		{name: "rejected without retries", status: http.StatusBadRequest, deadLetter: true, wantRequests: 1, wantError: "webhook endpoint returned 400"},
+		{name: "dead-letter log off", status: http.StatusServiceUnavailable, wantRequests: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := &endpoint{status: tt.status}
+			failures := newMemoryFailures()
+			n := newTestNotifier(t, receiver, failures, tt.deadLetter)
+
+			n.deliver("transaction.created", "delivery-1", []byte(`{"id":"tx-1"}`))
+
+			if receiver.requests != tt.wantRequests {
+				t.Errorf("endpoint received %d requests, want %d", receiver.requests, tt.wantRequests)
+			}
+
+			logged, _ := failures.List(context.Background(), 10)
+			if tt.wantError == "" {
+				if len(logged) != 0 {
+					t.Errorf("dead-lettered %+v, want nothing", logged[0])
+				}
+				return
+			}
+			if len(logged) != 1 {
+				t.Fatalf("dead-lettered %d deliveries, want 1", len(logged))
+			}
+			f := logged[0]
+			if f.Event != "transaction.created" || f.DeliveryID != "delivery-1" || string(f.Payload) != `{"id":"tx-1"}` {
+				t.Errorf("dead-lettered %s %s %s, want the failed delivery", f.Event, f.DeliveryID, f.Payload)
+			}
+			if f.Attempts != tt.wantRequests || !strings.Contains(f.LastError, tt.wantError) {
+				t.Errorf("dead-lettered after %d attempts with %q, want %d attempts with %q", f.Attempts, f.LastError, tt.wantRequests, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestNotifyShutdownDeadLetters(t *testing.T) {
+	receiver := &endpoint{status: http.StatusServiceUnavailable}
+	failures := newMemoryFailures()
+	n := newTestNotifier(t, receiver, failures, true)
+
+	// The first retry would wait far longer than the test, so only shutdown
+	// can end the delivery
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	n.ctx, n.wg, n.retryDelay = ctx, &wg, time.Hour
+
+	n.Notify("transaction.created", map[string]string{"id": "tx-1"})
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		receiver.mu.Lock()
+		requests := receiver.requests
+		receiver.mu.Unlock()
+		if requests > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("delivery never reached the endpoint")
+		}
+	}
+
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("delivery kept waiting to retry after shutdown")
+	}
+
+	logged, _ := failures.List(context.Background(), 10)
+	if len(logged) != 1 {
+		t.Fatalf("dead-lettered %d deliveries, want 1", len(logged))
+	}
+	if f := logged[0]; f.Attempts != 1 || !strings.Contains(f.LastError, "webhook endpoint returned 503") ||
+		!strings.Contains(f.LastError, context.Canceled.Error()) {
+		t.Errorf("dead-lettered after %d attempts with %q, want 1 attempt interrupted by shutdown", f.Attempts, f.LastError)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	tests := []struct {
+		name string
+		// status is what the endpoint answers the replay with
+		status       int
+		unknownID    bool
+		noURL        bool
+		wantCode     string
+		wantRequests int
+		wantKept     bool
+		wantAttempts int
+	}{
+		{name: "endpoint recovered", status: http.StatusOK, wantRequests: 1},
+		{name: "endpoint still failing", status: http.StatusBadGateway, wantCode: apperror.CodeWebhookDeliveryFailed, wantRequests: 3, wantKept: true, wantAttempts: 6},
+		{name: "unknown failure", status: http.StatusOK, unknownID: true, wantCode: apperror.CodeWebhookFailureNotFound, wantKept: true, wantAttempts: 3},
+		{name: "webhooks disabled", status: http.StatusOK, noURL: true, wantCode: apperror.CodeWebhooksDisabled, wantKept: true, wantAttempts: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := &endpoint{status: http.StatusInternalServerError}
+			failures := newMemoryFailures()
+			n := newTestNotifier(t, receiver, failures, true)
+
+			// Exhaust the retries so the event lands in the dead-letter log
+			n.deliver("transaction.created", "delivery-1", []byte(`{"id":"tx-1"}`))
+			logged, _ := failures.List(context.Background(), 10)
+			if len(logged) != 1 {
+				t.Fatalf("dead-lettered %d deliveries, want 1", len(logged))
+			}
+			id := logged[0].ID
+			if tt.unknownID {
+				id = uuid.New()
+			}
+			if tt.noURL {
+				n.config.URL = ""
+			}
+
+			receiver.setStatus(tt.status)
+			receiver.requests = 0
+			err := n.Replay(context.Background(), id)
+
+			if tt.wantCode != "" {
+				var appErr *apperror.Error
+				if !errors.As(err, &appErr) || appErr.Code != tt.wantCode {
+					t.Fatalf("err = %v, want %s", err, tt.wantCode)
+				}
+			} else if err != nil {
+				t.Fatalf("Replay: %v", err)
+			}
+
+			if receiver.requests != tt.wantRequests {
+				t.Errorf("endpoint received %d replay requests, want %d", receiver.requests, tt.wantRequests)
+			}
+			// Every attempt carries the original delivery ID, body and signature
+			for i := range receiver.deliveryIDs {
+				if receiver.deliveryIDs[i] != "delivery-1" || receiver.bodies[i] != `{"id":"tx-1"}` ||
+					receiver.signatures[i] != "sha256="+Sign("secret", []byte(`{"id":"tx-1"}`)) {
+					t.Errorf("attempt %d sent %s %s %s, want the original delivery", i, receiver.deliveryIDs[i], receiver.bodies[i], receiver.signatures[i])
+				}
+			}
+
+			kept, err := failures.GetByID(context.Background(), logged[0].ID)
+			if !tt.wantKept {
+				if !errors.Is(err, ErrFailureNotFound) {
+					t.Errorf("replayed failure still logged: %+v", kept)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failure removed from the log: %v", err)
+			}
+			if kept.Attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", kept.Attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/kranti/cashflow/internal/apperror"
+)
+
+type Repository interface {
+	Create(ctx context.Context, failure *Failure) error
+	List(ctx context.Context, limit int) ([]*Failure, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*Failure, error)
+	RecordAttempts(ctx context.Context, id uuid.UUID, attempts int, lastError string) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// ErrFailureNotFound is returned when the dead-letter log has no failure with
+// the given ID.
+var ErrFailureNotFound = apperror.New(404, apperror.CodeWebhookFailureNotFound, "webhook failure not found")
+
+const failureColumns = `id, event, delivery_id, payload, last_error, attempts, created_at, updated_at`
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) Create(ctx context.Context, failure *Failure) error {
+	query := `
+		INSERT INTO webhook_failures (id, event, delivery_id, payload, last_error, attempts, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		failure.ID,
+		failure.Event,
+		failure.DeliveryID,
+		// lib/pq sends []byte as bytea, which JSONB does not accept
+		string(failure.Payload),
+		failure.LastError,
+		failure.Attempts,
+		failure.CreatedAt,
+		failure.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("creating webhook failure: %w", err)
+	}
+
+	return nil
+}
+
+// List returns up to limit failures, oldest first, so they can be replayed in
+// the order the events happened.
+func (r *repository) List(ctx context.Context, limit int) ([]*Failure, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM webhook_failures
+		ORDER BY created_at, id
+		LIMIT $1
+	`, failureColumns)
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("listing webhook failures: %w", err)
+	}
+	defer rows.Close()
+
+	failures := []*Failure{}
+	for rows.Next() {
+		failure, err := scanFailure(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning webhook failure: %w", err)
+		}
+		failures = append(failures, failure)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating webhook failures: %w", err)
+	}
+
+	return failures, nil
+}
+
+func (r *repository) GetByID(ctx context.Context, id uuid.UUID) (*Failure, error) {
+	query := fmt.Sprintf(`SELECT %s FROM webhook_failures WHERE id = $1`, failureColumns)
+
+	failure, err := scanFailure(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrFailureNotFound
+		}
+		return nil, fmt.Errorf("getting webhook failure: %w", err)
+	}
+
+	return failure, nil
+}
+
+// RecordAttempts stores the outcome of a replay that failed again.
+func (r *repository) RecordAttempts(ctx context.Context, id uuid.UUID, attempts int, lastError string) error {
+	query := `UPDATE webhook_failures SET attempts = $1, last_error = $2 WHERE id = $3`
+
+	result, err := r.db.ExecContext(ctx, query, attempts, lastError, id)
+	if err != nil {
+		return fmt.Errorf("updating webhook failure: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrFailureNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM webhook_failures WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("deleting webhook failure: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrFailureNotFound
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanFailure reads a row selected with failureColumns.
+func scanFailure(row rowScanner) (*Failure, error) {
+	var f Failure
+	var payload []byte
+	err := row.Scan(
+		&f.ID,
+		&f.Event,
+		&f.DeliveryID,
+		&payload,
+		&f.LastError,
+		&f.Attempts,
+		&f.CreatedAt,
+		&f.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	f.Payload = payload
+	return &f, nil
+}
@@ -0,0 +1,5 @@
+-- Remove merchant column
+DROP INDEX IF EXISTS idx_transactions_merchant;
+
+ALTER TABLE transactions
+DROP COLUMN IF EXISTS merchant;
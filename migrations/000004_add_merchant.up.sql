@@ -0,0 +1,7 @@
+-- Add normalized merchant name extracted from the description
+ALTER TABLE transactions
+ADD COLUMN merchant VARCHAR(255);
+
+CREATE INDEX idx_transactions_merchant ON transactions(LOWER(merchant)) WHERE merchant IS NOT NULL;
+
+COMMENT ON COLUMN transactions.merchant IS 'Merchant name normalized from the description';
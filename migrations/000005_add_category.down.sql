@@ -0,0 +1,5 @@
+-- Remove category column
+DROP INDEX IF EXISTS idx_transactions_category;
+
+ALTER TABLE transactions
+DROP COLUMN IF EXISTS category;
@@ -0,0 +1,7 @@
+-- Add optional category to transactions
+ALTER TABLE transactions
+ADD COLUMN category VARCHAR(100) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_transactions_category ON transactions(category) WHERE category != '';
+
+COMMENT ON COLUMN transactions.category IS 'User-provided category such as groceries or rent; empty when uncategorized';
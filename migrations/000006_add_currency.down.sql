@@ -0,0 +1,5 @@
+-- Remove currency column
+DROP INDEX IF EXISTS idx_transactions_currency;
+
+ALTER TABLE transactions
+DROP COLUMN IF EXISTS currency;
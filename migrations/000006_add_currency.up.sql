@@ -0,0 +1,7 @@
+-- Add ISO 4217 currency code to transactions; existing rows are USD
+ALTER TABLE transactions
+ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
+
+CREATE INDEX idx_transactions_currency ON transactions(currency);
+
+COMMENT ON COLUMN transactions.currency IS 'ISO 4217 currency code of the amount';
@@ -0,0 +1,5 @@
+-- Remove idempotency key column
+DROP INDEX IF EXISTS idx_transactions_idempotency_key;
+
+ALTER TABLE transactions
+DROP COLUMN IF EXISTS idempotency_key;
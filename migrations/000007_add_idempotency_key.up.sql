@@ -0,0 +1,7 @@
+-- Track the client-supplied Idempotency-Key used to create a transaction
+ALTER TABLE transactions
+ADD COLUMN idempotency_key VARCHAR(255);
+
+CREATE UNIQUE INDEX idx_transactions_idempotency_key ON transactions(idempotency_key) WHERE idempotency_key IS NOT NULL;
+
+COMMENT ON COLUMN transactions.idempotency_key IS 'Idempotency-Key header of the creating request; honored for 24 hours';
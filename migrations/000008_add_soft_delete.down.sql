@@ -0,0 +1,5 @@
+-- Remove soft-delete column (soft-deleted rows become visible again)
+DROP INDEX IF EXISTS idx_transactions_deleted_at;
+
+ALTER TABLE transactions
+DROP COLUMN IF EXISTS deleted_at;
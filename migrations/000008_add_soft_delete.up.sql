@@ -0,0 +1,7 @@
+-- Soft-delete transactions instead of removing rows
+ALTER TABLE transactions
+ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_transactions_deleted_at ON transactions(deleted_at) WHERE deleted_at IS NOT NULL;
+
+COMMENT ON COLUMN transactions.deleted_at IS 'Set when the transaction is soft-deleted; NULL for live rows';
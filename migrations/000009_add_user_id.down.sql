@@ -0,0 +1,12 @@
+-- Remove user scoping
+DROP INDEX IF EXISTS idx_transactions_idempotency_key;
+CREATE UNIQUE INDEX idx_transactions_idempotency_key ON transactions(idempotency_key) WHERE idempotency_key IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_upload_requests_user_id;
+DROP INDEX IF EXISTS idx_transactions_user_id_date;
+
+ALTER TABLE upload_requests
+DROP COLUMN IF EXISTS user_id;
+
+ALTER TABLE transactions
+DROP COLUMN IF EXISTS user_id;
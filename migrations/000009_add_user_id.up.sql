@@ -0,0 +1,23 @@
+-- Scope transactions and uploads to the user whose API key created them.
+--
+-- Existing rows get no user_id, and no API key can see them until they are
+-- backfilled. Set LEGACY_OWNER_ID to the owner's user UUID, listed in API_KEYS
+-- as "<user-uuid>:key", and the server assigns them at startup, or run by hand:
+--
+--   UPDATE transactions SET user_id = '<user-uuid>' WHERE user_id IS NULL;
+--   UPDATE upload_requests SET user_id = '<user-uuid>' WHERE user_id IS NULL;
+ALTER TABLE transactions
+ADD COLUMN user_id UUID;
+
+ALTER TABLE upload_requests
+ADD COLUMN user_id UUID;
+
+CREATE INDEX idx_transactions_user_id_date ON transactions(user_id, date);
+CREATE INDEX idx_upload_requests_user_id ON upload_requests(user_id);
+
+-- Idempotency keys are only unique per user
+DROP INDEX IF EXISTS idx_transactions_idempotency_key;
+CREATE UNIQUE INDEX idx_transactions_idempotency_key ON transactions(user_id, idempotency_key) WHERE idempotency_key IS NOT NULL;
+
+COMMENT ON COLUMN transactions.user_id IS 'Owning user; rows created before user scoping are NULL and hidden until backfilled';
+COMMENT ON COLUMN upload_requests.user_id IS 'Owning user; rows created before user scoping are NULL and hidden until backfilled';
@@ -0,0 +1,3 @@
+-- Remove thumbnail key column
+ALTER TABLE transactions
+DROP COLUMN IF EXISTS thumbnail_key;
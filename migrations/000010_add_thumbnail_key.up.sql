@@ -0,0 +1,5 @@
+-- Store the S3 key of the receipt thumbnail generated at link time
+ALTER TABLE transactions
+ADD COLUMN thumbnail_key VARCHAR(500);
+
+COMMENT ON COLUMN transactions.thumbnail_key IS 'S3 key of a small JPEG thumbnail of the receipt image';
@@ -0,0 +1,2 @@
+-- Remove transaction attachments; transactions.image_key keeps the first image
+DROP TABLE IF EXISTS transaction_attachments;
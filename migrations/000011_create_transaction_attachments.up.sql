@@ -0,0 +1,20 @@
+-- Allow several receipt images per transaction
+CREATE TABLE IF NOT EXISTS transaction_attachments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    transaction_id UUID NOT NULL REFERENCES transactions(id) ON DELETE CASCADE,
+    s3_key VARCHAR(500) NOT NULL,
+    thumbnail_key VARCHAR(500),
+    content_type VARCHAR(100) NOT NULL,
+    position INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (transaction_id, position)
+);
+
+-- Existing single images become each transaction's first attachment
+INSERT INTO transaction_attachments (transaction_id, s3_key, thumbnail_key, content_type, position, created_at)
+SELECT t.id, t.image_key, t.thumbnail_key, COALESCE(u.content_type, 'image/jpeg'), 0, t.created_at
+FROM transactions t
+LEFT JOIN upload_requests u ON u.upload_id = t.upload_id
+WHERE t.image_key IS NOT NULL;
+
+COMMENT ON TABLE transaction_attachments IS 'Receipt images of a transaction; transactions.image_key mirrors the first by position';
@@ -0,0 +1,7 @@
+-- Free-form labels such as "business" or "reimbursable"
+ALTER TABLE transactions
+ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_transactions_tags ON transactions USING GIN (tags);
+
+COMMENT ON COLUMN transactions.tags IS 'Lowercase, deduplicated labels';
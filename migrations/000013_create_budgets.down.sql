@@ -0,0 +1,2 @@
+-- Remove budgets
+DROP TABLE IF EXISTS budgets;
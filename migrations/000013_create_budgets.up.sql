@@ -0,0 +1,19 @@
+-- Monthly spending limits per category
+CREATE TABLE IF NOT EXISTS budgets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    category VARCHAR(100) NOT NULL,
+    month DATE NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (user_id, category, month, currency)
+);
+
+CREATE INDEX idx_budgets_user_id_month ON budgets(user_id, month);
+
+CREATE TRIGGER update_budgets_updated_at BEFORE UPDATE
+    ON budgets FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON COLUMN budgets.month IS 'First day of the budgeted month';
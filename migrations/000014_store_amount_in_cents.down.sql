@@ -0,0 +1,9 @@
+-- Restore the decimal amount column
+ALTER TABLE transactions
+ADD COLUMN amount DECIMAL(10,2);
+
+UPDATE transactions SET amount = amount_cents / 100.0;
+
+ALTER TABLE transactions
+ALTER COLUMN amount SET NOT NULL,
+DROP COLUMN amount_cents;
@@ -0,0 +1,11 @@
+-- Store amounts as integer cents so sums are exact
+ALTER TABLE transactions
+ADD COLUMN amount_cents BIGINT;
+
+UPDATE transactions SET amount_cents = ROUND(amount * 100)::BIGINT;
+
+ALTER TABLE transactions
+ALTER COLUMN amount_cents SET NOT NULL,
+DROP COLUMN amount;
+
+COMMENT ON COLUMN transactions.amount_cents IS 'Amount in cents of the currency';
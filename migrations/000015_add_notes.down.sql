@@ -0,0 +1,3 @@
+-- Remove notes
+ALTER TABLE transactions
+DROP COLUMN IF EXISTS notes;
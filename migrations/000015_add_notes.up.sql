@@ -0,0 +1,3 @@
+-- Longer free-form memo, returned only when fetching a single transaction
+ALTER TABLE transactions
+ADD COLUMN notes TEXT NOT NULL DEFAULT '';
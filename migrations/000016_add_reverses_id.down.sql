@@ -0,0 +1,5 @@
+-- Remove reversal links
+DROP INDEX IF EXISTS idx_transactions_reverses_id;
+
+ALTER TABLE transactions
+DROP COLUMN IF EXISTS reverses_id;
@@ -0,0 +1,8 @@
+-- Link a reversing transaction to the one it reverses
+ALTER TABLE transactions
+ADD COLUMN reverses_id UUID REFERENCES transactions(id);
+
+-- A transaction can have at most one reversal that isn't deleted
+CREATE UNIQUE INDEX idx_transactions_reverses_id ON transactions(reverses_id) WHERE reverses_id IS NOT NULL AND deleted_at IS NULL;
+
+COMMENT ON COLUMN transactions.reverses_id IS 'Transaction this one reverses, if any';
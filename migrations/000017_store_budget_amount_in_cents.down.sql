@@ -0,0 +1,10 @@
+-- Restore the decimal budget amount column
+ALTER TABLE budgets
+ADD COLUMN amount DECIMAL(10,2);
+
+UPDATE budgets SET amount = amount_cents / 100.0;
+
+ALTER TABLE budgets
+ALTER COLUMN amount SET NOT NULL,
+ADD CONSTRAINT budgets_amount_check CHECK (amount > 0),
+DROP COLUMN amount_cents;
@@ -0,0 +1,12 @@
+-- Store budget limits as integer cents, like transaction amounts
+ALTER TABLE budgets
+ADD COLUMN amount_cents BIGINT;
+
+UPDATE budgets SET amount_cents = ROUND(amount * 100)::BIGINT;
+
+ALTER TABLE budgets
+ALTER COLUMN amount_cents SET NOT NULL,
+ADD CONSTRAINT budgets_amount_cents_check CHECK (amount_cents > 0),
+DROP COLUMN amount;
+
+COMMENT ON COLUMN budgets.amount_cents IS 'Spending limit in cents of the currency';
@@ -0,0 +1,2 @@
+-- Remove the webhook dead-letter log
+DROP TABLE IF EXISTS webhook_failures;
@@ -0,0 +1,18 @@
+-- Webhook deliveries that still failed after every retry, kept for replay
+CREATE TABLE IF NOT EXISTS webhook_failures (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    event VARCHAR(100) NOT NULL,
+    delivery_id UUID NOT NULL,
+    payload JSONB NOT NULL,
+    last_error TEXT NOT NULL,
+    attempts INTEGER NOT NULL CHECK (attempts > 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhook_failures_created_at ON webhook_failures(created_at);
+
+CREATE TRIGGER update_webhook_failures_updated_at BEFORE UPDATE
+    ON webhook_failures FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON COLUMN webhook_failures.attempts IS 'Delivery attempts made, including replays';